@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"github.com/sengleung/pifra/pifra"
 	"github.com/spf13/cobra"
@@ -40,6 +42,7 @@ var rootCmd = &cobra.Command{
 	Short: "LTS generator for the pi-calculus represented by FRA.",
 	Long: `pifra generates labelled transition systems (LTS) of
 pi-calculus models represented by fresh-register automata.`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		if flags.RegisterSize < 0 {
 			fmt.Println("error: register size must be positive. 0 defaults to unlimited.")
@@ -53,21 +56,57 @@ pi-calculus models represented by fresh-register automata.`,
 			fmt.Println("error: maximum states explored must be positive")
 			os.Exit(1)
 		}
+		if flags.Timeout < 0 {
+			fmt.Println("error: timeout must not be negative. 0 defaults to unlimited.")
+			os.Exit(1)
+		}
+		if flags.MaxMemory < 0 {
+			fmt.Println("error: maximum memory must not be negative. 0 defaults to unlimited.")
+			os.Exit(1)
+		}
+		if flags.Semantics != "early" && flags.Semantics != "late" {
+			fmt.Println("error: semantics must be \"early\" or \"late\"")
+			os.Exit(1)
+		}
+		if flags.Symbolic && flags.Semantics == "late" {
+			fmt.Println("error: the symbolic semantics is early")
+			os.Exit(1)
+		}
+		if flags.Entry != "" && flags.AllEntries {
+			fmt.Println("error: an entry cannot be selected with all entries")
+			os.Exit(1)
+		}
+		if flags.AllEntries && (flags.CheckpointFile != "" || flags.ResumeFile != "") {
+			fmt.Println("error: the exploration of all entries cannot be checkpointed")
+			os.Exit(1)
+		}
+		if flags.Stream != "" && flags.ResumeFile != "" {
+			fmt.Println("error: a resumed exploration cannot be streamed")
+			os.Exit(1)
+		}
 		if flags.InteractiveMode {
 			pifra.InteractiveMode(flags)
 		} else {
 			if len(args) < 1 {
 				fmt.Println("error: input file required for LTS generation")
-				fmt.Printf(cmd.UsageString())
+				fmt.Print(cmd.UsageString())
 				os.Exit(1)
 			}
 			if len(args) > 1 {
 				fmt.Println("error: more than one argument encountered")
-				fmt.Printf(cmd.UsageString())
+				fmt.Print(cmd.UsageString())
 				os.Exit(1)
 			}
 			flags.InputFile = args[0]
-			if err := pifra.OutputMode(flags); err != nil {
+
+			// Interrupting stops the exploration and outputs the partial LTS.
+			// A second interrupt terminates the program.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			go func() {
+				<-ctx.Done()
+				stop()
+			}()
+			if err := pifra.OutputMode(ctx, flags); err != nil {
 				fmt.Println("error:", err)
 				os.Exit(1)
 			}
@@ -75,6 +114,31 @@ pi-calculus models represented by fresh-register automata.`,
 	},
 }
 
+// Write the formatted file instead of printing it.
+var fmtWrite bool
+
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [-w] FILE",
+	Short: "Format a pi-calculus program file.",
+	Long: `fmt formats a pi-calculus program file in a canonical layout,
+keeping its declarations in order and its comments.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println("error: one input file required for formatting")
+			fmt.Print(cmd.UsageString())
+			os.Exit(1)
+		}
+		formatted, err := pifra.FormatFile(args[0], fmtWrite)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		if !fmtWrite {
+			fmt.Print(string(formatted))
+		}
+	},
+}
+
 func execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -89,22 +153,45 @@ func init() {
 	rootCmd.Flags().SortFlags = false
 	rootCmd.PersistentFlags().SortFlags = false
 
-	rootCmd.PersistentFlags().IntVarP(&flags.MaxStates, "max-states", "n", 20, "maximum number of states explored")
-	rootCmd.PersistentFlags().IntVarP(&flags.RegisterSize, "max-registers", "r", 0, "maximum number of registers (default is unlimited)")
-	rootCmd.PersistentFlags().BoolVarP(&flags.DisableGC, "disable-gc", "d", false, "disable garbage collection")
-
-	rootCmd.PersistentFlags().BoolVarP(&flags.InteractiveMode, "interactive", "i", false, "inspect interactively the LTS in a prompt")
-	rootCmd.PersistentFlags().StringVarP(&flags.OutputFile, "output", "o", "", "output the LTS to a file (default format is the Graphviz DOT language)")
-	rootCmd.PersistentFlags().BoolVarP(&flags.GVTex, "output-tex", "t", false, "output the LTS file with LaTeX labels for use with dot2tex")
-	rootCmd.PersistentFlags().BoolVarP(&flags.Pretty, "output-pretty", "p", false, "output the LTS file in a pretty-printed format")
-
-	rootCmd.PersistentFlags().BoolVarP(&flags.GVOutputStates, "output-states", "s", false, "output state numbers instead of configurations for the Graphviz DOT file")
-	rootCmd.PersistentFlags().StringVarP(&flags.GVLayout, "output-layout", "l", "", "layout of the GraphViz DOT file, e.g., \"rankdir=TB; margin=0;\"")
-
-	rootCmd.PersistentFlags().BoolVarP(&flags.Quiet, "quiet", "q", false, "do not print or output the LTS")
-	rootCmd.PersistentFlags().BoolVarP(&flags.Statistics, "stats", "v", false, "print LTS generation statistics")
+	rootCmd.Flags().IntVarP(&flags.MaxStates, "max-states", "n", 20, "maximum number of states explored")
+	rootCmd.Flags().IntVarP(&flags.RegisterSize, "max-registers", "r", 0, "maximum number of registers (default is unlimited)")
+	rootCmd.Flags().BoolVarP(&flags.DisableGC, "disable-gc", "d", false, "disable garbage collection")
+	rootCmd.Flags().BoolVarP(&flags.Symmetry, "symmetry", "y", false, "identify states equal up to permutation of parallel components and registers")
+	rootCmd.Flags().BoolVar(&flags.Closed, "closed", false, "explore only τ transitions of the model as a closed system")
+	rootCmd.Flags().BoolVar(&flags.Barbs, "barbs", false, "report the visible actions of the states as barbs with --closed")
+	rootCmd.Flags().BoolVar(&flags.POR, "por", false, "explore a reduced set of interleavings preserving deadlocks and reachable actions")
+	rootCmd.Flags().StringVar(&flags.Semantics, "semantics", "early", "semantics of inputs: \"early\" or \"late\"")
+	rootCmd.Flags().BoolVar(&flags.Async, "async", false, "explore the asynchronous pi-calculus, where outputs are messages in parallel with their continuation")
+	rootCmd.Flags().BoolVar(&flags.Symbolic, "symbolic", false, "input variables instead of every register name and a fresh name, instantiating them on demand")
+	rootCmd.Flags().StringSliceVar(&flags.Observe, "observe", nil, "free names the environment can use as channels, e.g., \"pub,_BAD\" (default is all)")
+	rootCmd.Flags().DurationVar(&flags.Timeout, "timeout", 0, "stop exploring after a duration, e.g., \"30s\" (default is unlimited)")
+	rootCmd.Flags().IntVar(&flags.MaxMemory, "max-memory", 0, "stop exploring when the heap exceeds a size in MiB (default is unlimited)")
+	rootCmd.Flags().StringVar(&flags.Entry, "entry", "", "entry declared by \"main\" to generate the LTS of")
+	rootCmd.Flags().BoolVar(&flags.AllEntries, "all-entries", false, "generate the LTS of each entry, output to a file named after the entry")
+	rootCmd.Flags().StringVar(&flags.CheckpointFile, "checkpoint", "", "periodically save the exploration to a file")
+	rootCmd.Flags().StringVar(&flags.ResumeFile, "resume", "", "resume the exploration saved to a file by --checkpoint")
+
+	rootCmd.Flags().BoolVarP(&flags.InteractiveMode, "interactive", "i", false, "inspect interactively the LTS in a prompt")
+	rootCmd.Flags().StringVarP(&flags.OutputFile, "output", "o", "", "output the LTS to a file (default format is the Graphviz DOT language)")
+	rootCmd.Flags().BoolVarP(&flags.GVTex, "output-tex", "t", false, "output the LTS file with LaTeX labels for use with dot2tex")
+	rootCmd.Flags().BoolVarP(&flags.Pretty, "output-pretty", "p", false, "output the LTS file in a pretty-printed format")
+	rootCmd.Flags().StringVar(&flags.Stream, "stream", "", "output states and transitions as they are explored in a format: \"pretty\", \"aut\" or \"json\"")
+
+	rootCmd.Flags().BoolVarP(&flags.GVOutputStates, "output-states", "s", false, "output state numbers instead of configurations for the Graphviz DOT file")
+	rootCmd.Flags().StringVarP(&flags.GVLayout, "output-layout", "l", "", "layout of the GraphViz DOT file, e.g., \"rankdir=TB; margin=0;\"")
+
+	rootCmd.Flags().BoolVarP(&flags.Quiet, "quiet", "q", false, "do not print or output the LTS")
+	rootCmd.Flags().BoolVarP(&flags.Statistics, "stats", "v", false, "print LTS generation statistics")
+	rootCmd.Flags().BoolVar(&flags.Progress, "progress", false, "periodically print the exploration progress to stderr")
+	rootCmd.Flags().BoolVar(&flags.Profile, "profile", false, "print LTS generation statistics with the time of each phase and histograms of the states")
+	rootCmd.Flags().BoolVar(&flags.StatsJSON, "stats-json", false, "print LTS generation statistics in JSON")
 
 	rootCmd.PersistentFlags().BoolP("help", "h", false, "show this help message and exit")
+
+	fmtCmd.DisableFlagsInUseLine = true
+	fmtCmd.Flags().BoolVarP(&fmtWrite, "write", "w", false, "write the formatted file instead of printing it")
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(fmtCmd)
 }
 
 func main() {
@@ -2,10 +2,7 @@ module github.com/sengleung/pifra
 
 go 1.19
 
-require (
-	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
-	github.com/spf13/cobra v1.5.0
-)
+require github.com/spf13/cobra v1.5.0
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
@@ -2,8 +2,6 @@ package pifra
 
 import (
 	"strconv"
-
-	"github.com/mohae/deepcopy"
 )
 
 var boundNameIndex int
@@ -14,194 +12,451 @@ func generateBoundName(namePrefix string) string {
 	return name
 }
 
-func substituteName(elem Element, oldName Name, newName Name) {
-	subName(elem, oldName, newName)
+// substituteName returns the element with every occurrence of oldName replaced
+// by newName. Subtrees without an occurrence are shared with the original.
+func substituteName(elem Element, oldName Name, newName Name) Element {
+	return subName(elem, oldName, newName)
 }
 
-func subName(elem Element, oldName Name, newName Name) {
+func subName(elem Element, oldName Name, newName Name) Element {
+	sub := func(name Name) Name {
+		return subCipher(name, func(name Name) Name {
+			if name == oldName {
+				return newName
+			}
+			return name
+		})
+	}
+
 	elemTyp := elem.Type()
 	switch elemTyp {
 	case ElemTypNil:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		if outElem.Channel == oldName {
-			outElem.Channel = newName
-		}
-		if outElem.Output == oldName {
-			outElem.Output = newName
+		channel := sub(outElem.Channel)
+		output := sub(outElem.Output)
+		next := subName(outElem.Next, oldName, newName)
+		if channel != outElem.Channel || output != outElem.Output || next != outElem.Next {
+			return &ElemOutput{
+				Channel: channel,
+				Output:  output,
+				Next:    next,
+			}
 		}
-		subName(outElem.Next, oldName, newName)
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		if inpElem.Channel == oldName {
-			inpElem.Channel = newName
-		}
-		if inpElem.Input == oldName {
-			inpElem.Input = newName
+		channel := sub(inpElem.Channel)
+		input := sub(inpElem.Input)
+		next := subName(inpElem.Next, oldName, newName)
+		if channel != inpElem.Channel || input != inpElem.Input || next != inpElem.Next {
+			return &ElemInput{
+				Channel: channel,
+				Input:   input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
 		}
-		subName(inpElem.Next, oldName, newName)
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		if matchElem.NameL == oldName {
-			matchElem.NameL = newName
+		nameL := sub(matchElem.NameL)
+		nameR := sub(matchElem.NameR)
+		next := subName(matchElem.Next, oldName, newName)
+		if nameL != matchElem.NameL || nameR != matchElem.NameR || next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		guard := subGuard(guardElem.Guard, sub)
+		next := subName(guardElem.Next, oldName, newName)
+		if guard != guardElem.Guard || next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guard,
+				Next:  next,
+			}
 		}
-		if matchElem.NameR == oldName {
-			matchElem.NameR = newName
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		variable := sub(letElem.Var)
+		expr := subExpr(letElem.Expr, sub)
+		next := subName(letElem.Next, oldName, newName)
+		if variable != letElem.Var || expr != letElem.Expr || next != letElem.Next {
+			return &ElemLet{
+				Var:  variable,
+				Expr: expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		nameL := sub(ifElem.NameL)
+		nameR := sub(ifElem.NameR)
+		procThen := subName(ifElem.Then, oldName, newName)
+		procElse := subName(ifElem.Else, oldName, newName)
+		if nameL != ifElem.NameL || nameR != ifElem.NameR ||
+			procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
 		}
-		subName(matchElem.Next, oldName, newName)
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
-		subName(resElem.Next, oldName, newName)
+		next := subName(resElem.Next, oldName, newName)
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		subName(sumElem.ProcessL, oldName, newName)
-		subName(sumElem.ProcessR, oldName, newName)
+		procL := subName(sumElem.ProcessL, oldName, newName)
+		procR := subName(sumElem.ProcessR, oldName, newName)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		subName(parElem.ProcessL, oldName, newName)
-		subName(parElem.ProcessR, oldName, newName)
+		procL := subName(parElem.ProcessL, oldName, newName)
+		procR := subName(parElem.ProcessR, oldName, newName)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypProcess:
 		procElem := elem.(*ElemProcess)
+		var params []Name
 		for i, param := range procElem.Parameters {
-			if param == oldName {
-				procElem.Parameters[i] = newName
+			if newParam := sub(param); newParam != param {
+				if params == nil {
+					params = make([]Name, len(procElem.Parameters))
+					copy(params, procElem.Parameters)
+				}
+				params[i] = newParam
+			}
+		}
+		if params != nil {
+			return &ElemProcess{
+				Name:       procElem.Name,
+				Parameters: params,
 			}
 		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		subName(rootElem.Next, oldName, newName)
+		next := subName(rootElem.Next, oldName, newName)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
+	return elem
 }
 
 // InitRootAst performs alpha-conversion and adds a root element to the AST as the head,
 // for use in the transition relation.
 func InitRootAst(elem Element) Element {
-	DoAlphaConversion(elem)
 	return &ElemRoot{
-		Next: elem,
+		Next: DoAlphaConversion(elem),
 	}
 }
 
-// DoAlphaConversion renames bound names to names appropriate to their scope.
-func DoAlphaConversion(elem Element) {
-	doAlphaConversion(elem)
+// DoAlphaConversion returns the AST with bound names renamed to names
+// appropriate to their scope. The original AST is left unchanged.
+func DoAlphaConversion(elem Element) Element {
+	return doAlphaConversion(elem)
 }
 
-func doAlphaConversion(elem Element) {
+func doAlphaConversion(elem Element) Element {
 	elemTyp := elem.Type()
 	switch elemTyp {
 	case ElemTypNil:
 	case ElemTypOutput:
-		doAlphaConversion(elem.(*ElemOutput).Next)
+		outElem := elem.(*ElemOutput)
+		next := doAlphaConversion(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
 		boundName := inpElem.Input.Name
 		newName := generateBoundName(boundName)
-		inpElem.Input = Name{
-			Name: newName,
-			Type: Bound,
+		next := subBoundNames(inpElem.Next, boundName, newName)
+		return &ElemInput{
+			Channel: inpElem.Channel,
+			Input: Name{
+				Name: newName,
+				Type: Bound,
+			},
+			Sort: inpElem.Sort,
+			Next: doAlphaConversion(next),
 		}
-		subBoundNames(inpElem.Next, boundName, newName)
-		doAlphaConversion(inpElem.Next)
 	case ElemTypMatch:
-		doAlphaConversion(elem.(*ElemEquality).Next)
+		matchElem := elem.(*ElemEquality)
+		next := doAlphaConversion(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := doAlphaConversion(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		boundName := letElem.Var.Name
+		newName := generateBoundName(boundName)
+		next := subBoundNames(letElem.Next, boundName, newName)
+		return &ElemLet{
+			Var: Name{
+				Name: newName,
+				Type: Bound,
+			},
+			Expr: letElem.Expr,
+			Next: doAlphaConversion(next),
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := doAlphaConversion(ifElem.Then)
+		procElse := doAlphaConversion(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
 		boundName := resElem.Restrict.Name
 		newName := generateBoundName(boundName)
-		resElem.Restrict = Name{
-			Name: newName,
-			Type: Bound,
+		next := subBoundNames(resElem.Next, boundName, newName)
+		return &ElemRestriction{
+			Restrict: Name{
+				Name: newName,
+				Type: Bound,
+			},
+			Next: doAlphaConversion(next),
 		}
-		subBoundNames(resElem.Next, boundName, newName)
-		doAlphaConversion(resElem.Next)
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		doAlphaConversion(sumElem.ProcessL)
-		doAlphaConversion(sumElem.ProcessR)
+		procL := doAlphaConversion(sumElem.ProcessL)
+		procR := doAlphaConversion(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		doAlphaConversion(parElem.ProcessL)
-		doAlphaConversion(parElem.ProcessR)
+		procL := doAlphaConversion(parElem.ProcessL)
+		procR := doAlphaConversion(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypProcess:
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		doAlphaConversion(rootElem.Next)
+		next := doAlphaConversion(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
+	return elem
 }
 
-func subBoundNames(elem Element, boundName string, newName string) {
+func subBoundNames(elem Element, boundName string, newName string) Element {
+	sub := func(name Name) Name {
+		return subCipher(name, func(name Name) Name {
+			if name.Name == boundName {
+				return Name{
+					Name: newName,
+					Type: Bound,
+				}
+			}
+			return name
+		})
+	}
+
 	elemTyp := elem.Type()
 	switch elemTyp {
 	case ElemTypNil:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		if outElem.Channel.Name == boundName {
-			outElem.Channel = Name{
-				Name: newName,
-				Type: Bound,
-			}
-		}
-		if outElem.Output.Name == boundName {
-			outElem.Output = Name{
-				Name: newName,
-				Type: Bound,
+		channel := sub(outElem.Channel)
+		output := sub(outElem.Output)
+		next := subBoundNames(outElem.Next, boundName, newName)
+		if channel != outElem.Channel || output != outElem.Output || next != outElem.Next {
+			return &ElemOutput{
+				Channel: channel,
+				Output:  output,
+				Next:    next,
 			}
 		}
-		subBoundNames(outElem.Next, boundName, newName)
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		if inpElem.Channel.Name == boundName {
-			inpElem.Channel = Name{
-				Name: newName,
-				Type: Bound,
-			}
-		}
+		channel := sub(inpElem.Channel)
+		next := inpElem.Next
 		if inpElem.Input.Name != boundName {
-			subBoundNames(inpElem.Next, boundName, newName)
+			next = subBoundNames(inpElem.Next, boundName, newName)
+		}
+		if channel != inpElem.Channel || next != inpElem.Next {
+			return &ElemInput{
+				Channel: channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
 		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		if matchElem.NameL.Name == boundName {
-			matchElem.NameL = Name{
-				Name: newName,
-				Type: Bound,
+		nameL := sub(matchElem.NameL)
+		nameR := sub(matchElem.NameR)
+		next := subBoundNames(matchElem.Next, boundName, newName)
+		if nameL != matchElem.NameL || nameR != matchElem.NameR || next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Next:       next,
 			}
 		}
-		if matchElem.NameR.Name == boundName {
-			matchElem.NameR = Name{
-				Name: newName,
-				Type: Bound,
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		guard := subGuard(guardElem.Guard, sub)
+		next := subBoundNames(guardElem.Next, boundName, newName)
+		if guard != guardElem.Guard || next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		expr := subExpr(letElem.Expr, sub)
+		next := letElem.Next
+		if letElem.Var.Name != boundName {
+			next = subBoundNames(letElem.Next, boundName, newName)
+		}
+		if expr != letElem.Expr || next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		nameL := sub(ifElem.NameL)
+		nameR := sub(ifElem.NameR)
+		procThen := subBoundNames(ifElem.Then, boundName, newName)
+		procElse := subBoundNames(ifElem.Else, boundName, newName)
+		if nameL != ifElem.NameL || nameR != ifElem.NameR ||
+			procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Then:       procThen,
+				Else:       procElse,
 			}
 		}
-		subBoundNames(matchElem.Next, boundName, newName)
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
 		if resElem.Restrict.Name != boundName {
-			subBoundNames(resElem.Next, boundName, newName)
+			next := subBoundNames(resElem.Next, boundName, newName)
+			if next != resElem.Next {
+				return &ElemRestriction{
+					Restrict: resElem.Restrict,
+					Next:     next,
+				}
+			}
 		}
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		subBoundNames(sumElem.ProcessL, boundName, newName)
-		subBoundNames(sumElem.ProcessR, boundName, newName)
+		procL := subBoundNames(sumElem.ProcessL, boundName, newName)
+		procR := subBoundNames(sumElem.ProcessR, boundName, newName)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		subBoundNames(parElem.ProcessL, boundName, newName)
-		subBoundNames(parElem.ProcessR, boundName, newName)
+		procL := subBoundNames(parElem.ProcessL, boundName, newName)
+		procR := subBoundNames(parElem.ProcessR, boundName, newName)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypProcess:
 		pcsElem := elem.(*ElemProcess)
+		var params []Name
 		for i, param := range pcsElem.Parameters {
 			if param.Name == boundName {
-				pcsElem.Parameters[i] = Name{
+				if params == nil {
+					params = make([]Name, len(pcsElem.Parameters))
+					copy(params, pcsElem.Parameters)
+				}
+				params[i] = Name{
 					Name: newName,
 					Type: Bound,
 				}
 			}
 		}
+		if params != nil {
+			return &ElemProcess{
+				Name:       pcsElem.Name,
+				Parameters: params,
+			}
+		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		subBoundNames(rootElem.Next, boundName, newName)
+		next := subBoundNames(rootElem.Next, boundName, newName)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
+	return elem
 }
 
 // PrettyPrintAst returns a string containing the pi-calculus syntax of the AST.
@@ -220,7 +475,11 @@ func prettyPrintAcc(elem Element, str string) string {
 		return prettyPrintAcc(outElem.Next, str)
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		str = str + inpElem.Channel.Name + "(" + inpElem.Input.Name + ")."
+		input := inpElem.Input.Name
+		if inpElem.Sort.Type != SortAny {
+			input = input + ": " + inpElem.Sort.String()
+		}
+		str = str + inpElem.Channel.Name + "(" + input + ")."
 		return prettyPrintAcc(inpElem.Next, str)
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
@@ -230,6 +489,24 @@ func prettyPrintAcc(elem Element, str string) string {
 			str = str + "[" + matchElem.NameL.Name + "=" + matchElem.NameR.Name + "]"
 		}
 		return prettyPrintAcc(matchElem.Next, str)
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		str = str + "[" + prettyPrintGuard(guardElem.Guard) + "]"
+		return prettyPrintAcc(guardElem.Next, str)
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		str = str + "let " + letElem.Var.Name + " = " + prettyPrintExpr(letElem.Expr) + " in "
+		return prettyPrintAcc(letElem.Next, str)
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		op := "="
+		if ifElem.Inequality {
+			op = "!="
+		}
+		procThen := prettyPrintAcc(ifElem.Then, "")
+		procElse := prettyPrintAcc(ifElem.Else, "")
+		str = str + "(if " + ifElem.NameL.Name + op + ifElem.NameR.Name +
+			" then " + procThen + " else " + procElse + ")"
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
 		str = str + "$" + resElem.Restrict.Name + "."
@@ -276,36 +553,41 @@ func GetAllFreeNames(elem Element) []string {
 		case ElemTypNil:
 		case ElemTypOutput:
 			outElem := elem.(*ElemOutput)
-			if outElem.Channel.Type == Free {
-				freshNames = append(freshNames, outElem.Channel.Name)
-			}
-			if outElem.Output.Type == Free {
-				freshNames = append(freshNames, outElem.Output.Name)
-			}
+			freshNames = appendFreeNames(freshNames, outElem.Channel)
+			freshNames = appendFreeNames(freshNames, outElem.Output)
 			return getAllFreeNamesAcc(outElem.Next, freshNames)
 		case ElemTypInput:
 			inpElem := elem.(*ElemInput)
-			if inpElem.Channel.Type == Free {
-				freshNames = append(freshNames, inpElem.Channel.Name)
-			}
-			if inpElem.Input.Type == Free {
-				freshNames = append(freshNames, inpElem.Input.Name)
-			}
+			freshNames = appendFreeNames(freshNames, inpElem.Channel)
+			freshNames = appendFreeNames(freshNames, inpElem.Input)
 			return getAllFreeNamesAcc(inpElem.Next, freshNames)
 		case ElemTypMatch:
 			matchElem := elem.(*ElemEquality)
-			if matchElem.NameL.Type == Free {
-				freshNames = append(freshNames, matchElem.NameL.Name)
+			freshNames = appendFreeNames(freshNames, matchElem.NameL)
+			freshNames = appendFreeNames(freshNames, matchElem.NameR)
+			return getAllFreeNamesAcc(matchElem.Next, freshNames)
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			for _, name := range getGuardNames(guardElem.Guard) {
+				freshNames = appendFreeNames(freshNames, name)
 			}
-			if matchElem.NameR.Type == Free {
-				freshNames = append(freshNames, matchElem.NameR.Name)
+			return getAllFreeNamesAcc(guardElem.Next, freshNames)
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			for _, name := range getExprNames(letElem.Expr) {
+				freshNames = appendFreeNames(freshNames, name)
 			}
-			return getAllFreeNamesAcc(matchElem.Next, freshNames)
+			freshNames = appendFreeNames(freshNames, letElem.Var)
+			return getAllFreeNamesAcc(letElem.Next, freshNames)
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			freshNames = appendFreeNames(freshNames, ifElem.NameL)
+			freshNames = appendFreeNames(freshNames, ifElem.NameR)
+			freshNames = getAllFreeNamesAcc(ifElem.Then, freshNames)
+			freshNames = getAllFreeNamesAcc(ifElem.Else, freshNames)
 		case ElemTypRestriction:
 			resElem := elem.(*ElemRestriction)
-			if resElem.Restrict.Type == Free {
-				freshNames = append(freshNames, resElem.Restrict.Name)
-			}
+			freshNames = appendFreeNames(freshNames, resElem.Restrict)
 			return getAllFreeNamesAcc(resElem.Next, freshNames)
 		case ElemTypSum:
 			sumElem := elem.(*ElemSum)
@@ -320,6 +602,9 @@ func GetAllFreeNames(elem Element) []string {
 
 			// Parameter checks.
 			processName := procElem.Name
+			if processName == knownProcess {
+				return appendFreeNames(freshNames, procElem.Parameters[0])
+			}
 			if _, ok := DeclaredProcs[processName]; !ok {
 				return freshNames
 			}
@@ -331,14 +616,13 @@ func GetAllFreeNames(elem Element) []string {
 			// Do alpha conversion on declared process.
 			// Restore original boundNameIndex because process is only used
 			// for finding free names. Bound names are disregarded.
-			proc := deepcopy.Copy(dp.Process).(Element)
 			bni := boundNameIndex
-			doAlphaConversion(proc)
+			proc := doAlphaConversion(dp.Process)
 			boundNameIndex = bni
 
 			// Substitute parameter names to the new process.
 			for i, oldName := range dp.Parameters {
-				subName(proc, Name{
+				proc = subName(proc, Name{
 					Name: oldName,
 				}, procElem.Parameters[i])
 			}
@@ -130,8 +130,8 @@ func TestSubstituteName(t *testing.T) {
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			substituteName(tc.input, tc.oldName, tc.newName)
-			if !reflect.DeepEqual(tc.input, tc.output) {
+			output := substituteName(tc.input, tc.oldName, tc.newName)
+			if !reflect.DeepEqual(output, tc.output) {
 				t.Error(name)
 			}
 		})
@@ -233,11 +233,12 @@ a(b).$a.b(a).$a.(b'<a>.0 | $b.(a(b).0 | c(d).0))
 			initParser()
 			lex := newLexer(tc.input)
 			yyParse(lex)
-			for _, dp := range DeclaredProcs {
-				DoAlphaConversion(dp.Process)
+			for name, dp := range DeclaredProcs {
+				dp.Process = DoAlphaConversion(dp.Process)
+				DeclaredProcs[name] = dp
 			}
-			for _, elem := range undeclaredProcs {
-				DoAlphaConversion(elem)
+			for i, elem := range undeclaredProcs {
+				undeclaredProcs[i] = DoAlphaConversion(elem)
 			}
 			if !reflect.DeepEqual(tc.declaredProcs, DeclaredProcs) {
 				t.Error(name)
@@ -0,0 +1,208 @@
+package pifra
+
+import (
+	"errors"
+)
+
+// Explore the asynchronous pi-calculus, where outputs have no continuation.
+var asyncSemantics bool
+
+var errAsyncSum = errors.New("an output cannot be a summand in the asynchronous pi-calculus")
+
+// initAsyncProcesses desugars the outputs of the root process and the
+// declared processes for the asynchronous pi-calculus.
+func initAsyncProcesses(proc Element) (Element, error) {
+	proc, err := getAsyncProcess(proc)
+	if err != nil {
+		return nil, err
+	}
+	for name, dp := range DeclaredProcs {
+		if dp.Process, err = getAsyncProcess(dp.Process); err != nil {
+			return nil, err
+		}
+		DeclaredProcs[name] = dp
+	}
+	return proc, nil
+}
+
+// getAsyncProcess returns the process with every output a'<b>.P desugared
+// into the message a'<b>.0 in parallel with P. The messages of a
+// configuration are then its parallel components, which the structural
+// congruence sorts as a multiset.
+func getAsyncProcess(elem Element) (Element, error) {
+	switch elem.Type() {
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		if outElem.Next.Type() == ElemTypNil {
+			return elem, nil
+		}
+		next, err := getAsyncProcess(outElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemParallel{
+			ProcessL: &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    &ElemNil{},
+			},
+			ProcessR: next,
+		}, nil
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		next, err := getAsyncProcess(inpElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemInput{
+			Channel: inpElem.Channel,
+			Input:   inpElem.Input,
+			Sort:    inpElem.Sort,
+			Next:    next,
+		}, nil
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		next, err := getAsyncProcess(matchElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemEquality{
+			Inequality: matchElem.Inequality,
+			NameL:      matchElem.NameL,
+			NameR:      matchElem.NameR,
+			Next:       next,
+		}, nil
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next, err := getAsyncProcess(guardElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemGuard{
+			Guard: guardElem.Guard,
+			Next:  next,
+		}, nil
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next, err := getAsyncProcess(letElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemLet{
+			Var:  letElem.Var,
+			Expr: letElem.Expr,
+			Next: next,
+		}, nil
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen, err := getAsyncProcess(ifElem.Then)
+		if err != nil {
+			return nil, err
+		}
+		procElse, err := getAsyncProcess(ifElem.Else)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemIf{
+			Inequality: ifElem.Inequality,
+			NameL:      ifElem.NameL,
+			NameR:      ifElem.NameR,
+			Then:       procThen,
+			Else:       procElse,
+		}, nil
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		next, err := getAsyncProcess(resElem.Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemRestriction{
+			Restrict: resElem.Restrict,
+			Next:     next,
+		}, nil
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		// A message cannot be withdrawn by a choice.
+		if isOutputSummand(sumElem.ProcessL) || isOutputSummand(sumElem.ProcessR) {
+			return nil, errAsyncSum
+		}
+		procL, err := getAsyncProcess(sumElem.ProcessL)
+		if err != nil {
+			return nil, err
+		}
+		procR, err := getAsyncProcess(sumElem.ProcessR)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemSum{
+			ProcessL: procL,
+			ProcessR: procR,
+		}, nil
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL, err := getAsyncProcess(parElem.ProcessL)
+		if err != nil {
+			return nil, err
+		}
+		procR, err := getAsyncProcess(parElem.ProcessR)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemParallel{
+			ProcessL: procL,
+			ProcessR: procR,
+		}, nil
+	case ElemTypRoot:
+		next, err := getAsyncProcess(elem.(*ElemRoot).Next)
+		if err != nil {
+			return nil, err
+		}
+		return &ElemRoot{
+			Next: next,
+		}, nil
+	}
+	return elem, nil
+}
+
+// isOutputSummand reports whether the summand may act as an output, skipping
+// matches, conditionals and restrictions, and unfolding process constants.
+// The declared processes may already be desugared, so an output in a
+// parallel component is also an output summand.
+func isOutputSummand(summand Element) bool {
+	// Process constants unfolded.
+	unfolded := make(map[string]bool)
+	var isOutputSummandAcc func(summand Element) bool
+	isOutputSummandAcc = func(summand Element) bool {
+		switch summand.Type() {
+		case ElemTypOutput:
+			return true
+		case ElemTypMatch:
+			return isOutputSummandAcc(summand.(*ElemEquality).Next)
+		case ElemTypGuard:
+			return isOutputSummandAcc(summand.(*ElemGuard).Next)
+		case ElemTypLet:
+			return isOutputSummandAcc(summand.(*ElemLet).Next)
+		case ElemTypIf:
+			ifElem := summand.(*ElemIf)
+			return isOutputSummandAcc(ifElem.Then) || isOutputSummandAcc(ifElem.Else)
+		case ElemTypRestriction:
+			return isOutputSummandAcc(summand.(*ElemRestriction).Next)
+		case ElemTypSum:
+			sumElem := summand.(*ElemSum)
+			return isOutputSummandAcc(sumElem.ProcessL) || isOutputSummandAcc(sumElem.ProcessR)
+		case ElemTypParallel:
+			parElem := summand.(*ElemParallel)
+			return isOutputSummandAcc(parElem.ProcessL) || isOutputSummandAcc(parElem.ProcessR)
+		case ElemTypProcess:
+			name := summand.(*ElemProcess).Name
+			dp, ok := DeclaredProcs[name]
+			if !ok || unfolded[name] {
+				return false
+			}
+			unfolded[name] = true
+			return isOutputSummandAcc(dp.Process)
+		}
+		return false
+	}
+	return isOutputSummandAcc(summand)
+}
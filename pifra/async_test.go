@@ -0,0 +1,65 @@
+package pifra
+
+import (
+	"testing"
+)
+
+func TestGetAsyncProcess(t *testing.T) {
+	tests := map[string]struct {
+		input  []byte
+		output string
+		err    error
+	}{
+		"message": {
+			input:  []byte(`a'<b>.0`),
+			output: `a'<b>.0`,
+		},
+		"output_continuation": {
+			input:  []byte(`a'<b>.a'<c>.0`),
+			output: `(a'<b>.0 | a'<c>.0)`,
+		},
+		"input_continuation": {
+			input:  []byte(`a(x).x'<a>.x(y).0`),
+			output: `a(&x_0).(&x_0'<a>.0 | &x_0(&y_1).0)`,
+		},
+		"output_summand": {
+			input: []byte(`a(x).0 + [a=b]$c.a'<c>.0`),
+			err:   errAsyncSum,
+		},
+		"output_process_summand": {
+			input: []byte(`
+P = a'<b>.0
+P + c(x).0`),
+			err: errAsyncSum,
+		},
+		"recursive_process_summand": {
+			input: []byte(`
+P = [a=b]Q
+Q = $d.R
+R = a'<d>.P
+c(x).0 + P`),
+			err: errAsyncSum,
+		},
+		"input_process_summand": {
+			input: []byte(`
+P = [a=b]P + c(y).0
+a(x).0 + P`),
+			output: `(a(&x_0).0 + P)`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, err := InitProgram(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proc, err = getAsyncProcess(proc)
+			if err != tc.err {
+				t.Fatalf("error: %v, expected: %v", err, tc.err)
+			}
+			if err == nil && PrettyPrintAst(proc) != tc.output {
+				t.Errorf("output: %s, expected: %s", PrettyPrintAst(proc), tc.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package pifra
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// File the exploration is periodically checkpointed to.
+var checkpointFile string
+
+// File of the checkpoint the exploration is resumed from.
+var resumeFile string
+
+// Time between checkpoints.
+var checkpointInterval = time.Minute
+
+var errCheckpointMismatch = errors.New("checkpoint was created from a different program or options")
+
+// checkpoint is the serialised form of an exploration. Processes are stored
+// as a table of terms so that shared subterms are written once. States
+// already explored while streaming are only kept in the visited keys.
+type checkpoint struct {
+	// Identifies the program and options the checkpoint was created with.
+	Program string
+
+	Terms          []checkpointTerm
+	Visited        []checkpointKey
+	States         map[int]checkpointState
+	Transitions    []Transition
+	RegSizeReached map[int]bool
+	Barbs          map[int][]string
+	Queue          []int
+	Depths         map[int]int
+
+	StateId         int
+	StatesExplored  int
+	StatesGenerated int
+	TransitionCount int
+}
+
+// checkpointTerm is an element whose children are indices of earlier terms.
+type checkpointTerm struct {
+	Type       ElementType
+	Names      []Name
+	Inequality bool
+	Guard      *Guard
+	Expr       *Expr
+	Sort       Sort
+	Process    string
+	Children   []int
+}
+
+type checkpointKey struct {
+	Process   int
+	Registers string
+	State     int
+}
+
+type checkpointState struct {
+	Process   int
+	Registers Registers
+	Label     Label
+}
+
+// writeCheckpoint serialises the exploration to the file. The file is
+// replaced atomically, so an interrupted write keeps the previous checkpoint.
+func writeCheckpoint(file string, root Configuration, e *exploration) error {
+	cp := checkpoint{
+		Program:         getProgramKey(root),
+		States:          make(map[int]checkpointState),
+		Transitions:     e.trns,
+		RegSizeReached:  e.regSizeReached,
+		Barbs:           e.barbs,
+		Depths:          e.depths,
+		StateId:         e.stateId,
+		StatesExplored:  e.statesExplored,
+		StatesGenerated: e.statesGenerated,
+		TransitionCount: e.transitions,
+	}
+	termIds := make(map[Element]int)
+	for key, id := range e.visited {
+		cp.Visited = append(cp.Visited, checkpointKey{
+			Process:   encodeTerm(key.Process, termIds, &cp.Terms),
+			Registers: key.Registers,
+			State:     id,
+		})
+	}
+	for id, conf := range e.states {
+		cp.States[id] = checkpointState{
+			Process:   encodeTerm(conf.Process, termIds, &cp.Terms),
+			Registers: conf.Registers,
+			Label:     conf.Label,
+		}
+	}
+	for c := e.queue.Front(); c != nil; c = c.Next() {
+		cp.Queue = append(cp.Queue, c.Value.(int))
+	}
+
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(cp); err != nil {
+		return err
+	}
+	tmpFile := file + ".tmp"
+	if err := writeFile(buffer.Bytes(), tmpFile); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// readCheckpoint returns the exploration serialised in the file. The
+// checkpoint must have been created from the same root configuration and
+// options.
+func readCheckpoint(file string, root Configuration) (*exploration, error) {
+	input, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	var cp checkpoint
+	if err := gob.NewDecoder(input).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %s", file, err)
+	}
+	if cp.Program != getProgramKey(root) {
+		return nil, errCheckpointMismatch
+	}
+
+	terms := make([]Element, len(cp.Terms))
+	for i, term := range cp.Terms {
+		terms[i] = decodeTerm(term, terms)
+	}
+
+	e := newExploration()
+	for _, key := range cp.Visited {
+		e.visited[stateKey{
+			Process:   e.terms.intern(terms[key.Process]),
+			Registers: key.Registers,
+		}] = key.State
+	}
+	for id, state := range cp.States {
+		conf, _ := e.terms.internConfiguration(Configuration{
+			Process:   terms[state.Process],
+			Registers: state.Registers,
+			Label:     state.Label,
+		})
+		e.states[id] = conf
+	}
+	e.stateId = cp.StateId
+	e.trns = cp.Transitions
+	for id, reached := range cp.RegSizeReached {
+		e.regSizeReached[id] = reached
+	}
+	for id, barbs := range cp.Barbs {
+		e.barbs[id] = barbs
+	}
+	for _, id := range cp.Queue {
+		e.queue.PushBack(id)
+		e.depths[id] = cp.Depths[id]
+	}
+	e.statesExplored = cp.StatesExplored
+	e.statesGenerated = cp.StatesGenerated
+	e.transitions = cp.TransitionCount
+	return e, nil
+}
+
+// encodeTerm appends the element and its subterms not yet in the table to the
+// terms, and returns the index of the element.
+func encodeTerm(elem Element, termIds map[Element]int, terms *[]checkpointTerm) int {
+	if id, ok := termIds[elem]; ok {
+		return id
+	}
+	var term checkpointTerm
+	term.Type = elem.Type()
+	switch elem.Type() {
+	case ElemTypNil:
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		term.Names = []Name{outElem.Channel, outElem.Output}
+		term.Children = []int{encodeTerm(outElem.Next, termIds, terms)}
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		term.Names = []Name{inpElem.Channel, inpElem.Input}
+		term.Sort = inpElem.Sort
+		term.Children = []int{encodeTerm(inpElem.Next, termIds, terms)}
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		term.Inequality = matchElem.Inequality
+		term.Names = []Name{matchElem.NameL, matchElem.NameR}
+		term.Children = []int{encodeTerm(matchElem.Next, termIds, terms)}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		term.Guard = guardElem.Guard
+		term.Children = []int{encodeTerm(guardElem.Next, termIds, terms)}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		term.Names = []Name{letElem.Var}
+		term.Expr = letElem.Expr
+		term.Children = []int{encodeTerm(letElem.Next, termIds, terms)}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		term.Inequality = ifElem.Inequality
+		term.Names = []Name{ifElem.NameL, ifElem.NameR}
+		term.Children = []int{
+			encodeTerm(ifElem.Then, termIds, terms),
+			encodeTerm(ifElem.Else, termIds, terms),
+		}
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		term.Names = []Name{resElem.Restrict}
+		term.Children = []int{encodeTerm(resElem.Next, termIds, terms)}
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		term.Children = []int{
+			encodeTerm(sumElem.ProcessL, termIds, terms),
+			encodeTerm(sumElem.ProcessR, termIds, terms),
+		}
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		term.Children = []int{
+			encodeTerm(parElem.ProcessL, termIds, terms),
+			encodeTerm(parElem.ProcessR, termIds, terms),
+		}
+	case ElemTypProcess:
+		procElem := elem.(*ElemProcess)
+		term.Process = procElem.Name
+		term.Names = procElem.Parameters
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		term.Children = []int{encodeTerm(rootElem.Next, termIds, terms)}
+	}
+	id := len(*terms)
+	*terms = append(*terms, term)
+	termIds[elem] = id
+	return id
+}
+
+// decodeTerm returns the element of the term, whose children are among the
+// decoded terms.
+func decodeTerm(term checkpointTerm, terms []Element) Element {
+	switch term.Type {
+	case ElemTypOutput:
+		return &ElemOutput{
+			Channel: term.Names[0],
+			Output:  term.Names[1],
+			Next:    terms[term.Children[0]],
+		}
+	case ElemTypInput:
+		return &ElemInput{
+			Channel: term.Names[0],
+			Input:   term.Names[1],
+			Sort:    term.Sort,
+			Next:    terms[term.Children[0]],
+		}
+	case ElemTypMatch:
+		return &ElemEquality{
+			Inequality: term.Inequality,
+			NameL:      term.Names[0],
+			NameR:      term.Names[1],
+			Next:       terms[term.Children[0]],
+		}
+	case ElemTypGuard:
+		return &ElemGuard{
+			Guard: term.Guard,
+			Next:  terms[term.Children[0]],
+		}
+	case ElemTypLet:
+		return &ElemLet{
+			Var:  term.Names[0],
+			Expr: term.Expr,
+			Next: terms[term.Children[0]],
+		}
+	case ElemTypIf:
+		return &ElemIf{
+			Inequality: term.Inequality,
+			NameL:      term.Names[0],
+			NameR:      term.Names[1],
+			Then:       terms[term.Children[0]],
+			Else:       terms[term.Children[1]],
+		}
+	case ElemTypRestriction:
+		return &ElemRestriction{
+			Restrict: term.Names[0],
+			Next:     terms[term.Children[0]],
+		}
+	case ElemTypSum:
+		return &ElemSum{
+			ProcessL: terms[term.Children[0]],
+			ProcessR: terms[term.Children[1]],
+		}
+	case ElemTypParallel:
+		return &ElemParallel{
+			ProcessL: terms[term.Children[0]],
+			ProcessR: terms[term.Children[1]],
+		}
+	case ElemTypProcess:
+		return &ElemProcess{
+			Name:       term.Process,
+			Parameters: term.Names,
+		}
+	case ElemTypRoot:
+		return &ElemRoot{
+			Next: terms[term.Children[0]],
+		}
+	}
+	return &ElemNil{}
+}
+
+// getProgramKey returns a string identifying the root configuration, the
+// declared processes and the options affecting the explored states.
+func getProgramKey(root Configuration) string {
+	var names []string
+	for name := range DeclaredProcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(prettyPrintRegister(root.Registers) + " |- " + PrettyPrintAst(root.Process) + "\n")
+	for _, name := range names {
+		dp := DeclaredProcs[name]
+		buffer.WriteString(fmt.Sprintf("%s%v = %s\n", name, dp.Parameters, PrettyPrintAst(dp.Process)))
+	}
+	buffer.WriteString(fmt.Sprintf("registers=%d gc=%t symmetry=%t por=%t closed=%t barbs=%t observe=%q symbolic=%t late=%t async=%t\n",
+		registerSize, !disableGarbageCollection, symmetryReduction, partialOrderReduction,
+		closedSystem, reportBarbs, observedNames, symbolicSemantics, lateSemantics, asyncSemantics))
+	return buffer.String()
+}
@@ -0,0 +1,52 @@
+package pifra
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	input := []byte(`
+P(a) = a(x).$y.(x'<y>.0 | P(y)) + a'<a>.P(a)
+P(a) | b(z).[z=b]P(z)
+`)
+	file := filepath.Join(t.TempDir(), "checkpoint")
+	defer func() {
+		maxStatesExplored = 1
+		checkpointFile = ""
+		resumeFile = ""
+	}()
+
+	maxStatesExplored = 30
+	lts, err := generateLts(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := generatePrettyLts(lts)
+	expectedExplored := lts.StatesExplored
+
+	maxStatesExplored = 10
+	checkpointFile = file
+	if _, err := generateLts(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+	maxStatesExplored = 30
+	checkpointFile = ""
+	resumeFile = file
+	lts, err = generateLts(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := generatePrettyLts(lts); string(output) != string(expected) {
+		t.Errorf("resumed LTS:\n%s\nexpected:\n%s", output, expected)
+	}
+	if lts.StatesExplored != expectedExplored {
+		t.Errorf("states explored: %d, expected: %d", lts.StatesExplored, expectedExplored)
+	}
+
+	// The checkpoint does not match a different program.
+	if _, err := generateLts(context.Background(), []byte(`a(x).0`)); err != errCheckpointMismatch {
+		t.Errorf("error: %v, expected: %v", err, errCheckpointMismatch)
+	}
+}
@@ -0,0 +1,297 @@
+package pifra
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Ciphertexts are term-valued names of type Ciphertext, the encryption
+// enc(m,k) of a message m with a key k. The name of a ciphertext is "{m}k",
+// so that ciphertexts are compared by name like other names, and its
+// structure is kept in Cipher. The names of a ciphertext are substituted,
+// garbage collected and normalised like the names they are.
+//
+// The environment only sends names and the ciphertexts it has observed, so it
+// cannot forge ciphertexts. An output of a ciphertext to the environment is
+// labelled with the ciphertext, where its restricted names are hidden as "_",
+// and does not extrude them: the environment cannot decrypt ciphertexts.
+
+// Name of the process constant ?known(c), that the environment has observed
+// the ciphertext c. Like the constraints of the symbolic semantics, it cannot
+// be declared, so it has no transitions. It is kept in parallel with the
+// process, so that the ciphertext is normalised with the process and its
+// restricted names stay in scope.
+var knownProcess = varPrefix + "known"
+
+// Cipher is the structure of a ciphertext.
+type Cipher struct {
+	Message Name
+	Key     Name
+}
+
+func newCiphertext(message Name, key Name) Name {
+	return Name{
+		Name: "{" + message.Name + "}" + key.Name,
+		Type: Ciphertext,
+		Cipher: &Cipher{
+			Message: message,
+			Key:     key,
+		},
+	}
+}
+
+// decrypt returns the message of a ciphertext encrypted with the key, or
+// false if the name is not such a ciphertext.
+func decrypt(ciphertext Name, key Name) (Name, bool) {
+	if ciphertext.Type != Ciphertext || ciphertext.Cipher.Key.Name != key.Name {
+		return Name{}, false
+	}
+	return ciphertext.Cipher.Message, true
+}
+
+// subCipher returns the name substituted, where the names of a ciphertext
+// are substituted instead. A ciphertext without a substituted name is
+// returned unchanged.
+func subCipher(name Name, sub func(Name) Name) Name {
+	if name.Type != Ciphertext {
+		return sub(name)
+	}
+	message := subCipher(name.Cipher.Message, sub)
+	key := subCipher(name.Cipher.Key, sub)
+	if message != name.Cipher.Message || key != name.Cipher.Key {
+		return newCiphertext(message, key)
+	}
+	return name
+}
+
+// getCipherNames returns the names of a ciphertext in pretty-printed order,
+// or the name if it is not a ciphertext.
+func getCipherNames(name Name) []Name {
+	if name.Type != Ciphertext {
+		return []Name{name}
+	}
+	return append(getCipherNames(name.Cipher.Message), getCipherNames(name.Cipher.Key)...)
+}
+
+// equalNames reports whether two names are equal, where ciphertexts are
+// compared by structure.
+func equalNames(a Name, b Name) bool {
+	if a.Type != Ciphertext || b.Type != Ciphertext {
+		return a == b
+	}
+	return equalNames(a.Cipher.Message, b.Cipher.Message) && equalNames(a.Cipher.Key, b.Cipher.Key)
+}
+
+// containsName reports whether the name is the other name or a ciphertext
+// of it.
+func containsName(name Name, other Name) bool {
+	for _, cipherName := range getCipherNames(name) {
+		if cipherName == other {
+			return true
+		}
+	}
+	return false
+}
+
+// appendFreeNames appends the name if it is free, or the free names of a
+// ciphertext.
+func appendFreeNames(freeNames []string, name Name) []string {
+	for _, cipherName := range getCipherNames(name) {
+		if cipherName.Type == Free {
+			freeNames = append(freeNames, cipherName.Name)
+		}
+	}
+	return freeNames
+}
+
+// getCipherSymbol returns the symbol of a ciphertext in a label, where the
+// free names are register labels and the restricted names are hidden.
+func getCipherSymbol(ciphertext Name, reg Registers) Symbol {
+	var getCipherLabel func(name Name) string
+	getCipherLabel = func(name Name) string {
+		switch name.Type {
+		case Ciphertext:
+			return "{" + getCipherLabel(name.Cipher.Message) + "}" + getCipherLabel(name.Cipher.Key)
+		case Data:
+			return "=" + name.Name
+		case Free:
+			return strconv.Itoa(reg.GetLabel(name.Name))
+		}
+		return "_"
+	}
+	return Symbol{
+		Type:   SymbolTypCipher,
+		Cipher: getCipherLabel(ciphertext),
+	}
+}
+
+// getKnownCiphertexts returns the ciphertexts the environment has observed.
+func getKnownCiphertexts(elem Element) []Name {
+	var known []Name
+	var getKnownCiphertextsAcc func(elem Element)
+	getKnownCiphertextsAcc = func(elem Element) {
+		switch elem.Type() {
+		case ElemTypProcess:
+			procElem := elem.(*ElemProcess)
+			if procElem.Name == knownProcess {
+				known = append(known, procElem.Parameters[0])
+			}
+		case ElemTypRestriction:
+			getKnownCiphertextsAcc(elem.(*ElemRestriction).Next)
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			getKnownCiphertextsAcc(parElem.ProcessL)
+			getKnownCiphertextsAcc(parElem.ProcessR)
+		case ElemTypRoot:
+			getKnownCiphertextsAcc(elem.(*ElemRoot).Next)
+		}
+	}
+	getKnownCiphertextsAcc(elem)
+	return known
+}
+
+// observeCiphertext returns the configuration where the environment has
+// observed the ciphertext output to it by the transition. The restrictions
+// of the names of the ciphertext are extruded to the observation.
+func observeCiphertext(conf Configuration) Configuration {
+	if conf.Label.Symbol.Type != SymbolTypOutput || conf.Label.Symbol2.Type != SymbolTypCipher {
+		return conf
+	}
+	rootElem, ok := conf.Process.(*ElemRoot)
+	if !ok {
+		return conf
+	}
+	for _, known := range getKnownCiphertexts(rootElem) {
+		if equalNames(known, conf.ciphertext) {
+			return conf
+		}
+	}
+	next, extruded := extrudeCipherRes(rootElem.Next, conf.ciphertext)
+	conf.Process = &ElemRoot{
+		Next: restrictNames(&ElemParallel{
+			ProcessL: &ElemProcess{
+				Name:       knownProcess,
+				Parameters: []Name{conf.ciphertext},
+			},
+			ProcessR: next,
+		}, extruded),
+	}
+	return conf
+}
+
+// extrudeRes returns the process without the unguarded restriction of a
+// name, and whether it is found. The restrictions of the names of a
+// ciphertext sent by a communication are extruded to the communication.
+func extrudeRes(elem Element, name Name) (Element, bool) {
+	switch elem.Type() {
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		if resElem.Restrict == name {
+			return resElem.Next, true
+		}
+		if next, ok := extrudeRes(resElem.Next, name); ok {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}, true
+		}
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		if procL, ok := extrudeRes(parElem.ProcessL, name); ok {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: parElem.ProcessR,
+			}, true
+		}
+		if procR, ok := extrudeRes(parElem.ProcessR, name); ok {
+			return &ElemParallel{
+				ProcessL: parElem.ProcessL,
+				ProcessR: procR,
+			}, true
+		}
+	}
+	return elem, false
+}
+
+// extrudeCipherRes returns the process without the unguarded restrictions of
+// the restricted names of the ciphertext, and the names extruded.
+func extrudeCipherRes(elem Element, ciphertext Name) (Element, []Name) {
+	var extruded []Name
+	for _, cipherName := range getCipherNames(ciphertext) {
+		if cipherName.Type != Bound {
+			continue
+		}
+		if next, ok := extrudeRes(elem, cipherName); ok {
+			elem = next
+			extruded = append(extruded, cipherName)
+		}
+	}
+	return elem, extruded
+}
+
+// restrictNames returns the process under the restrictions of the names.
+func restrictNames(elem Element, names []Name) Element {
+	for _, name := range names {
+		elem = &ElemRestriction{
+			Restrict: name,
+			Next:     elem,
+		}
+	}
+	return elem
+}
+
+// commCipher returns the communication of a ciphertext from an output to the
+// fresh input of its parallel component. The ciphertext is substituted for
+// the fresh name of the input, and the restrictions of its names in the
+// output are extruded to the parallel composition.
+func commCipher(outConf Configuration, inpConf Configuration, outLeft bool) Element {
+	outPar := outConf.Process.(*ElemParallel)
+	inpPar := inpConf.Process.(*ElemParallel)
+	ciphertext := outConf.ciphertext
+	name := getReceivedName(inpConf)
+
+	var out, inp Element
+	if outLeft {
+		out = outPar.ProcessL
+		inp = subName(inpPar.ProcessR, name, ciphertext)
+	} else {
+		out = outPar.ProcessR
+		inp = subName(inpPar.ProcessL, name, ciphertext)
+	}
+
+	out, extruded := extrudeCipherRes(out, ciphertext)
+
+	var comm Element
+	if outLeft {
+		comm = &ElemParallel{
+			ProcessL: out,
+			ProcessR: inp,
+		}
+	} else {
+		comm = &ElemParallel{
+			ProcessL: inp,
+			ProcessR: out,
+		}
+	}
+	return restrictNames(comm, extruded)
+}
+
+// texCipherReplacer escapes the ciphertext of a label in TeX.
+var texCipherReplacer = strings.NewReplacer("{", `\{`, "}", `\}`, "_", `\_`, "=", `{=}`)
+
+// getTexCipherName returns the TeX of the name of a ciphertext "{m}k".
+func getTexCipherName(name string) string {
+	depth := 0
+	for i, c := range name {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return `\{ ` + getTexName(name[1:i]) + ` \}_{` + getTexName(name[i+1:]) + `}`
+			}
+		}
+	}
+	return name
+}
@@ -0,0 +1,111 @@
+package pifra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecrypt(t *testing.T) {
+	m := Name{
+		Name: "m",
+	}
+	k := Name{
+		Name: "k",
+	}
+	ciphertext := newCiphertext(m, k)
+	if ciphertext.Name != "{m}k" {
+		t.Errorf("ciphertext: %s, expected: {m}k", ciphertext.Name)
+	}
+	if message, ok := decrypt(ciphertext, k); !ok || message != m {
+		t.Errorf("message: %s %t, expected: m true", message.Name, ok)
+	}
+	if _, ok := decrypt(ciphertext, m); ok {
+		t.Error("ciphertext decrypted with another key")
+	}
+	if _, ok := decrypt(m, k); ok {
+		t.Error("name decrypted")
+	}
+}
+
+func TestSubCipher(t *testing.T) {
+	m := Name{
+		Name: "m",
+	}
+	k := Name{
+		Name: "k",
+	}
+	ciphertext := newCiphertext(newCiphertext(m, k), k)
+	sub := func(name Name) Name {
+		if name == k {
+			return Name{
+				Name: "l",
+			}
+		}
+		return name
+	}
+	subbed := subCipher(ciphertext, sub)
+	if subbed.Name != "{{m}l}l" {
+		t.Errorf("ciphertext: %s, expected: {{m}l}l", subbed.Name)
+	}
+	if equalNames(subbed, ciphertext) {
+		t.Error("substituted ciphertext equal to the original")
+	}
+	if !equalNames(subbed, newCiphertext(newCiphertext(m, sub(k)), sub(k))) {
+		t.Error("substituted ciphertext not equal by structure")
+	}
+	if unchanged := subCipher(ciphertext, func(name Name) Name { return name }); unchanged != ciphertext {
+		t.Error("ciphertext without a substituted name changed")
+	}
+}
+
+func TestCipherTransitions(t *testing.T) {
+	tests := map[string]struct {
+		input  []byte
+		output string
+	}{
+		// The outputs of equal ciphertexts have the same transition.
+		"duplicate_summand": {
+			input: []byte(`a'<enc(b,c)>.0 + a'<enc(b,c)>.0`),
+			output: `s0 = {(1,#1),(2,#2),(3,#3)} |- (let &1 = enc(#2,#3) in #1'<&1>.0 + let &2 = enc(#2,#3) in #1'<&2>.0)
+s0  1'{2}3   s1 = {(2,#2),(3,#3)} |- ?known({#2}#3)`,
+		},
+		// The environment can send back the ciphertext it observed.
+		"comm": {
+			input: []byte(`$k.(a'<enc(b,k)>.0 | a(x).case x of {y}k in y'<y>.0)`),
+			output: `s0 = {(1,#1),(2,#2)} |- $&2.(#1(&3).let &4 = dec(&3,&2) in &4'<&4>.0 | let &1 = enc(#2,&2) in #1'<&1>.0)
+s0  1 1   s1 = {(1,#1),(2,#2)} |- $&2.(let &1 = dec(#1,&2) in &1'<&1>.0 | let &3 = enc(#2,&2) in #1'<&3>.0)
+s0  1 2   s2 = {(1,#1),(2,#2)} |- $&2.(let &1 = dec(#2,&2) in &1'<&1>.0 | let &3 = enc(#2,&2) in #1'<&3>.0)
+s0  1 3*  s3 = {(1,#1),(2,#2),(3,#3)} |- $&2.(let &1 = dec(#3,&2) in &1'<&1>.0 | let &3 = enc(#2,&2) in #1'<&3>.0)
+s0  1'{2}_   s4 = {(1,#1),(2,#2)} |- $&1.(#1(&2).let &3 = dec(&2,&1) in &3'<&3>.0 | ?known({#2}&1))
+s0  t     s5 = {(2,#2)} |- $&2.let &1 = dec({#2}&2,&2) in &1'<&1>.0
+s1  1'{2}_   s6 = {(1,#1),(2,#2)} |- $&1.(?known({#2}&1) | let &2 = dec(#1,&1) in &2'<&2>.0)
+s2  1'{2}_   s7 = {(2,#2)} |- $&1.(?known({#2}&1) | let &2 = dec(#2,&1) in &2'<&2>.0)
+s3  1'{2}_   s8 = {(2,#2),(3,#3)} |- $&1.(?known({#2}&1) | let &2 = dec(#3,&1) in &2'<&2>.0)
+s4  1 1   s9 = {(1,#1),(2,#2)} |- $&2.(?known({#2}&2) | let &1 = dec(#1,&2) in &1'<&1>.0)
+s4  1 2   s10 = {(2,#2)} |- $&2.(?known({#2}&2) | let &1 = dec(#2,&2) in &1'<&1>.0)
+s4  1 {2}_   s11 = {(2,#2)} |- $&2.(?known({#2}&2) | let &1 = dec({#2}&2,&2) in &1'<&1>.0)
+s4  1 1*  s9 = {(1,#1),(2,#2)} |- $&2.(?known({#2}&2) | let &1 = dec(#1,&2) in &1'<&1>.0)
+s5  2'2   s12 = {} |- 0
+s11  2'2   s13 = {(2,#2)} |- $&1.?known({#2}&1)`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flags := Flags{
+				MaxStates:    100,
+				RegisterSize: 1073741824,
+			}
+			defer initFlags(Flags{
+				MaxStates:    1,
+				RegisterSize: 1073741824,
+			})
+			lts, err := GenerateLts(context.Background(), tc.input, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := string(generatePrettyLts(lts)); output != tc.output {
+				t.Errorf("output:\n%s\nexpected:\n%s", output, tc.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package pifra
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Explore only τ transitions, i.e. the reduction semantics of a closed
+// system. The environment does not send names, so an input receives a
+// placeholder substituted by the communications, as in the late semantics,
+// rather than each register name and a fresh name.
+var closedSystem bool
+
+// Report the visible actions of the states as barbs in a closed system.
+var reportBarbs bool
+
+// getTauTrans returns the τ transitions.
+func getTauTrans(confs []Configuration) []Configuration {
+	var tconfs []Configuration
+	for _, conf := range confs {
+		if conf.Label.Symbol.Type == SymbolTypTau {
+			tconfs = append(tconfs, conf)
+		}
+	}
+	return tconfs
+}
+
+// getBarbs returns the barbs of the visible transitions in order, i.e. the
+// register labels of the channels of inputs, and of outputs followed by "'".
+func getBarbs(confs []Configuration) []string {
+	seen := make(map[Symbol]bool)
+	var symbols []Symbol
+	for _, conf := range confs {
+		symbol := conf.Label.Symbol
+		if symbol.Type != SymbolTypInput && symbol.Type != SymbolTypOutput {
+			continue
+		}
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Value != symbols[j].Value {
+			return symbols[i].Value < symbols[j].Value
+		}
+		return symbols[i].Type < symbols[j].Type
+	})
+
+	var barbs []string
+	for _, symbol := range symbols {
+		barb := strconv.Itoa(symbol.Value)
+		if symbol.Type == SymbolTypOutput {
+			barb = barb + "'"
+		}
+		barbs = append(barbs, barb)
+	}
+	return barbs
+}
+
+// prettyPrintBarbs returns the barbs of the state prefixed by a separator, or
+// an empty string if the state has no barbs reported.
+func prettyPrintBarbs(lts Lts, id int, sep string) string {
+	barbs, ok := lts.Barbs[id]
+	if !ok {
+		return ""
+	}
+	return sep + "↓{" + strings.Join(barbs, ",") + "}"
+}
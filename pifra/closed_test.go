@@ -0,0 +1,101 @@
+package pifra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClosedSystem(t *testing.T) {
+	input := []byte(`
+$c.(c'<a>.a'<b>.0 | c(x).x(y).0) | d(y).0
+`)
+	tests := map[string]struct {
+		flags  Flags
+		output string
+	}{
+		"closed": {
+			flags: Flags{
+				Closed: true,
+			},
+			output: `s0 = {(1,#1),(2,#2),(3,#3)} |- (#3(&4).0 | $&1.(&1'<#1>.#1'<#2>.0 | &1(&2).&2(&3).0))
+s0  t     s1 = {(1,#1),(2,#2),(3,#3)} |- (#1'<#2>.0 | (#1(&2).0 | #3(&1).0))
+s1  t     s2 = {(3,#3)} |- #3(&1).0`,
+		},
+		"closed_barbs": {
+			flags: Flags{
+				Closed: true,
+				Barbs:  true,
+			},
+			output: `s0 = {(1,#1),(2,#2),(3,#3)} |- (#3(&4).0 | $&1.(&1'<#1>.#1'<#2>.0 | &1(&2).&2(&3).0))  ↓{3}
+s0  t     s1 = {(1,#1),(2,#2),(3,#3)} |- (#1'<#2>.0 | (#1(&2).0 | #3(&1).0))  ↓{1,1',3}
+s1  t     s2 = {(3,#3)} |- #3(&1).0  ↓{3}`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flags := tc.flags
+			flags.MaxStates = 100
+			flags.RegisterSize = 1073741824
+			defer initFlags(Flags{
+				MaxStates:    1,
+				RegisterSize: 1073741824,
+			})
+			lts, err := GenerateLts(context.Background(), input, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := string(generatePrettyLts(lts)); output != tc.output {
+				t.Errorf("output:\n%s\nexpected:\n%s", output, tc.output)
+			}
+		})
+	}
+}
+
+// The barbs of a state are its visible actions, which are not in its ample
+// set.
+func TestClosedSystemBarbsPOR(t *testing.T) {
+	input := []byte(`$c.(c(x).0 | c'<c>.0) | a'<a>.0`)
+	output := `s0 = {(1,#1)} |- (#1'<#1>.0 | $&1.(&1'<&1>.0 | &1(&2).0))  ↓{1'}
+s0  t     s1 = {(1,#1)} |- #1'<#1>.0  ↓{1'}`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Closed:       true,
+		Barbs:        true,
+		POR:          true,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+// An input of a closed system receives a placeholder rather than each name.
+func TestClosedSystemInput(t *testing.T) {
+	closedSystem = true
+	defer func() {
+		closedSystem = false
+	}()
+	proc, _ := InitProgram([]byte(`a(x).x'<b>.0`))
+	confs := trans(newRootConf(proc))
+	if len(confs) != 1 || confs[0].Label.Symbol2.Type != SymbolTypBoundInput {
+		t.Errorf("transitions: %d, expected: 1 placeholder input", len(confs))
+	}
+}
+
+func TestGetBarbs(t *testing.T) {
+	proc, _ := InitProgram([]byte(`b'<a>.0 | a(x).0 | b'<b>.0`))
+	barbs := getBarbs(trans(newRootConf(proc)))
+	expected := []string{"1", "2'"}
+	if len(barbs) != len(expected) || barbs[0] != expected[0] || barbs[1] != expected[1] {
+		t.Errorf("barbs: %v, expected: %v", barbs, expected)
+	}
+}
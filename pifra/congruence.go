@@ -10,42 +10,56 @@ var fnPrefix = "#"
 
 var disableGarbageCollection bool
 
-func applyStructrualCongruence(conf Configuration) {
+func applyStructrualCongruence(conf Configuration) Configuration {
+	start := startPhase()
+	conf.Process = evalDataLets(conf.Process)
+	start = endStartPhase(phaseEvalData, start)
+	if symbolicSemantics {
+		conf.Process = rmDecidedMatches(conf.Process)
+	}
+	start = endStartPhase(phaseRmMatches, start)
 	if !disableGarbageCollection {
-		garbageCollection(conf)
+		conf = garbageCollection(conf)
 	}
+	start = endStartPhase(phaseGarbageCollection, start)
 
-	rmRes(conf.Process)
-	scopeRes(conf.Process)
-
-	normaliseNilProc(conf.Process)
-	normaliseFreshNames(conf)
-	normaliseBoundNames(conf)
+	conf.Process = rmRes(conf.Process)
+	start = endStartPhase(phaseRmRes, start)
+	conf.Process = scopeRes(conf.Process)
+	start = endStartPhase(phaseScopeRes, start)
 
-	sortSumPar(conf.Process)
-	scopeRes(conf.Process)
-	sortRes(conf.Process)
-}
+	conf.Process = normaliseNilProc(conf.Process)
+	start = endStartPhase(phaseNormaliseNil, start)
+	conf = normaliseFreshNames(conf)
+	conf = normaliseBoundNames(conf)
+	start = endStartPhase(phaseNormaliseNames, start)
 
-func getConfigurationKey(conf Configuration) string {
-	return prettyPrintRegister(conf.Registers) + PrettyPrintAst(conf.Process)
+	conf.Process = sortSumPar(conf.Process)
+	start = endStartPhase(phaseSortSumPar, start)
+	conf.Process = scopeRes(conf.Process)
+	start = endStartPhase(phaseScopeRes, start)
+	conf.Process = sortRes(conf.Process)
+	endPhase(phaseSortRes, start)
+	return conf
 }
 
-func garbageCollection(conf Configuration) {
+func garbageCollection(conf Configuration) Configuration {
 	fns := GetAllFreeNames(conf.Process)
 	freshNames := make(map[string]bool)
 	for _, freshName := range fns {
 		freshNames[freshName] = true
 	}
 
+	conf.Registers = conf.Registers.copy()
 	for label, name := range conf.Registers.Registers {
-		if !freshNames[name] {
+		if !freshNames[name] && !markedNames[name] {
 			delete(conf.Registers.Registers, label)
 		}
 	}
+	return conf
 }
 
-func normaliseFreshNames(conf Configuration) {
+func normaliseFreshNames(conf Configuration) Configuration {
 	fni := 1
 	genFn := func(usedNames map[string]bool) string {
 		fn := fnPrefix + strconv.Itoa(fni)
@@ -65,11 +79,12 @@ func normaliseFreshNames(conf Configuration) {
 		usedNames[name] = true
 	}
 
+	conf.Registers = conf.Registers.copy()
 	for _, label := range labels {
 		name := conf.Registers.GetName(label)
 		if string(name[0]) == bnPrefix {
 			fn := genFn(usedNames)
-			subName(conf.Process, Name{
+			conf.Process = subName(conf.Process, Name{
 				Name: name,
 			}, Name{
 				Name: fn,
@@ -77,9 +92,10 @@ func normaliseFreshNames(conf Configuration) {
 			conf.Registers.Registers[label] = fn
 		}
 	}
+	return conf
 }
 
-func normaliseBoundNames(conf Configuration) {
+func normaliseBoundNames(conf Configuration) Configuration {
 	bni := 1
 	oldNames := make(map[string]string)
 
@@ -93,108 +109,209 @@ func normaliseBoundNames(conf Configuration) {
 		return newName
 	}
 
-	var normaliseBn func(elem Element)
-	normaliseBn = func(elem Element) {
+	normaliseName := func(name Name) Name {
+		return subCipher(name, func(name Name) Name {
+			if name.Type == Bound {
+				name.Name = genBn(name.Name)
+			}
+			return name
+		})
+	}
+
+	var normaliseBn func(elem Element) Element
+	normaliseBn = func(elem Element) Element {
 		elemTyp := elem.Type()
 		switch elemTyp {
 		case ElemTypNil:
 		case ElemTypOutput:
 			outElem := elem.(*ElemOutput)
-			if outElem.Channel.Type == Bound {
-				outElem.Channel.Name = genBn(outElem.Channel.Name)
-			}
-			if outElem.Output.Type == Bound {
-				outElem.Output.Name = genBn(outElem.Output.Name)
+			channel := normaliseName(outElem.Channel)
+			output := normaliseName(outElem.Output)
+			return &ElemOutput{
+				Channel: channel,
+				Output:  output,
+				Next:    normaliseBn(outElem.Next),
 			}
-			normaliseBn(outElem.Next)
 		case ElemTypInput:
 			inpElem := elem.(*ElemInput)
-			if inpElem.Channel.Type == Bound {
-				inpElem.Channel.Name = genBn(inpElem.Channel.Name)
+			channel := normaliseName(inpElem.Channel)
+			input := normaliseName(inpElem.Input)
+			return &ElemInput{
+				Channel: channel,
+				Input:   input,
+				Sort:    inpElem.Sort,
+				Next:    normaliseBn(inpElem.Next),
 			}
-			if inpElem.Input.Type == Bound {
-				inpElem.Input.Name = genBn(inpElem.Input.Name)
-			}
-			normaliseBn(inpElem.Next)
 		case ElemTypMatch:
 			matchElem := elem.(*ElemEquality)
-			if matchElem.NameL.Type == Bound {
-				matchElem.NameL.Name = genBn(matchElem.NameL.Name)
+			nameL := normaliseName(matchElem.NameL)
+			nameR := normaliseName(matchElem.NameR)
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Next:       normaliseBn(matchElem.Next),
+			}
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			return &ElemGuard{
+				Guard: subGuard(guardElem.Guard, normaliseName),
+				Next:  normaliseBn(guardElem.Next),
 			}
-			if matchElem.NameR.Type == Bound {
-				matchElem.NameR.Name = genBn(matchElem.NameR.Name)
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			return &ElemLet{
+				Var:  normaliseName(letElem.Var),
+				Expr: subExpr(letElem.Expr, normaliseName),
+				Next: normaliseBn(letElem.Next),
+			}
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			nameL := normaliseName(ifElem.NameL)
+			nameR := normaliseName(ifElem.NameR)
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+				Then:       normaliseBn(ifElem.Then),
+				Else:       normaliseBn(ifElem.Else),
 			}
-			normaliseBn(matchElem.Next)
 		case ElemTypRestriction:
 			resElem := elem.(*ElemRestriction)
-			normaliseBn(resElem.Next)
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     normaliseBn(resElem.Next),
+			}
 		case ElemTypSum:
 			sumElem := elem.(*ElemSum)
-			normaliseBn(sumElem.ProcessL)
-			normaliseBn(sumElem.ProcessR)
+			procL := normaliseBn(sumElem.ProcessL)
+			procR := normaliseBn(sumElem.ProcessR)
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
 		case ElemTypParallel:
 			parElem := elem.(*ElemParallel)
-			normaliseBn(parElem.ProcessL)
-			normaliseBn(parElem.ProcessR)
+			procL := normaliseBn(parElem.ProcessL)
+			procR := normaliseBn(parElem.ProcessR)
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
 		case ElemTypProcess:
 			procElem := elem.(*ElemProcess)
+			params := make([]Name, len(procElem.Parameters))
 			for i, param := range procElem.Parameters {
-				if param.Type == Bound {
-					procElem.Parameters[i].Name = genBn(param.Name)
-				}
+				params[i] = normaliseName(param)
+			}
+			return &ElemProcess{
+				Name:       procElem.Name,
+				Parameters: params,
 			}
 		case ElemTypRoot:
 			rootElem := elem.(*ElemRoot)
-			normaliseBn(rootElem.Next)
+			return &ElemRoot{
+				Next: normaliseBn(rootElem.Next),
+			}
 		}
+		return elem
 	}
 
-	var normaliseBnRes func(elem Element)
-	normaliseBnRes = func(elem Element) {
+	var normaliseBnRes func(elem Element) Element
+	normaliseBnRes = func(elem Element) Element {
 		elemTyp := elem.Type()
 		switch elemTyp {
 		case ElemTypNil:
 		case ElemTypOutput:
 			outElem := elem.(*ElemOutput)
-			normaliseBnRes(outElem.Next)
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    normaliseBnRes(outElem.Next),
+			}
 		case ElemTypInput:
 			inpElem := elem.(*ElemInput)
-			normaliseBnRes(inpElem.Next)
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    normaliseBnRes(inpElem.Next),
+			}
 		case ElemTypMatch:
 			matchElem := elem.(*ElemEquality)
-			normaliseBnRes(matchElem.Next)
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       normaliseBnRes(matchElem.Next),
+			}
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  normaliseBnRes(guardElem.Next),
+			}
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: normaliseBnRes(letElem.Next),
+			}
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       normaliseBnRes(ifElem.Then),
+				Else:       normaliseBnRes(ifElem.Else),
+			}
 		case ElemTypRestriction:
 			resElem := elem.(*ElemRestriction)
-			if resElem.Restrict.Type == Bound {
-				resElem.Restrict.Name = genBn(resElem.Restrict.Name)
+			return &ElemRestriction{
+				Restrict: normaliseName(resElem.Restrict),
+				Next:     normaliseBnRes(resElem.Next),
 			}
-			normaliseBnRes(resElem.Next)
 		case ElemTypSum:
 			sumElem := elem.(*ElemSum)
-			normaliseBnRes(sumElem.ProcessL)
-			normaliseBnRes(sumElem.ProcessR)
+			procL := normaliseBnRes(sumElem.ProcessL)
+			procR := normaliseBnRes(sumElem.ProcessR)
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
 		case ElemTypParallel:
 			parElem := elem.(*ElemParallel)
-			normaliseBnRes(parElem.ProcessL)
-			normaliseBnRes(parElem.ProcessR)
+			procL := normaliseBnRes(parElem.ProcessL)
+			procR := normaliseBnRes(parElem.ProcessR)
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
 		case ElemTypProcess:
 		case ElemTypRoot:
 			rootElem := elem.(*ElemRoot)
-			normaliseBnRes(rootElem.Next)
+			return &ElemRoot{
+				Next: normaliseBnRes(rootElem.Next),
+			}
 		}
+		return elem
 	}
 
 	// Rename bound names, skipping restrictions.
-	normaliseBn(conf.Process)
+	conf.Process = normaliseBn(conf.Process)
 	// Rename bound names in restrictions.
-	normaliseBnRes(conf.Process)
+	conf.Process = normaliseBnRes(conf.Process)
 
 	// Rename bound names in register.
+	conf.Registers = conf.Registers.copy()
 	for label, name := range conf.Registers.Registers {
 		if newName, ok := oldNames[name]; ok {
 			conf.Registers.Registers[label] = newName
 		}
 	}
+	return conf
 }
 
 func normaliseNilProc(elem Element) Element {
@@ -203,36 +320,117 @@ func normaliseNilProc(elem Element) Element {
 	case ElemTypProcess:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		outElem.Next = normaliseNilProc(outElem.Next)
+		next := normaliseNilProc(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		inpElem.Next = normaliseNilProc(inpElem.Next)
+		next := normaliseNilProc(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		matchElem.Next = normaliseNilProc(matchElem.Next)
+		next := normaliseNilProc(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := normaliseNilProc(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next := normaliseNilProc(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := normaliseNilProc(ifElem.Then)
+		procElse := normaliseNilProc(ifElem.Else)
+		if procThen.Type() == ElemTypNil && procElse.Type() == ElemTypNil {
+			return &ElemNil{}
+		}
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
-		resElem.Next = normaliseNilProc(resElem.Next)
-		if resElem.Next.Type() == ElemTypNil {
+		next := normaliseNilProc(resElem.Next)
+		if next.Type() == ElemTypNil {
 			return &ElemNil{}
 		}
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		sumElem.ProcessL = normaliseNilProc(sumElem.ProcessL)
-		sumElem.ProcessR = normaliseNilProc(sumElem.ProcessR)
+		procL := normaliseNilProc(sumElem.ProcessL)
+		procR := normaliseNilProc(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		parElem.ProcessL = normaliseNilProc(parElem.ProcessL)
-		parElem.ProcessR = normaliseNilProc(parElem.ProcessR)
-		if parElem.ProcessL.Type() == ElemTypNil {
-			return parElem.ProcessR
+		procL := normaliseNilProc(parElem.ProcessL)
+		procR := normaliseNilProc(parElem.ProcessR)
+		if procL.Type() == ElemTypNil {
+			return procR
 		}
-		if parElem.ProcessR.Type() == ElemTypNil {
-			return parElem.ProcessL
+		if procR.Type() == ElemTypNil {
+			return procL
+		}
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
 		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		rootElem.Next = normaliseNilProc(rootElem.Next)
+		next := normaliseNilProc(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
 	return elem
 }
@@ -243,30 +441,108 @@ func rmRes(elem Element) Element {
 	case ElemTypProcess:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		outElem.Next = rmRes(outElem.Next)
+		next := rmRes(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		inpElem.Next = rmRes(inpElem.Next)
+		next := rmRes(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		matchElem.Next = rmRes(matchElem.Next)
+		next := rmRes(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := rmRes(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next := rmRes(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := rmRes(ifElem.Then)
+		procElse := rmRes(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
-		resElem.Next = rmRes(resElem.Next)
-		if !appearsIn(resElem.Next, resElem.Restrict) {
-			return resElem.Next
+		next := rmRes(resElem.Next)
+		if !appearsIn(next, resElem.Restrict) {
+			return next
+		}
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
 		}
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		sumElem.ProcessL = rmRes(sumElem.ProcessL)
-		sumElem.ProcessR = rmRes(sumElem.ProcessR)
+		procL := rmRes(sumElem.ProcessL)
+		procR := rmRes(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		parElem.ProcessL = rmRes(parElem.ProcessL)
-		parElem.ProcessR = rmRes(parElem.ProcessR)
+		procL := rmRes(parElem.ProcessL)
+		procR := rmRes(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		rootElem.Next = rmRes(rootElem.Next)
+		next := rmRes(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
 	return elem
 }
@@ -277,88 +553,170 @@ func scopeRes(elem Element) Element {
 	case ElemTypProcess:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		outElem.Next = scopeRes(outElem.Next)
+		next := scopeRes(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		inpElem.Next = scopeRes(inpElem.Next)
+		next := scopeRes(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		matchElem.Next = scopeRes(matchElem.Next)
+		next := scopeRes(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := scopeRes(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next := scopeRes(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := scopeRes(ifElem.Then)
+		procElse := scopeRes(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
 		resName := resElem.Restrict
-		resElem.Next = scopeRes(resElem.Next)
-		switch resElem.Next.Type() {
+		next := scopeRes(resElem.Next)
+		switch next.Type() {
 		case ElemTypParallel:
-			parElem := resElem.Next.(*ElemParallel)
+			parElem := next.(*ElemParallel)
 			appearsLeft := appearsIn(parElem.ProcessL, resName)
 			appearsRight := appearsIn(parElem.ProcessR, resName)
 			if !appearsLeft && !appearsRight {
-				parElem.ProcessL = scopeRes(parElem.ProcessL)
-				parElem.ProcessR = scopeRes(parElem.ProcessR)
-				return parElem
+				return &ElemParallel{
+					ProcessL: scopeRes(parElem.ProcessL),
+					ProcessR: scopeRes(parElem.ProcessR),
+				}
 			}
 			if appearsLeft && appearsRight {
-				resElem.Next = scopeRes(resElem.Next)
-				return resElem
+				next = scopeRes(next)
 			}
 			if !appearsLeft && appearsRight {
-				parElem.ProcessR = &ElemRestriction{
-					Restrict: resName,
-					Next:     parElem.ProcessR,
+				return &ElemParallel{
+					ProcessL: parElem.ProcessL,
+					ProcessR: scopeRes(&ElemRestriction{
+						Restrict: resName,
+						Next:     parElem.ProcessR,
+					}),
 				}
-				parElem.ProcessR = scopeRes(parElem.ProcessR)
-				return parElem
 			}
 			if appearsLeft && !appearsRight {
-				parElem.ProcessL = &ElemRestriction{
-					Restrict: resName,
-					Next:     parElem.ProcessL,
+				return &ElemParallel{
+					ProcessL: scopeRes(&ElemRestriction{
+						Restrict: resName,
+						Next:     parElem.ProcessL,
+					}),
+					ProcessR: parElem.ProcessR,
 				}
-				parElem.ProcessL = scopeRes(parElem.ProcessL)
-				return parElem
 			}
 		case ElemTypSum:
-			sumElem := resElem.Next.(*ElemSum)
+			sumElem := next.(*ElemSum)
 			appearsLeft := appearsIn(sumElem.ProcessL, resName)
 			appearsRight := appearsIn(sumElem.ProcessR, resName)
 			if !appearsLeft && !appearsRight {
-				sumElem.ProcessL = scopeRes(sumElem.ProcessL)
-				sumElem.ProcessR = scopeRes(sumElem.ProcessR)
-				return sumElem
+				return &ElemSum{
+					ProcessL: scopeRes(sumElem.ProcessL),
+					ProcessR: scopeRes(sumElem.ProcessR),
+				}
 			}
 			if appearsLeft && appearsRight {
-				resElem.Next = scopeRes(resElem.Next)
-				return resElem
+				next = scopeRes(next)
 			}
 			if !appearsLeft && appearsRight {
-				sumElem.ProcessR = &ElemRestriction{
-					Restrict: resName,
-					Next:     sumElem.ProcessR,
+				return &ElemSum{
+					ProcessL: sumElem.ProcessL,
+					ProcessR: scopeRes(&ElemRestriction{
+						Restrict: resName,
+						Next:     sumElem.ProcessR,
+					}),
 				}
-				sumElem.ProcessR = scopeRes(sumElem.ProcessR)
-				return sumElem
 			}
 			if appearsLeft && !appearsRight {
-				sumElem.ProcessL = &ElemRestriction{
-					Restrict: resName,
-					Next:     sumElem.ProcessL,
+				return &ElemSum{
+					ProcessL: scopeRes(&ElemRestriction{
+						Restrict: resName,
+						Next:     sumElem.ProcessL,
+					}),
+					ProcessR: sumElem.ProcessR,
 				}
-				sumElem.ProcessL = scopeRes(sumElem.ProcessL)
-				return sumElem
+			}
+		}
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resName,
+				Next:     next,
 			}
 		}
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		sumElem.ProcessL = scopeRes(sumElem.ProcessL)
-		sumElem.ProcessR = scopeRes(sumElem.ProcessR)
+		procL := scopeRes(sumElem.ProcessL)
+		procR := scopeRes(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		parElem.ProcessL = scopeRes(parElem.ProcessL)
-		parElem.ProcessR = scopeRes(parElem.ProcessR)
+		procL := scopeRes(parElem.ProcessL)
+		procR := scopeRes(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		rootElem.Next = scopeRes(rootElem.Next)
+		next := scopeRes(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
 	return elem
 }
@@ -370,40 +728,69 @@ func appearsIn(elem Element, name Name) bool {
 	case ElemTypProcess:
 		procElem := elem.(*ElemProcess)
 		for _, param := range procElem.Parameters {
-			if param == name {
+			if containsName(param, name) {
 				return true
 			}
 		}
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		if outElem.Channel == name {
+		if containsName(outElem.Channel, name) {
 			return true
 		}
-		if outElem.Output == name {
+		if containsName(outElem.Output, name) {
 			return true
 		}
 		return appearsIn(outElem.Next, name)
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		if inpElem.Channel == name {
+		if containsName(inpElem.Channel, name) {
 			return true
 		}
-		if inpElem.Input == name {
+		if containsName(inpElem.Input, name) {
 			return true
 		}
 		return appearsIn(inpElem.Next, name)
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		if matchElem.NameL == name {
+		if containsName(matchElem.NameL, name) {
 			return true
 		}
-		if matchElem.NameR == name {
+		if containsName(matchElem.NameR, name) {
 			return true
 		}
 		return appearsIn(matchElem.Next, name)
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		for _, guardName := range getGuardNames(guardElem.Guard) {
+			if containsName(guardName, name) {
+				return true
+			}
+		}
+		return appearsIn(guardElem.Next, name)
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		if containsName(letElem.Var, name) {
+			return true
+		}
+		for _, exprName := range getExprNames(letElem.Expr) {
+			if containsName(exprName, name) {
+				return true
+			}
+		}
+		return appearsIn(letElem.Next, name)
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		if containsName(ifElem.NameL, name) {
+			return true
+		}
+		if containsName(ifElem.NameR, name) {
+			return true
+		}
+		appears := appearsIn(ifElem.Then, name)
+		return appears || appearsIn(ifElem.Else, name)
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
-		if resElem.Restrict == name {
+		if containsName(resElem.Restrict, name) {
 			return true
 		}
 		return appearsIn(resElem.Next, name)
@@ -428,43 +815,109 @@ func sortRes(elem Element) Element {
 	case ElemTypProcess:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		outElem.Next = sortRes(outElem.Next)
+		next := sortRes(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		inpElem.Next = sortRes(inpElem.Next)
+		next := sortRes(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		matchElem.Next = sortRes(matchElem.Next)
+		next := sortRes(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := sortRes(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next := sortRes(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := sortRes(ifElem.Then)
+		procElse := sortRes(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
-		resElem := elem.(*ElemRestriction)
-		resNames, lastElem := getRes(resElem, []Name{})
+		resNames, lastElem := getRes(elem, []Name{})
 		sort.Slice(resNames, func(i, j int) bool {
 			return resNames[i].Name < resNames[j].Name
 		})
-		head := &ElemRestriction{
-			Restrict: resNames[0],
-		}
-		prev := head
-		for i := 1; i < len(resNames); i++ {
-			cur := &ElemRestriction{
+		var head Element = sortRes(lastElem)
+		for i := len(resNames) - 1; i >= 0; i-- {
+			head = &ElemRestriction{
 				Restrict: resNames[i],
+				Next:     head,
 			}
-			prev.Next = cur
-			prev = cur
 		}
-		prev.Next = sortRes(lastElem)
 		return head
 	case ElemTypSum:
 		sumElem := elem.(*ElemSum)
-		sumElem.ProcessL = sortRes(sumElem.ProcessL)
-		sumElem.ProcessR = sortRes(sumElem.ProcessR)
+		procL := sortRes(sumElem.ProcessL)
+		procR := sortRes(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypParallel:
 		parElem := elem.(*ElemParallel)
-		parElem.ProcessL = sortRes(parElem.ProcessL)
-		parElem.ProcessR = sortRes(parElem.ProcessR)
+		procL := sortRes(parElem.ProcessL)
+		procR := sortRes(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		rootElem.Next = sortRes(rootElem.Next)
+		next := sortRes(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
 	return elem
 }
@@ -483,88 +936,129 @@ func sortSumPar(elem Element) Element {
 	case ElemTypProcess:
 	case ElemTypOutput:
 		outElem := elem.(*ElemOutput)
-		outElem.Next = sortSumPar(outElem.Next)
+		next := sortSumPar(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
-		inpElem.Next = sortSumPar(inpElem.Next)
+		next := sortSumPar(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
-		matchElem.Next = sortSumPar(matchElem.Next)
+		next := sortSumPar(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := sortSumPar(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		next := sortSumPar(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := sortSumPar(ifElem.Then)
+		procElse := sortSumPar(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
-		resElem.Next = sortSumPar(resElem.Next)
+		next := sortSumPar(resElem.Next)
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
 	case ElemTypSum:
-		sumElem := elem.(*ElemSum)
-		sumChildren := getSum(sumElem)
+		sumChildren := getSum(elem)
 		for i, child := range sumChildren {
 			sumChildren[i] = sortSumPar(child)
 		}
-		procs := []struct {
-			Rank    string
-			Process Element
-		}{}
-		for _, child := range sumChildren {
-			procs = append(procs, struct {
-				Rank    string
-				Process Element
-			}{PrettyPrintAst(child), child})
-		}
-		sort.Slice(procs, func(i, j int) bool {
-			return procs[i].Rank < procs[j].Rank
-		})
-		head := &ElemSum{
-			ProcessL: procs[0].Process,
-		}
-		prev := head
-		for i := 1; i < len(procs)-1; i++ {
-			cur := &ElemSum{
-				ProcessL: procs[i].Process,
+		sortByRank(sumChildren)
+		var head Element = sumChildren[len(sumChildren)-1]
+		for i := len(sumChildren) - 2; i >= 0; i-- {
+			head = &ElemSum{
+				ProcessL: sumChildren[i],
+				ProcessR: head,
 			}
-			prev.ProcessR = cur
-			prev = cur
 		}
-		prev.ProcessR = procs[len(procs)-1].Process
 		return head
 	case ElemTypParallel:
-		parElem := elem.(*ElemParallel)
-		parChildren := getPar(parElem)
+		// Size of parChildren is minimum of 2.
+		parChildren := getPar(elem)
 		for i, child := range parChildren {
 			parChildren[i] = sortSumPar(child)
 		}
-		// Size of procs is minimum of 2.
-		procs := []struct {
-			Rank    string
-			Process Element
-		}{}
-		for _, child := range parChildren {
-			procs = append(procs, struct {
-				Rank    string
-				Process Element
-			}{PrettyPrintAst(child), child})
-		}
-		sort.Slice(procs, func(i, j int) bool {
-			return procs[i].Rank < procs[j].Rank
-		})
-		head := &ElemParallel{
-			ProcessL: procs[0].Process,
-		}
-		prev := head
-		for i := 1; i < len(procs)-1; i++ {
-			cur := &ElemParallel{
-				ProcessL: procs[i].Process,
+		sortByRank(parChildren)
+		var head Element = parChildren[len(parChildren)-1]
+		for i := len(parChildren) - 2; i >= 0; i-- {
+			head = &ElemParallel{
+				ProcessL: parChildren[i],
+				ProcessR: head,
 			}
-			prev.ProcessR = cur
-			prev = cur
 		}
-		prev.ProcessR = procs[len(procs)-1].Process
 		return head
 	case ElemTypRoot:
 		rootElem := elem.(*ElemRoot)
-		rootElem.Next = sortSumPar(rootElem.Next)
+		next := sortSumPar(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
 	}
 	return elem
 }
 
+// sortByRank sorts the processes by their pretty-printed form.
+func sortByRank(elems []Element) {
+	ranks := make(map[Element]string)
+	for _, elem := range elems {
+		ranks[elem] = PrettyPrintAst(elem)
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		return ranks[elems[i]] < ranks[elems[j]]
+	})
+}
+
 func getPar(elem Element) []Element {
 	var parChildren []Element
 	if elem.Type() == ElemTypParallel {
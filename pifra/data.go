@@ -0,0 +1,411 @@
+package pifra
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Data values are names of type Data, whose name is the literal of the
+// value, i.e. "true", "false" or a decimal integer. They are substituted
+// into the process like names, but are not free names, so they are never
+// stored in the registers and are left unchanged by the normalisation and
+// the garbage collection of the registers.
+
+// Error of a call of a process constant with an argument not of the sort of
+// its parameter, e.g. a value out of the range of an integer sort, which
+// stops the exploration rather than the call deadlocking.
+var sortError error
+
+type SortType int
+
+const (
+	// Names, or data if the sort is not annotated.
+	SortAny SortType = iota
+	SortBool
+	SortInt
+	// Channels, whose sort is only checked before the exploration.
+	SortChannel
+)
+
+// Sort is the sort of a parameter or an input. An integer sort is the range
+// Min..Max.
+type Sort struct {
+	Type    SortType
+	Min     int
+	Max     int
+	Channel *ChannelSort
+}
+
+// ChannelSort is the sort ch<s1,...,sn> of the channels carrying objects of
+// the sorts s1, ..., sn.
+type ChannelSort struct {
+	Objects []Sort
+}
+
+// isData reports whether the sort is a data sort.
+func (s Sort) isData() bool {
+	return s.Type == SortBool || s.Type == SortInt
+}
+
+// values returns the values of a data sort in order.
+func (s Sort) values() []Name {
+	var values []Name
+	switch s.Type {
+	case SortBool:
+		values = append(values, newBoolValue(false), newBoolValue(true))
+	case SortInt:
+		for i := s.Min; i <= s.Max; i++ {
+			values = append(values, newIntValue(i))
+		}
+	}
+	return values
+}
+
+// contains reports whether the name is of the sort.
+func (s Sort) contains(name Name) bool {
+	switch s.Type {
+	case SortBool:
+		_, ok := getBoolValue(name)
+		return ok
+	case SortInt:
+		i, ok := getIntValue(name)
+		return ok && i >= s.Min && i <= s.Max
+	case SortChannel:
+		return name.Type != Data
+	}
+	return true
+}
+
+func (s Sort) String() string {
+	switch s.Type {
+	case SortBool:
+		return "bool"
+	case SortInt:
+		return strconv.Itoa(s.Min) + ".." + strconv.Itoa(s.Max)
+	case SortChannel:
+		var objects []string
+		for _, object := range s.Channel.Objects {
+			objects = append(objects, object.String())
+		}
+		return "ch<" + strings.Join(objects, ",") + ">"
+	}
+	return ""
+}
+
+func newBoolValue(b bool) Name {
+	return Name{
+		Name: strconv.FormatBool(b),
+		Type: Data,
+	}
+}
+
+func newIntValue(i int) Name {
+	return Name{
+		Name: strconv.Itoa(i),
+		Type: Data,
+	}
+}
+
+// newIntLiteral returns the value of a numeral.
+func newIntLiteral(numeral string) Name {
+	i, _ := strconv.Atoi(numeral)
+	return newIntValue(i)
+}
+
+func getBoolValue(name Name) (bool, bool) {
+	if name.Type != Data || (name.Name != "true" && name.Name != "false") {
+		return false, false
+	}
+	return name.Name == "true", true
+}
+
+func getIntValue(name Name) (int, bool) {
+	if name.Type != Data {
+		return 0, false
+	}
+	i, err := strconv.Atoi(name.Name)
+	return i, err == nil
+}
+
+type ExprType int
+
+const (
+	ExprName ExprType = iota
+	ExprAdd
+	ExprSub
+	ExprEnc
+	ExprDec
+)
+
+// Expr is an expression of a let. An ExprName is a name or a data value, an
+// ExprAdd or an ExprSub is the sum or the difference of the integers of ExprL
+// and ExprR, and an ExprEnc or an ExprDec is the encryption or the decryption
+// of ExprL with the key ExprR. Expressions are immutable like elements.
+type Expr struct {
+	Type  ExprType
+	Name  Name
+	ExprL *Expr
+	ExprR *Expr
+}
+
+// eval returns the value of the expression, or false if its operands are
+// not integers, or a decrypted name is not a ciphertext of the key.
+func (e *Expr) eval() (Name, bool) {
+	if e.Type == ExprName {
+		return e.Name, true
+	}
+	valueL, okL := e.ExprL.eval()
+	valueR, okR := e.ExprR.eval()
+	if !okL || !okR {
+		return Name{}, false
+	}
+	switch e.Type {
+	case ExprEnc:
+		return newCiphertext(valueL, valueR), true
+	case ExprDec:
+		return decrypt(valueL, valueR)
+	}
+	l, okL := getIntValue(valueL)
+	r, okR := getIntValue(valueR)
+	if !okL || !okR {
+		return Name{}, false
+	}
+	if e.Type == ExprAdd {
+		return newIntValue(l + r), true
+	}
+	return newIntValue(l - r), true
+}
+
+// isDataExpr reports whether the expression is an integer expression over
+// data values, whose value does not depend on the state.
+func isDataExpr(e *Expr) bool {
+	switch e.Type {
+	case ExprName:
+		return e.Name.Type == Data
+	case ExprAdd, ExprSub:
+		return isDataExpr(e.ExprL) && isDataExpr(e.ExprR)
+	}
+	return false
+}
+
+// evalDataLets returns the process with the lets of data expressions
+// evaluated, so that the data values of a state are canonical, e.g.
+// "let x = 0+1 in P(x)" is "P(1)".
+func evalDataLets(elem Element) Element {
+	switch elem.Type() {
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		next := evalDataLets(outElem.Next)
+		if next != outElem.Next {
+			return &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		next := evalDataLets(inpElem.Next)
+		if next != inpElem.Next {
+			return &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		next := evalDataLets(matchElem.Next)
+		if next != matchElem.Next {
+			return &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next := evalDataLets(guardElem.Next)
+		if next != guardElem.Next {
+			return &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		if isDataExpr(letElem.Expr) {
+			if value, ok := letElem.Expr.eval(); ok {
+				return evalDataLets(substituteName(letElem.Next, letElem.Var, value))
+			}
+		}
+		next := evalDataLets(letElem.Next)
+		if next != letElem.Next {
+			return &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := evalDataLets(ifElem.Then)
+		procElse := evalDataLets(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			return &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		next := evalDataLets(resElem.Next)
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		procL := evalDataLets(sumElem.ProcessL)
+		procR := evalDataLets(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			return &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL := evalDataLets(parElem.ProcessL)
+		procR := evalDataLets(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		next := evalDataLets(rootElem.Next)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
+	}
+	return elem
+}
+
+// subExpr returns the expression with every name substituted. Expressions
+// without a substituted name are shared with the original.
+func subExpr(e *Expr, sub func(Name) Name) *Expr {
+	if e.Type == ExprName {
+		if name := sub(e.Name); name != e.Name {
+			return &Expr{
+				Name: name,
+			}
+		}
+		return e
+	}
+	exprL := subExpr(e.ExprL, sub)
+	exprR := subExpr(e.ExprR, sub)
+	if exprL != e.ExprL || exprR != e.ExprR {
+		return &Expr{
+			Type:  e.Type,
+			ExprL: exprL,
+			ExprR: exprR,
+		}
+	}
+	return e
+}
+
+// getExprNames returns the names of the expression in pretty-printed order.
+func getExprNames(e *Expr) []Name {
+	if e.Type == ExprName {
+		return []Name{e.Name}
+	}
+	return append(getExprNames(e.ExprL), getExprNames(e.ExprR)...)
+}
+
+// equalExprs reports whether two expressions are structurally equal.
+func equalExprs(a *Expr, b *Expr) bool {
+	if a == b {
+		return true
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Type == ExprName {
+		return equalNames(a.Name, b.Name)
+	}
+	return equalExprs(a.ExprL, b.ExprL) && equalExprs(a.ExprR, b.ExprR)
+}
+
+// prettyPrintExpr returns the expression in the syntax of the parser.
+// Operators are left-associative, so the right operands are names.
+func prettyPrintExpr(e *Expr) string {
+	switch e.Type {
+	case ExprAdd:
+		return prettyPrintExpr(e.ExprL) + "+" + prettyPrintExpr(e.ExprR)
+	case ExprSub:
+		return prettyPrintExpr(e.ExprL) + "-" + prettyPrintExpr(e.ExprR)
+	case ExprEnc:
+		return "enc(" + prettyPrintExpr(e.ExprL) + "," + prettyPrintExpr(e.ExprR) + ")"
+	case ExprDec:
+		return "dec(" + prettyPrintExpr(e.ExprL) + "," + prettyPrintExpr(e.ExprR) + ")"
+	}
+	return e.Name.Name
+}
+
+func prettyPrintTexExpr(e *Expr) string {
+	switch e.Type {
+	case ExprAdd:
+		return prettyPrintTexExpr(e.ExprL) + " + " + prettyPrintTexExpr(e.ExprR)
+	case ExprSub:
+		return prettyPrintTexExpr(e.ExprL) + " - " + prettyPrintTexExpr(e.ExprR)
+	case ExprEnc:
+		return `\mathsf{enc}(` + prettyPrintTexExpr(e.ExprL) + `, ` + prettyPrintTexExpr(e.ExprR) + `)`
+	case ExprDec:
+		return `\mathsf{dec}(` + prettyPrintTexExpr(e.ExprL) + `, ` + prettyPrintTexExpr(e.ExprR) + `)`
+	}
+	return getTexName(e.Name.Name)
+}
+
+// getDataSymbol returns the symbol of a data value in a label.
+func getDataSymbol(value Name) Symbol {
+	if b, ok := getBoolValue(value); ok {
+		symbol := Symbol{
+			Type: SymbolTypBool,
+		}
+		if b {
+			symbol.Value = 1
+		}
+		return symbol
+	}
+	i, _ := getIntValue(value)
+	return Symbol{
+		Type:  SymbolTypInt,
+		Value: i,
+	}
+}
+
+// isDataSymbol reports whether the symbol is a data value rather than a
+// register label.
+func isDataSymbol(symbol Symbol) bool {
+	return symbol.Type == SymbolTypBool || symbol.Type == SymbolTypInt
+}
+
+// prettyPrintDataSymbol returns the literal of the data value of a symbol.
+func prettyPrintDataSymbol(symbol Symbol) string {
+	if symbol.Type == SymbolTypBool {
+		return strconv.FormatBool(symbol.Value == 1)
+	}
+	return strconv.Itoa(symbol.Value)
+}
@@ -0,0 +1,169 @@
+package pifra
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSortValues(t *testing.T) {
+	tests := map[string]struct {
+		sort   Sort
+		values []Name
+	}{
+		"bool": {
+			sort:   Sort{Type: SortBool},
+			values: []Name{newBoolValue(false), newBoolValue(true)},
+		},
+		"int": {
+			sort:   Sort{Type: SortInt, Min: 1, Max: 3},
+			values: []Name{newIntValue(1), newIntValue(2), newIntValue(3)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			values := tc.sort.values()
+			if !reflect.DeepEqual(values, tc.values) {
+				t.Errorf("values: %v, expected: %v", values, tc.values)
+			}
+			for _, value := range values {
+				if !tc.sort.contains(value) {
+					t.Errorf("%s does not contain %s", tc.sort, value.Name)
+				}
+			}
+			if tc.sort.contains(Name{Name: "a"}) {
+				t.Errorf("%s contains a name", tc.sort)
+			}
+		})
+	}
+}
+
+func TestExprEval(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		expr   *Expr
+		output string
+		ok     bool
+	}{
+		"add_sub": {
+			input:  "1+2-1",
+			output: "2",
+			ok:     true,
+		},
+		// Not parsed, as the sort checker rejects the operands.
+		"name": {
+			expr: &Expr{
+				Type:  ExprAdd,
+				ExprL: &Expr{Name: Name{Name: "a"}},
+				ExprR: &Expr{Name: newIntValue(1)},
+			},
+		},
+		"bool": {
+			expr: &Expr{
+				Type:  ExprAdd,
+				ExprL: &Expr{Name: newBoolValue(true)},
+				ExprR: &Expr{Name: newIntValue(1)},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr := tc.expr
+			if expr == nil {
+				proc, err := InitProgram([]byte("let x = " + tc.input + " in 0"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				expr = proc.(*ElemRoot).Next.(*ElemLet).Expr
+			}
+			value, ok := expr.eval()
+			if ok != tc.ok || value.Name != tc.output {
+				t.Errorf("value: %s %t, expected: %s %t", value.Name, ok, tc.output, tc.ok)
+			}
+		})
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		err   string
+	}{
+		"input_parameters": {
+			input: "a(x, y).0",
+			err:   "line 1: input on a has 2 parameters",
+		},
+		"data_parameter": {
+			input: "P(x, 1) = 0\nP(a, b)",
+			err:   "line 1: parameter 1 is not a name",
+		},
+		"argument_sort": {
+			input: "P(x) = 0\nP(a: bool)",
+			err:   "line 2: argument a of process P has a sort",
+		},
+		"empty_sort": {
+			input: "a(x: 2..1).0",
+			err:   "line 1: sort 2..1 is empty",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := InitProgram([]byte(tc.input))
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("error: %v, expected: %s", err, tc.err)
+			}
+		})
+	}
+}
+
+// The lets of data expressions are evaluated in the states, so that states
+// equal up to the evaluation are identified.
+func TestEvalDataLets(t *testing.T) {
+	input := []byte(`
+P(n: 0..2, c) = ([n<2]c'<n>.P(n+1, c)) + c'<n>.P(1, c)
+P(0, c)
+`)
+	output := `s0 = {(1,#1)} |- P(0, #1)
+s0  1'=0   s1 = {(1,#1)} |- P(1, #1)
+s1  1'=1   s2 = {(1,#1)} |- P(2, #1)
+s1  1'=1   s1 = {(1,#1)} |- P(1, #1)
+s2  1'=2   s1 = {(1,#1)} |- P(1, #1)`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+// A call with a value out of the sort of its parameter stops the
+// exploration with an error rather than deadlocking.
+func TestSortRangeError(t *testing.T) {
+	input := []byte(`
+P(n: 0..2, c) = c'<n>.P(n+1, c)
+P(0, c)
+`)
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	_, err := GenerateLts(context.Background(), input, flags)
+	expected := "s3: P(3, #1): 3 is not of the sort 0..2 of the parameter n"
+	if err == nil || err.Error() != expected {
+		t.Errorf("error: %v, expected: %s", err, expected)
+	}
+}
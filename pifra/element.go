@@ -11,6 +11,9 @@ const (
 	ElemTypSum
 	ElemTypParallel
 	ElemTypProcess
+	ElemTypIf
+	ElemTypGuard
+	ElemTypLet
 
 	ElemTypRoot
 )
@@ -20,13 +23,22 @@ type NameType int
 const (
 	Free NameType = iota
 	Bound
+	// A data value, i.e. a boolean or an integer.
+	Data
+	// A ciphertext, i.e. a term-valued name.
+	Ciphertext
 )
 
 type Name struct {
 	Name string
 	Type NameType
+	// Structure of a ciphertext.
+	Cipher *Cipher
 }
 
+// Element is a node of the process AST. Elements are treated as immutable once
+// constructed so that configurations can share unchanged subtrees; functions
+// transforming the AST return new elements instead of modifying them.
 type Element interface {
 	Type() ElementType
 }
@@ -47,9 +59,12 @@ func (e *ElemOutput) Type() ElementType {
 	return ElemTypOutput
 }
 
+// ElemInput is the input a(x).P, or the input a(x: s).P of a value of the
+// data sort s.
 type ElemInput struct {
 	Channel Name
 	Input   Name
+	Sort    Sort
 	Next    Element
 }
 
@@ -68,6 +83,43 @@ func (e *ElemEquality) Type() ElementType {
 	return ElemTypMatch
 }
 
+// ElemGuard is the match [g]P of a guard combining several comparisons, such
+// as [a=b && c!=d]P. A match of a single comparison is an ElemEquality.
+type ElemGuard struct {
+	Guard *Guard
+	Next  Element
+}
+
+func (e *ElemGuard) Type() ElementType {
+	return ElemTypGuard
+}
+
+// ElemLet is "let x = e in P", which binds x to the value of the expression
+// e in P.
+type ElemLet struct {
+	Var  Name
+	Expr *Expr
+	Next Element
+}
+
+func (e *ElemLet) Type() ElementType {
+	return ElemTypLet
+}
+
+// ElemIf is the conditional "if a=b then P else Q", or "if a!=b then P else
+// Q" if Inequality is set.
+type ElemIf struct {
+	Inequality bool
+	NameL      Name
+	NameR      Name
+	Then       Element
+	Else       Element
+}
+
+func (e *ElemIf) Type() ElementType {
+	return ElemTypIf
+}
+
 type ElemRestriction struct {
 	Restrict Name
 	Next     Element
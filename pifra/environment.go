@@ -0,0 +1,73 @@
+package pifra
+
+import "fmt"
+
+// Free names of the program the environment can use as channels, or nil if
+// the environment can use all the free names. They override the names
+// declared by env.
+var observedNames []string
+
+// Free names of the program which the environment cannot use as channels.
+// They are kept in the registers under their own names, like the marked
+// names, so that they are never confused with the names generated by the
+// exploration once they are garbage collected.
+var hiddenNames map[string]bool
+
+// getObservedNames returns the names the environment can use, or nil if it
+// can use all the free names.
+func getObservedNames() []string {
+	if observedNames != nil {
+		return observedNames
+	}
+	return declaredEnvNames
+}
+
+// checkObservedNames returns an error if a name the environment can use is
+// not free in the program.
+func checkObservedNames(proc Element) error {
+	freeNames := getRootFreeNames(proc)
+	for _, name := range getObservedNames() {
+		if !freeNames[name] {
+			return fmt.Errorf("observed name %s does not occur free in the program", name)
+		}
+	}
+	return nil
+}
+
+// initHiddenNames records the free names of the program which are not
+// observed.
+func initHiddenNames(freeNames map[string]bool) {
+	hiddenNames = nil
+	names := getObservedNames()
+	if names == nil {
+		return
+	}
+	observed := make(map[string]bool)
+	for _, name := range names {
+		observed[name] = true
+	}
+	hiddenNames = make(map[string]bool)
+	for name := range freeNames {
+		if !observed[name] {
+			hiddenNames[name] = true
+		}
+	}
+}
+
+// getEnvironmentTrans returns the transitions of the configuration which are
+// internal or on a channel the environment can use. The transitions on the
+// hidden channels are only possible within the process by COMM and CLOSE.
+func getEnvironmentTrans(conf Configuration, confs []Configuration) []Configuration {
+	if hiddenNames == nil {
+		return confs
+	}
+	var econfs []Configuration
+	for _, tconf := range confs {
+		if (tconf.Label.Symbol.Type == SymbolTypInput || tconf.Label.Symbol.Type == SymbolTypOutput) &&
+			hiddenNames[conf.Registers.GetName(tconf.Label.Symbol.Value)] {
+			continue
+		}
+		econfs = append(econfs, tconf)
+	}
+	return econfs
+}
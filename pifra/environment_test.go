@@ -0,0 +1,115 @@
+package pifra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestObserve(t *testing.T) {
+	tests := map[string]struct {
+		input   []byte
+		observe []string
+		output  string
+	}{
+		"observe_b": {
+			input:   []byte(`a(x).b'<x>.0 | a'<c>.0`),
+			observe: []string{"b"},
+			output: `s0 = {(1,a),(2,#2),(3,c)} |- (a'<c>.0 | a(&1).#2'<&1>.0)
+s0  t     s1 = {(2,#2),(3,c)} |- #2'<c>.0
+s1  2'3   s2 = {} |- 0`,
+		},
+		"observe_none": {
+			input:   []byte(`a(x).b'<x>.0 | a'<c>.0`),
+			observe: []string{},
+			output: `s0 = {(1,a),(2,b),(3,c)} |- (a'<c>.0 | a(&1).b'<&1>.0)
+s0  t     s1 = {(2,b),(3,c)} |- b'<c>.0`,
+		},
+		// The register of the hidden name b is reused by the received
+		// name, which the environment can use.
+		"reused_register": {
+			input:   []byte(`z(x).x'<x>.0 + b(y).0`),
+			observe: []string{"z"},
+			output: `s0 = {(1,b),(2,#2)} |- (#2(&1).&1'<&1>.0 + b(&2).0)
+s0  2 1   s1 = {(1,b)} |- b'<b>.0
+s0  2 2   s2 = {(2,#2)} |- #2'<#2>.0
+s0  2 1*  s3 = {(1,#1)} |- #1'<#1>.0
+s2  2'2   s4 = {} |- 0
+s3  1'1   s4 = {} |- 0`,
+		},
+		"env": {
+			input: []byte(`env { z }
+z(x).x'<x>.0 + b(y).0`),
+			output: `s0 = {(1,b),(2,#2)} |- (#2(&1).&1'<&1>.0 + b(&2).0)
+s0  2 1   s1 = {(1,b)} |- b'<b>.0
+s0  2 2   s2 = {(2,#2)} |- #2'<#2>.0
+s0  2 1*  s3 = {(1,#1)} |- #1'<#1>.0
+s2  2'2   s4 = {} |- 0
+s3  1'1   s4 = {} |- 0`,
+		},
+		"observe_overrides_env": {
+			input: []byte(`env { z }
+z(x).0 + b(y).0`),
+			observe: []string{"b"},
+			output: `s0 = {(1,#1),(2,z)} |- (#1(&2).0 + z(&1).0)
+s0  1 1   s1 = {} |- 0
+s0  1 2   s1 = {} |- 0
+s0  1 1*  s1 = {} |- 0`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flags := Flags{
+				MaxStates:    100,
+				RegisterSize: 1073741824,
+				Observe:      tc.observe,
+			}
+			defer initFlags(Flags{
+				MaxStates:    1,
+				RegisterSize: 1073741824,
+			})
+			lts, err := GenerateLts(context.Background(), tc.input, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := string(generatePrettyLts(lts)); output != tc.output {
+				t.Errorf("output:\n%s\nexpected:\n%s", output, tc.output)
+			}
+		})
+	}
+}
+
+func TestObserveNotFree(t *testing.T) {
+	tests := map[string]struct {
+		input   []byte
+		observe []string
+	}{
+		"observe": {
+			input:   []byte(`a'<b>.0`),
+			observe: []string{"a", "c"},
+		},
+		"bound": {
+			input:   []byte(`a(x).x'<a>.0`),
+			observe: []string{"x"},
+		},
+		"env": {
+			input: []byte(`env { a, c }
+a'<b>.0`),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flags := Flags{
+				MaxStates:    100,
+				RegisterSize: 1073741824,
+				Observe:      tc.observe,
+			}
+			defer initFlags(Flags{
+				MaxStates:    1,
+				RegisterSize: 1073741824,
+			})
+			if _, err := GenerateLts(context.Background(), tc.input, flags); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package pifra
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// The formatter re-emits a program file in a canonical layout from its
+// parsed declarations, in order and with the names as written. Each
+// declaration is printed on a line with minimal parentheses, and the
+// comments are kept before or after the declarations they are written
+// beside. As a declaration is printed on one line, a comment inside a
+// declaration spanning several lines is moved before it, and a comment at
+// its end is kept after it. Blank lines between declarations are kept as a
+// single blank line.
+
+type declKind int
+
+const (
+	declImport declKind = iota
+	declMarked
+	declEnv
+	declProcess
+	declEntry
+	declUndeclared
+)
+
+// sourceDecl is a declaration of the parsed file as it is written.
+type sourceDecl struct {
+	kind   declKind
+	line   int
+	name   string
+	names  []string
+	params []string
+	sorts  []Sort
+	proc   Element
+}
+
+// Declarations of the parsed file in order.
+var sourceDecls []sourceDecl
+
+// FormatFile returns the program file formatted, and writes it to the file
+// if write is set. The file is left unchanged if it cannot be parsed.
+func FormatFile(file string, write bool) ([]byte, error) {
+	program, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := FormatProgram(program, file)
+	if err != nil {
+		return nil, err
+	}
+	if write {
+		if err := ioutil.WriteFile(file, formatted, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return formatted, nil
+}
+
+// FormatProgram returns the program file formatted.
+func FormatProgram(program []byte, file string) ([]byte, error) {
+	initParser()
+	if err := parseProgram(program, file); err != nil {
+		return nil, err
+	}
+
+	// A line of the output, written at a line of the file. A comment moved
+	// before a declaration is written at the line before it.
+	type outputLine struct {
+		line    int
+		endLine int
+		text    string
+	}
+	var lines []outputLine
+	var endLines []int
+	for i, decl := range sourceDecls {
+		// The last line of a declaration is the last line on which a token
+		// starts before the next declaration.
+		endLine := decl.line
+		for line := range tokenLines {
+			if line > endLine && (i+1 == len(sourceDecls) || line < sourceDecls[i+1].line) {
+				endLine = line
+			}
+		}
+		endLines = append(endLines, endLine)
+		lines = append(lines, outputLine{
+			line:    decl.line,
+			endLine: endLine,
+			text:    formatDecl(decl),
+		})
+	}
+
+	for _, c := range comments {
+		i := sort.Search(len(sourceDecls), func(i int) bool {
+			return sourceDecls[i].line > c.line
+		}) - 1
+		switch {
+		case i >= 0 && c.line == endLines[i]:
+			lines[i].text += " " + c.text
+		case i >= 0 && c.line < endLines[i]:
+			lines = append(lines, outputLine{
+				line:    sourceDecls[i].line,
+				endLine: sourceDecls[i].line - 1,
+				text:    c.text,
+			})
+		default:
+			lines = append(lines, outputLine{
+				line:    c.line,
+				endLine: c.line,
+				text:    c.text,
+			})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].line != lines[j].line {
+			return lines[i].line < lines[j].line
+		}
+		return lines[i].endLine < lines[j].endLine
+	})
+
+	var sb strings.Builder
+	for i, line := range lines {
+		if i > 0 && line.line > lines[i-1].endLine+1 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(line.text + "\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+func formatDecl(decl sourceDecl) string {
+	f := &formatter{
+		exprs: make(map[string]*Expr),
+	}
+	switch decl.kind {
+	case declImport:
+		return `import "` + decl.name + `"`
+	case declMarked:
+		return "marked " + strings.Join(decl.names, ", ")
+	case declEnv:
+		if len(decl.names) == 0 {
+			return "env {}"
+		}
+		return "env { " + strings.Join(decl.names, ", ") + " }"
+	case declProcess:
+		if len(decl.params) == 0 {
+			return decl.name + " = " + f.format(decl.proc)
+		}
+		var params []string
+		for i, param := range decl.params {
+			if decl.sorts != nil && decl.sorts[i].Type != SortAny {
+				param += ": " + decl.sorts[i].String()
+			}
+			params = append(params, param)
+		}
+		return decl.name + "(" + strings.Join(params, ", ") + ") = " + f.format(decl.proc)
+	case declEntry:
+		return "main " + decl.name + " = " + f.format(decl.proc)
+	}
+	return f.format(decl.proc)
+}
+
+// Precedences of the elements as operands, from the loosest.
+const (
+	precPar = iota
+	precSum
+	precPrefix
+)
+
+// formatter prints the parsed elements in the syntax of the parser.
+type formatter struct {
+	// Compound expressions bound to the variables of the parser.
+	exprs map[string]*Expr
+}
+
+func (f *formatter) format(elem Element) string {
+	str, _, _ := f.formatAcc(elem)
+	return str
+}
+
+// operand returns an operand in parentheses if it binds looser than the
+// precedence, or if it is open, i.e. it ends with a match which would take
+// the operator following it, and an operator follows it. It also returns
+// whether the operand is open.
+func (f *formatter) operand(elem Element, prec int, followed bool) (string, bool) {
+	str, elemPrec, open := f.formatAcc(elem)
+	if elemPrec < prec || (followed && open) {
+		return "(" + str + ")", false
+	}
+	return str, open
+}
+
+func (f *formatter) formatName(name Name) string {
+	if expr, ok := f.exprs[name.Name]; ok {
+		return prettyPrintExpr(expr)
+	}
+	return name.Name
+}
+
+// formatAcc returns the element, its precedence and whether it is open.
+func (f *formatter) formatAcc(elem Element) (string, int, bool) {
+	switch elem.Type() {
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		next, open := f.operand(outElem.Next, precPrefix, false)
+		return outElem.Channel.Name + "'<" + f.formatName(outElem.Output) + ">." + next, precPrefix, open
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		input := inpElem.Input.Name
+		if inpElem.Sort.Type != SortAny {
+			input += ": " + inpElem.Sort.String()
+		}
+		next, open := f.operand(inpElem.Next, precPrefix, false)
+		return inpElem.Channel.Name + "(" + input + ")." + next, precPrefix, open
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		next, _ := f.operand(matchElem.Next, precPar, false)
+		op := "="
+		if matchElem.Inequality {
+			op = "!="
+		}
+		return "[" + matchElem.NameL.Name + op + matchElem.NameR.Name + "]" + next, precPrefix, true
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		next, _ := f.operand(guardElem.Next, precPar, false)
+		return "[" + prettyPrintGuard(guardElem.Guard) + "]" + next, precPrefix, true
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		if strings.HasPrefix(letElem.Var.Name, exprPrefix) {
+			f.exprs[letElem.Var.Name] = letElem.Expr
+			return f.formatAcc(letElem.Next)
+		}
+		next, open := f.operand(letElem.Next, precPrefix, false)
+		if caseLets[letElem] {
+			return "case " + letElem.Expr.ExprL.Name.Name + " of {" + letElem.Var.Name + "}" +
+				letElem.Expr.ExprR.Name.Name + " in " + next, precPrefix, open
+		}
+		return "let " + letElem.Var.Name + " = " + prettyPrintExpr(letElem.Expr) + " in " + next, precPrefix, open
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		op := "="
+		if ifElem.Inequality {
+			op = "!="
+		}
+		then, _ := f.operand(ifElem.Then, precPar, false)
+		els, open := f.operand(ifElem.Else, precPrefix, false)
+		return "if " + ifElem.NameL.Name + op + ifElem.NameR.Name + " then " + then + " else " + els, precPrefix, open
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		name := resElem.Restrict.Name
+		if s, ok := restrictionSorts[resElem]; ok {
+			name += ": " + s.String()
+		}
+		next, open := f.operand(resElem.Next, precPrefix, false)
+		return "$" + name + "." + next, precPrefix, open
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		procL, _ := f.operand(sumElem.ProcessL, precSum+1, true)
+		procR, open := f.operand(sumElem.ProcessR, precSum, false)
+		return procL + " + " + procR, precSum, open
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL, _ := f.operand(parElem.ProcessL, precPar+1, true)
+		procR, open := f.operand(parElem.ProcessR, precPar, false)
+		return procL + " | " + procR, precPar, open
+	case ElemTypProcess:
+		procElem := elem.(*ElemProcess)
+		if len(procElem.Parameters) == 0 {
+			return procElem.Name, precPrefix, false
+		}
+		var args []string
+		for i, param := range procElem.Parameters {
+			arg := f.formatName(param)
+			if names, ok := namedCalls[procElem]; ok {
+				arg = names[i] + "=" + arg
+			}
+			args = append(args, arg)
+		}
+		return procElem.Name + "(" + strings.Join(args, ", ") + ")", precPrefix, false
+	}
+	return "0", precPrefix, false
+}
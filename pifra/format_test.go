@@ -0,0 +1,158 @@
+package pifra
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormatProgram(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		output string
+	}{
+		"declarations": {
+			input: `import  "lib.pi"
+marked _BAD,pub
+env {pub,_BAD}
+Server(req,resp)=req(x).resp<x>.Server(req,resp)
+main M = $a. Server(resp=b, req=a)
+`,
+			output: `import "lib.pi"
+marked _BAD, pub
+env { pub, _BAD }
+Server(req, resp) = req(x).resp'<x>.Server(req, resp)
+main M = $a.Server(resp=b, req=a)
+`,
+		},
+		"parentheses": {
+			input: `P() = ((a(x).0 + b(y).0) | (c<d>.0 | e<f>.0))
+Q = ([a=b]a<b>.0) | (c<d>.0 + $e.(e<f>.0 | f(g).0))
+`,
+			output: `P = a(x).0 + b(y).0 | c'<d>.0 | e'<f>.0
+Q = ([a=b]a'<b>.0) | c'<d>.0 + $e.(e'<f>.0 | f(g).0)
+`,
+		},
+		"data": {
+			input: `Count(n: 0..3, k: ch<ch<>>) = [n<3]tick<n>.Count(n+1, k) + [n>=3]case x of {y}k in let z = enc(y,k) in 0
+`,
+			output: `Count(n: 0..3, k: ch<ch<>>) = [n<3]tick'<n>.Count(n+1, k) + [3<=n]case x of {y}k in let z = enc(y,k) in 0
+`,
+		},
+		"comments": {
+			input: `// Header.
+
+// Declarations.
+P = a<b>.0  // first
+
+
+Q = 0 // last
+// end
+`,
+			output: `// Header.
+
+// Declarations.
+P = a'<b>.0 // first
+
+Q = 0 // last
+// end
+`,
+		},
+		// A declaration is printed on one line, so the comments inside it
+		// are moved before it, in order, and a comment at its last line is
+		// kept after it.
+		"comments_inside_declaration": {
+			input: `P = a<b>.  // first
+  // inside
+  0 // end
+Q = 0
+`,
+			output: `// first
+// inside
+P = a'<b>.0 // end
+Q = 0
+`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			output, err := FormatProgram([]byte(tc.input), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(output) != tc.output {
+				t.Errorf("output:\n%s\nexpected:\n%s", output, tc.output)
+			}
+		})
+	}
+}
+
+// TestFormatInvalid tests that a program with a character the lexer does not
+// recognise is not formatted, and that the file is not written.
+func TestFormatInvalid(t *testing.T) {
+	tests := map[string]string{
+		"first_line":        "# c\n",
+		"after_declaration": "P(a) = a(x).0 # t\nP(b)\n",
+	}
+	for name, program := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := FormatProgram([]byte(program), ""); err == nil {
+				t.Error("expected error")
+			}
+			file := filepath.Join(t.TempDir(), "invalid.pi")
+			if err := ioutil.WriteFile(file, []byte(program), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := FormatFile(file, true); err == nil {
+				t.Error("expected error")
+			}
+			if written, err := ioutil.ReadFile(file); err != nil || string(written) != program {
+				t.Errorf("file: %q, expected: %q", written, program)
+			}
+		})
+	}
+}
+
+// TestFormatRoundTrip tests that the formatted test files parse to the same
+// declarations, and are formatted unchanged.
+func TestFormatRoundTrip(t *testing.T) {
+	getDecls := func(program []byte) []string {
+		initParser()
+		if err := parseProgram(program, ""); err != nil {
+			t.Fatal(err)
+		}
+		var decls []string
+		for _, decl := range sourceDecls {
+			str := decl.name
+			if decl.proc != nil {
+				str += " = " + PrettyPrintAst(decl.proc)
+			}
+			decls = append(decls, str)
+		}
+		return decls
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "test", "*.pi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			program, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := FormatProgram(program, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decls, expected := getDecls(output), getDecls(program); !reflect.DeepEqual(decls, expected) {
+				t.Errorf("declarations: %v, expected: %v", decls, expected)
+			}
+			if formatted, _ := FormatProgram(output, ""); string(formatted) != string(output) {
+				t.Errorf("output:\n%s\nformatted again:\n%s", output, formatted)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package pifra
+
+type GuardType int
+
+const (
+	GuardMatch GuardType = iota
+	GuardAnd
+	GuardOr
+	GuardLess
+	GuardLessEqual
+)
+
+// Guard is a boolean combination of name comparisons. A GuardMatch compares
+// NameL and NameR, for inequality if Inequality is set, a GuardLess or a
+// GuardLessEqual compares the integers NameL and NameR, and a GuardAnd or a
+// GuardOr combines GuardL and GuardR. Guards are immutable like elements.
+type Guard struct {
+	Type       GuardType
+	Inequality bool
+	NameL      Name
+	NameR      Name
+	GuardL     *Guard
+	GuardR     *Guard
+}
+
+// holds reports whether the guard holds for the current names.
+func (g *Guard) holds() bool {
+	switch g.Type {
+	case GuardAnd:
+		return g.GuardL.holds() && g.GuardR.holds()
+	case GuardOr:
+		return g.GuardL.holds() || g.GuardR.holds()
+	case GuardLess, GuardLessEqual:
+		l, okL := getIntValue(g.NameL)
+		r, okR := getIntValue(g.NameR)
+		if !okL || !okR {
+			return false
+		}
+		return l < r || (g.Type == GuardLessEqual && l == r)
+	}
+	return (g.NameL.Name == g.NameR.Name) != g.Inequality
+}
+
+// isComparison reports whether the guard is a comparison of two names rather
+// than a combination of guards.
+func (g *Guard) isComparison() bool {
+	return g.Type != GuardAnd && g.Type != GuardOr
+}
+
+// subGuard returns the guard with every name substituted. Guards without a
+// substituted name are shared with the original.
+func subGuard(g *Guard, sub func(Name) Name) *Guard {
+	switch g.Type {
+	case GuardAnd, GuardOr:
+		guardL := subGuard(g.GuardL, sub)
+		guardR := subGuard(g.GuardR, sub)
+		if guardL != g.GuardL || guardR != g.GuardR {
+			return &Guard{
+				Type:   g.Type,
+				GuardL: guardL,
+				GuardR: guardR,
+			}
+		}
+	default:
+		nameL := sub(g.NameL)
+		nameR := sub(g.NameR)
+		if nameL != g.NameL || nameR != g.NameR {
+			return &Guard{
+				Type:       g.Type,
+				Inequality: g.Inequality,
+				NameL:      nameL,
+				NameR:      nameR,
+			}
+		}
+	}
+	return g
+}
+
+// getGuardNames returns the names of the guard in pretty-printed order.
+func getGuardNames(g *Guard) []Name {
+	if g.isComparison() {
+		return []Name{g.NameL, g.NameR}
+	}
+	return append(getGuardNames(g.GuardL), getGuardNames(g.GuardR)...)
+}
+
+// equalGuards reports whether two guards are structurally equal.
+func equalGuards(a *Guard, b *Guard) bool {
+	if a == b {
+		return true
+	}
+	if a.Type != b.Type {
+		return false
+	}
+	if a.isComparison() {
+		return a.Inequality == b.Inequality && equalNames(a.NameL, b.NameL) && equalNames(a.NameR, b.NameR)
+	}
+	return equalGuards(a.GuardL, b.GuardL) && equalGuards(a.GuardR, b.GuardR)
+}
+
+// prettyPrintGuard returns the guard in the syntax of the parser, where a
+// disjunction in a conjunction is parenthesised.
+func prettyPrintGuard(g *Guard) string {
+	operand := func(g *Guard) string {
+		if g.Type == GuardOr {
+			return "(" + prettyPrintGuard(g) + ")"
+		}
+		return prettyPrintGuard(g)
+	}
+	switch g.Type {
+	case GuardAnd:
+		return operand(g.GuardL) + " && " + operand(g.GuardR)
+	case GuardOr:
+		return prettyPrintGuard(g.GuardL) + " || " + prettyPrintGuard(g.GuardR)
+	case GuardLess:
+		return g.NameL.Name + "<" + g.NameR.Name
+	case GuardLessEqual:
+		return g.NameL.Name + "<=" + g.NameR.Name
+	}
+	if g.Inequality {
+		return g.NameL.Name + "!=" + g.NameR.Name
+	}
+	return g.NameL.Name + "=" + g.NameR.Name
+}
+
+func prettyPrintTexGuard(g *Guard) string {
+	operand := func(g *Guard) string {
+		if g.Type == GuardOr {
+			return `( ` + prettyPrintTexGuard(g) + ` )`
+		}
+		return prettyPrintTexGuard(g)
+	}
+	switch g.Type {
+	case GuardAnd:
+		return operand(g.GuardL) + ` \wedge ` + operand(g.GuardR)
+	case GuardOr:
+		return prettyPrintTexGuard(g.GuardL) + ` \vee ` + prettyPrintTexGuard(g.GuardR)
+	case GuardLess:
+		return getTexName(g.NameL.Name) + ` < ` + getTexName(g.NameR.Name)
+	case GuardLessEqual:
+		return getTexName(g.NameL.Name) + ` \leq ` + getTexName(g.NameR.Name)
+	}
+	if g.Inequality {
+		return getTexName(g.NameL.Name) + ` \neq ` + getTexName(g.NameR.Name)
+	}
+	return getTexName(g.NameL.Name) + ` = ` + getTexName(g.NameR.Name)
+}
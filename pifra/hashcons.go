@@ -0,0 +1,340 @@
+package pifra
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// termTable hash-conses normalised elements. Structurally equal subterms are
+// represented by a single canonical element, so canonical processes can be
+// compared by pointer and memory grows with the number of unique subterms.
+type termTable struct {
+	// Canonical elements keyed by their structural hash. Elements sharing a
+	// bucket are told apart by a full comparison.
+	buckets map[uint64][]Element
+	// Structural hash of each canonical element.
+	hashes map[Element]uint64
+}
+
+// stateKey identifies a normalised configuration.
+type stateKey struct {
+	Process   Element
+	Registers string
+}
+
+func newTermTable() *termTable {
+	return &termTable{
+		buckets: make(map[uint64][]Element),
+		hashes:  make(map[Element]uint64),
+	}
+}
+
+// internConfiguration returns the configuration with its process replaced by
+// the canonical element, together with the key of the configuration.
+func (t *termTable) internConfiguration(conf Configuration) (Configuration, stateKey) {
+	conf.Process = t.intern(conf.Process)
+	return conf, stateKey{
+		Process:   conf.Process,
+		Registers: getRegisterKey(conf.Registers),
+	}
+}
+
+// intern returns the canonical element structurally equal to elem.
+func (t *termTable) intern(elem Element) Element {
+	if _, ok := t.hashes[elem]; ok {
+		return elem
+	}
+
+	// Children are interned first, so nodes are compared with their
+	// canonical children by pointer.
+	switch elem.Type() {
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		if next := t.intern(outElem.Next); next != outElem.Next {
+			elem = &ElemOutput{
+				Channel: outElem.Channel,
+				Output:  outElem.Output,
+				Next:    next,
+			}
+		}
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		if next := t.intern(inpElem.Next); next != inpElem.Next {
+			elem = &ElemInput{
+				Channel: inpElem.Channel,
+				Input:   inpElem.Input,
+				Sort:    inpElem.Sort,
+				Next:    next,
+			}
+		}
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		if next := t.intern(matchElem.Next); next != matchElem.Next {
+			elem = &ElemEquality{
+				Inequality: matchElem.Inequality,
+				NameL:      matchElem.NameL,
+				NameR:      matchElem.NameR,
+				Next:       next,
+			}
+		}
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		if next := t.intern(guardElem.Next); next != guardElem.Next {
+			elem = &ElemGuard{
+				Guard: guardElem.Guard,
+				Next:  next,
+			}
+		}
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		if next := t.intern(letElem.Next); next != letElem.Next {
+			elem = &ElemLet{
+				Var:  letElem.Var,
+				Expr: letElem.Expr,
+				Next: next,
+			}
+		}
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		procThen := t.intern(ifElem.Then)
+		procElse := t.intern(ifElem.Else)
+		if procThen != ifElem.Then || procElse != ifElem.Else {
+			elem = &ElemIf{
+				Inequality: ifElem.Inequality,
+				NameL:      ifElem.NameL,
+				NameR:      ifElem.NameR,
+				Then:       procThen,
+				Else:       procElse,
+			}
+		}
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		if next := t.intern(resElem.Next); next != resElem.Next {
+			elem = &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		procL := t.intern(sumElem.ProcessL)
+		procR := t.intern(sumElem.ProcessR)
+		if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+			elem = &ElemSum{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL := t.intern(parElem.ProcessL)
+		procR := t.intern(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			elem = &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		if next := t.intern(rootElem.Next); next != rootElem.Next {
+			elem = &ElemRoot{
+				Next: next,
+			}
+		}
+	}
+
+	hash := t.hash(elem)
+	for _, canon := range t.buckets[hash] {
+		if shallowEqual(canon, elem) {
+			return canon
+		}
+	}
+	t.buckets[hash] = append(t.buckets[hash], elem)
+	t.hashes[elem] = hash
+	return elem
+}
+
+// hash returns the 64-bit structural hash of an element whose children
+// are canonical.
+func (t *termTable) hash(elem Element) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	writeInt := func(i uint64) {
+		binary.LittleEndian.PutUint64(buf, i)
+		h.Write(buf)
+	}
+	writeName := func(name Name) {
+		writeInt(uint64(len(name.Name)))
+		h.Write([]byte(name.Name))
+		writeInt(uint64(name.Type))
+	}
+	var writeExpr func(e *Expr)
+	writeExpr = func(e *Expr) {
+		writeInt(uint64(e.Type))
+		if e.Type == ExprName {
+			writeName(e.Name)
+			return
+		}
+		writeExpr(e.ExprL)
+		writeExpr(e.ExprR)
+	}
+	var writeGuard func(g *Guard)
+	writeGuard = func(g *Guard) {
+		writeInt(uint64(g.Type))
+		if !g.isComparison() {
+			writeGuard(g.GuardL)
+			writeGuard(g.GuardR)
+			return
+		}
+		if g.Inequality {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+		writeName(g.NameL)
+		writeName(g.NameR)
+	}
+
+	writeInt(uint64(elem.Type()))
+	switch elem.Type() {
+	case ElemTypNil:
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		writeName(outElem.Channel)
+		writeName(outElem.Output)
+		writeInt(t.hashes[outElem.Next])
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		writeName(inpElem.Channel)
+		writeName(inpElem.Input)
+		writeInt(uint64(inpElem.Sort.Type))
+		writeInt(uint64(inpElem.Sort.Min))
+		writeInt(uint64(inpElem.Sort.Max))
+		writeInt(t.hashes[inpElem.Next])
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		if matchElem.Inequality {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+		writeName(matchElem.NameL)
+		writeName(matchElem.NameR)
+		writeInt(t.hashes[matchElem.Next])
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		writeGuard(guardElem.Guard)
+		writeInt(t.hashes[guardElem.Next])
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		writeName(letElem.Var)
+		writeExpr(letElem.Expr)
+		writeInt(t.hashes[letElem.Next])
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		if ifElem.Inequality {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+		writeName(ifElem.NameL)
+		writeName(ifElem.NameR)
+		writeInt(t.hashes[ifElem.Then])
+		writeInt(t.hashes[ifElem.Else])
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		writeName(resElem.Restrict)
+		writeInt(t.hashes[resElem.Next])
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		writeInt(t.hashes[sumElem.ProcessL])
+		writeInt(t.hashes[sumElem.ProcessR])
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		writeInt(t.hashes[parElem.ProcessL])
+		writeInt(t.hashes[parElem.ProcessR])
+	case ElemTypProcess:
+		procElem := elem.(*ElemProcess)
+		writeInt(uint64(len(procElem.Name)))
+		h.Write([]byte(procElem.Name))
+		writeInt(uint64(len(procElem.Parameters)))
+		for _, param := range procElem.Parameters {
+			writeName(param)
+		}
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		writeInt(t.hashes[rootElem.Next])
+	}
+	return h.Sum64()
+}
+
+// shallowEqual reports whether two elements with canonical children are
+// structurally equal. Children are compared by pointer.
+func shallowEqual(elemA Element, elemB Element) bool {
+	if elemA.Type() != elemB.Type() {
+		return false
+	}
+	switch elemA.Type() {
+	case ElemTypNil:
+		return true
+	case ElemTypOutput:
+		a, b := elemA.(*ElemOutput), elemB.(*ElemOutput)
+		return a.Channel == b.Channel && equalNames(a.Output, b.Output) && a.Next == b.Next
+	case ElemTypInput:
+		a, b := elemA.(*ElemInput), elemB.(*ElemInput)
+		return a.Channel == b.Channel && a.Input == b.Input && a.Sort == b.Sort && a.Next == b.Next
+	case ElemTypMatch:
+		a, b := elemA.(*ElemEquality), elemB.(*ElemEquality)
+		return a.Inequality == b.Inequality && equalNames(a.NameL, b.NameL) &&
+			equalNames(a.NameR, b.NameR) && a.Next == b.Next
+	case ElemTypGuard:
+		a, b := elemA.(*ElemGuard), elemB.(*ElemGuard)
+		return equalGuards(a.Guard, b.Guard) && a.Next == b.Next
+	case ElemTypLet:
+		a, b := elemA.(*ElemLet), elemB.(*ElemLet)
+		return a.Var == b.Var && equalExprs(a.Expr, b.Expr) && a.Next == b.Next
+	case ElemTypIf:
+		a, b := elemA.(*ElemIf), elemB.(*ElemIf)
+		return a.Inequality == b.Inequality && equalNames(a.NameL, b.NameL) &&
+			equalNames(a.NameR, b.NameR) && a.Then == b.Then && a.Else == b.Else
+	case ElemTypRestriction:
+		a, b := elemA.(*ElemRestriction), elemB.(*ElemRestriction)
+		return a.Restrict == b.Restrict && a.Next == b.Next
+	case ElemTypSum:
+		a, b := elemA.(*ElemSum), elemB.(*ElemSum)
+		return a.ProcessL == b.ProcessL && a.ProcessR == b.ProcessR
+	case ElemTypParallel:
+		a, b := elemA.(*ElemParallel), elemB.(*ElemParallel)
+		return a.ProcessL == b.ProcessL && a.ProcessR == b.ProcessR
+	case ElemTypProcess:
+		a, b := elemA.(*ElemProcess), elemB.(*ElemProcess)
+		if a.Name != b.Name || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !equalNames(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return true
+	case ElemTypRoot:
+		a, b := elemA.(*ElemRoot), elemB.(*ElemRoot)
+		return a.Next == b.Next
+	}
+	return false
+}
+
+// getRegisterKey returns a compact encoding of the register contents.
+func getRegisterKey(register Registers) string {
+	var sb strings.Builder
+	for _, label := range register.Labels() {
+		sb.WriteString(strconv.Itoa(label))
+		sb.WriteByte(' ')
+		sb.WriteString(register.Registers[label])
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
@@ -0,0 +1,77 @@
+package pifra
+
+import (
+	"testing"
+)
+
+func TestIntern(t *testing.T) {
+	tests := map[string]struct {
+		inputA []byte
+		inputB []byte
+		equal  bool
+	}{
+		"equal_up_to_congruence": {
+			inputA: []byte(`(a'<a>.0 | b'<b>.0) | c'<c>.0`),
+			inputB: []byte(`c'<c>.0 | (b'<b>.0 | a'<a>.0)`),
+			equal:  true,
+		},
+		"equal": {
+			inputA: []byte(`$a.(b'<a>.0 | c(x).x'<a>.0)`),
+			inputB: []byte(`$a.(b'<a>.0 | c(x).x'<a>.0)`),
+			equal:  true,
+		},
+		"different_name": {
+			inputA: []byte(`$a.(b'<a>.0 | c(x).x'<a>.0)`),
+			inputB: []byte(`$a.(b'<a>.0 | c(x).x'<b>.0)`),
+			equal:  false,
+		},
+		"different_structure": {
+			inputA: []byte(`a'<a>.0 | a'<a>.0`),
+			inputB: []byte(`a'<a>.a'<a>.0`),
+			equal:  false,
+		},
+		"inequality": {
+			inputA: []byte(`[a=b]0`),
+			inputB: []byte(`[a!=b]0`),
+			equal:  false,
+		},
+		"conditional_branches": {
+			inputA: []byte(`if a=b then a'<a>.0 else 0`),
+			inputB: []byte(`if a=b then 0 else a'<a>.0`),
+			equal:  false,
+		},
+		"conditional_nil": {
+			inputA: []byte(`a'<b>.0 | if a=b then 0 else 0`),
+			inputB: []byte(`a'<b>.0`),
+			equal:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			terms := newTermTable()
+			procA, _ := InitProgram(tc.inputA)
+			confA, keyA := terms.internConfiguration(applyStructrualCongruence(newRootConf(procA)))
+			procB, _ := InitProgram(tc.inputB)
+			confB, keyB := terms.internConfiguration(applyStructrualCongruence(newRootConf(procB)))
+			if (keyA == keyB) != tc.equal {
+				t.Errorf("keys equal: %t, expected: %t", keyA == keyB, tc.equal)
+			}
+			if tc.equal && confA.Process != confB.Process {
+				t.Error("equal processes not shared")
+			}
+		})
+	}
+}
+
+func TestInternSharesSubterms(t *testing.T) {
+	terms := newTermTable()
+	proc, _ := InitProgram([]byte(`a'<b>.0 | a'<b>.0`))
+	root := terms.intern(proc).(*ElemRoot)
+	par := root.Next.(*ElemParallel)
+	if par.ProcessL != par.ProcessR {
+		t.Error("equal subterms not shared")
+	}
+	if len(terms.hashes) != 4 {
+		t.Errorf("unique subterms: %d, expected: 4", len(terms.hashes))
+	}
+}
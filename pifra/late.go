@@ -0,0 +1,90 @@
+package pifra
+
+import "strconv"
+
+// Explore the late semantics instead of the early semantics.
+var lateSemantics bool
+
+// lateTrans returns the transitions of a configuration in the late
+// semantics.
+//
+// In the early semantics, an input has a transition for each register name
+// and one for a fresh name, which is the name received. In the late
+// semantics, an input has a single transition labelled "i (k)", which
+// substitutes the placeholder ?k for the input name, and communications
+// substitute the name sent for the placeholder after the synchronisation.
+// The placeholder of an input of the environment is not in the registers: a
+// configuration with a placeholder only has the transitions instantiating
+// it, labelled "?k=j" for each register label j and "?k=j*" for a fresh
+// name, as the continuation of a late input is an abstraction over the name
+// received.
+func lateTrans(conf Configuration) []Configuration {
+	if vars := getVariables(conf.Process); len(vars) > 0 {
+		return instantiateVariable(conf, vars[0])
+	}
+	return trans(conf)
+}
+
+// lateInp returns the transition of the input of a placeholder, with the
+// label of the input channel.
+func lateInp(conf Configuration, inpElem *ElemInput, label Label) Configuration {
+	// The least placeholder index not in the configuration.
+	index := 1
+	for _, v := range getVariables(conf.Process) {
+		if getVariableIndex(v) == index {
+			index++
+		}
+	}
+	inpConf := conf
+	inpConf.Label = label
+	inpConf.Label.Symbol2 = Symbol{
+		Type:  SymbolTypBoundInput,
+		Value: index,
+	}
+	inpConf.Process = substituteName(inpElem.Next, inpElem.Input, Name{
+		Name: varPrefix + strconv.Itoa(index),
+		Type: Free,
+	})
+	return inpConf
+}
+
+// getReceivedName returns the name received by the input of a fresh name or
+// of a placeholder.
+func getReceivedName(conf Configuration) Name {
+	if conf.Label.Symbol2.Type == SymbolTypBoundInput {
+		return Name{
+			Name: varPrefix + strconv.Itoa(conf.Label.Symbol2.Value),
+		}
+	}
+	return Name{
+		Name: conf.Registers.GetName(conf.Label.Symbol2.Value),
+	}
+}
+
+// isNameInput reports whether the symbol is the input of a fresh name or of
+// a placeholder, which a ciphertext or a restricted name can be substituted
+// for.
+func isNameInput(symbol Symbol) bool {
+	return symbol.Type == SymbolTypFreshInput || symbol.Type == SymbolTypBoundInput
+}
+
+// commPlaceholder returns the process of the communication of an output of a
+// register name to an input of a placeholder, which substitutes the name
+// sent for the placeholder.
+func commPlaceholder(outConf Configuration, inpConf Configuration, outLeft bool) Element {
+	outPar := outConf.Process.(*ElemParallel)
+	inpPar := inpConf.Process.(*ElemParallel)
+	name := Name{
+		Name: outConf.Registers.GetName(outConf.Label.Symbol2.Value),
+	}
+	if outLeft {
+		return &ElemParallel{
+			ProcessL: outPar.ProcessL,
+			ProcessR: subName(inpPar.ProcessR, getReceivedName(inpConf), name),
+		}
+	}
+	return &ElemParallel{
+		ProcessL: subName(inpPar.ProcessL, getReceivedName(inpConf), name),
+		ProcessR: outPar.ProcessR,
+	}
+}
@@ -0,0 +1,100 @@
+package pifra
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLateSemantics(t *testing.T) {
+	input := []byte(`a(x).x'<x>.0 | a'<b>.0`)
+	output := `s0 = {(1,#1),(2,#2)} |- (#1'<#2>.0 | #1(&1).&1'<&1>.0)
+s0  1'2   s1 = {(1,#1)} |- #1(&1).&1'<&1>.0
+s0  1 (1)  s2 = {(1,#1),(2,#2)} |- (#1'<#2>.0 | ?1'<?1>.0)
+s0  t     s3 = {(2,#2)} |- #2'<#2>.0
+s1  1 (1)  s4 = {} |- ?1'<?1>.0
+s2  ?1=1   s5 = {(1,#1),(2,#2)} |- (#1'<#1>.0 | #1'<#2>.0)
+s2  ?1=2   s6 = {(1,#1),(2,#2)} |- (#1'<#2>.0 | #2'<#2>.0)
+s2  ?1=3*  s7 = {(1,#1),(2,#2),(3,#3)} |- (#1'<#2>.0 | #3'<#3>.0)
+s3  2'2   s8 = {} |- 0
+s4  ?1=1*  s9 = {(1,#1)} |- #1'<#1>.0
+s5  1'1   s10 = {(1,#1),(2,#2)} |- #1'<#2>.0
+s5  1'2   s9 = {(1,#1)} |- #1'<#1>.0
+s6  1'2   s3 = {(2,#2)} |- #2'<#2>.0
+s6  2'2   s10 = {(1,#1),(2,#2)} |- #1'<#2>.0
+s7  1'2   s11 = {(3,#3)} |- #3'<#3>.0
+s7  3'3   s10 = {(1,#1),(2,#2)} |- #1'<#2>.0
+s9  1'1   s8 = {} |- 0
+s10  1'2   s8 = {} |- 0
+s11  3'3   s8 = {} |- 0`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Semantics:    "late",
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+func TestLateSemanticsMatch(t *testing.T) {
+	// The match on the received name holds after the input of b.
+	input := []byte(`a(x).[x=b]a'<c>.0`)
+	traces := func(semantics string) map[string]bool {
+		flags := Flags{
+			MaxStates:    100,
+			RegisterSize: 1073741824,
+			Semantics:    semantics,
+		}
+		defer initFlags(Flags{
+			MaxStates:    1,
+			RegisterSize: 1073741824,
+		})
+		lts, err := GenerateLts(context.Background(), input, flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The input of a placeholder and its instantiation are merged into
+		// the early input of the name instantiated.
+		traces := make(map[string]bool)
+		var walk func(state int, trace string, input string)
+		walk = func(state int, trace string, input string) {
+			end := true
+			for _, trn := range lts.Transitions {
+				if trn.Source != state {
+					continue
+				}
+				end = false
+				switch {
+				case trn.Label.Symbol2.Type == SymbolTypBoundInput:
+					walk(trn.Destination, trace, prettyPrintSymbol(trn.Label.Symbol))
+					continue
+				case trn.Label.Symbol.Type == SymbolTypVariable:
+					walk(trn.Destination, trace+input+prettyPrintSymbol(trn.Label.Symbol2)+";", "")
+					continue
+				}
+				walk(trn.Destination, trace+prettyPrintLabel(trn.Label)+";", "")
+			}
+			if end {
+				traces[trace] = true
+			}
+		}
+		walk(0, "", "")
+		return traces
+	}
+	early := traces("early")
+	late := traces("late")
+	if !reflect.DeepEqual(late, early) {
+		t.Errorf("late traces: %v, early traces: %v", late, early)
+	}
+}
@@ -20,12 +20,14 @@ type lexer struct {
     data []byte
     p, pe, cs int
     ts, te, act int
+    line int
 }
 
 func newLexer(data []byte) *lexer {
     lex := &lexer{ 
         data: data,
         pe: len(data),
+        line: 1,
     }
     
 //line lex.go:32
@@ -36,7 +38,7 @@ func newLexer(data []byte) *lexer {
 	 lex.act = 0
 	}
 
-//line lex.rl:25
+//line lex.rl:27
     return lex
 }
 
@@ -44,6 +46,11 @@ func (lex *lexer) Lex(out *yySymType) int {
     eof := lex.pe
     tok := 0
 
+    // Tokens recognised before the machine.
+    if tok = lex.lexExtension(out); tok != 0 {
+        return tok
+    }
+
     
 //line lex.go:49
 	{
@@ -62,77 +69,77 @@ func (lex *lexer) Lex(out *yySymType) int {
 	}
 	goto st_out
 tr2:
-//line lex.rl:50
+//line lex.rl:57
  lex.te = ( lex.p)+1
 
 	goto st2
 tr3:
-//line lex.rl:45
+//line lex.rl:52
  lex.te = ( lex.p)+1
 { tok = EXCLAMATION; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr4:
-//line lex.rl:38
+//line lex.rl:45
  lex.te = ( lex.p)+1
 { tok = DOLLARSIGN; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr5:
-//line lex.rl:35
+//line lex.rl:42
  lex.te = ( lex.p)+1
 { tok =  APOSTROPHE; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr6:
-//line lex.rl:40
+//line lex.rl:47
  lex.te = ( lex.p)+1
 { tok = LBRACKET; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr7:
-//line lex.rl:41
+//line lex.rl:48
  lex.te = ( lex.p)+1
 { tok = RBRACKET; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr8:
-//line lex.rl:39
+//line lex.rl:46
  lex.te = ( lex.p)+1
 { tok = PLUS; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr9:
-//line lex.rl:44
+//line lex.rl:51
  lex.te = ( lex.p)+1
 { tok = COMMA; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr10:
-//line lex.rl:48
+//line lex.rl:55
  lex.te = ( lex.p)+1
 { tok = DOT; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr12:
-//line lex.rl:42
+//line lex.rl:49
  lex.te = ( lex.p)+1
 { tok = LANGLE; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr13:
-//line lex.rl:46
+//line lex.rl:53
  lex.te = ( lex.p)+1
 { tok = EQUAL; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr14:
-//line lex.rl:43
+//line lex.rl:50
  lex.te = ( lex.p)+1
 { tok = RANGLE; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr15:
-//line lex.rl:36
+//line lex.rl:43
  lex.te = ( lex.p)+1
 { tok =  LSQBRACKET; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr16:
-//line lex.rl:37
+//line lex.rl:44
  lex.te = ( lex.p)+1
 { tok =  RSQBRACKET; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
 tr18:
-//line lex.rl:47
+//line lex.rl:54
  lex.te = ( lex.p)+1
 { tok = VERTBAR; {( lex.p)++;  lex.cs = 2; goto _out } }
 	goto st2
@@ -222,14 +229,14 @@ tr0:
 //line NONE:1
  lex.te = ( lex.p)+1
 
-//line lex.rl:49
+//line lex.rl:56
  lex.act = 16;
 	goto st3
 tr11:
 //line NONE:1
  lex.te = ( lex.p)+1
 
-//line lex.rl:34
+//line lex.rl:41
  lex.act = 1;
 	goto st3
 	st3:
@@ -285,9 +292,12 @@ tr11:
 	_out: {}
 	}
 
-//line lex.rl:53
+//line lex.rl:60
 
 
+    if tok == NAME {
+        tok = getKeyword(out.name)
+    }
     return tok;
 }
 
@@ -14,12 +14,14 @@ type lexer struct {
     data []byte
     p, pe, cs int
     ts, te, act int
+    line int
 }
 
 func newLexer(data []byte) *lexer {
     lex := &lexer{ 
         data: data,
         pe: len(data),
+        line: 1,
     }
     %% write init;
     return lex
@@ -29,6 +31,11 @@ func (lex *lexer) Lex(out *yySymType) int {
     eof := lex.pe
     tok := 0
 
+    // Tokens recognised before the machine.
+    if tok = lex.lexExtension(out); tok != 0 {
+        return tok
+    }
+
     %%{ 
         main := |*
             '0' => { tok =  ZERO; fbreak; };
@@ -52,6 +59,9 @@ func (lex *lexer) Lex(out *yySymType) int {
          write exec;
     }%%
 
+    if tok == NAME {
+        tok = getKeyword(out.name)
+    }
     return tok;
 }
 
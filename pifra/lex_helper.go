@@ -0,0 +1,135 @@
+package pifra
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Keywords are the names recognised as tokens.
+var keywords = map[string]int{
+	"import": IMPORT,
+	"main":   MAIN,
+	"if":     IF,
+	"then":   THEN,
+	"else":   ELSE,
+	"let":    LET,
+	"in":     IN,
+	"true":   TRUE,
+	"false":  FALSE,
+	"bool":   BOOL,
+	"enc":    ENC,
+	"dec":    DEC,
+	"case":   CASE,
+	"of":     OF,
+	"marked": MARKED,
+	"env":    ENV,
+}
+
+// Symbols are the characters recognised as tokens besides the machine.
+var symbols = map[byte]int{
+	':': COLON,
+	'-': MINUS,
+	'{': LBRACE,
+	'}': RBRACE,
+}
+
+// getKeyword returns the token of a keyword, INT if the name is a numeral, or
+// NAME if the name is not a keyword.
+func getKeyword(name string) int {
+	if tok, ok := keywords[name]; ok {
+		return tok
+	}
+	if strings.Trim(name, "0123456789") == "" {
+		return INT
+	}
+	return NAME
+}
+
+// comment is a line comment "// ..." of the parsed file.
+type comment struct {
+	line int
+	text string
+}
+
+// Comments of the parsed file in order.
+var comments []comment
+
+// Lines of the parsed file on which a token starts.
+var tokenLines map[int]bool
+
+// lexExtension skips the white space and the comments, counting the lines,
+// and returns the next token if it is not recognised by the machine,
+// otherwise 0. The line of the next token is stored in the symbol.
+func (lex *lexer) lexExtension(out *yySymType) int {
+	for lex.p < lex.pe {
+		if isSpace(lex.data[lex.p]) {
+			if lex.data[lex.p] == '\n' {
+				lex.line++
+			}
+			lex.p++
+			continue
+		}
+		if !bytes.HasPrefix(lex.data[lex.p:lex.pe], []byte("//")) {
+			break
+		}
+		end := bytes.IndexByte(lex.data[lex.p:lex.pe], '\n')
+		if end == -1 {
+			end = lex.pe - lex.p
+		}
+		comments = append(comments, comment{
+			line: lex.line,
+			text: strings.TrimRight(string(lex.data[lex.p:lex.p+end]), " \t\r"),
+		})
+		lex.p = lex.p + end
+	}
+	out.line = lex.line
+	if lex.p == lex.pe {
+		return 0
+	}
+	tokenLines[lex.line] = true
+
+	lex.ts = lex.p
+	switch lex.data[lex.p] {
+	case '"':
+		// Strings end on the same line.
+		end := bytes.IndexAny(lex.data[lex.p+1:], "\"\n")
+		if end == -1 || lex.data[lex.p+1+end] != '"' {
+			return 0
+		}
+		out.name = string(lex.data[lex.p+1 : lex.p+1+end])
+		lex.p = lex.p + end + 2
+		lex.te = lex.p
+		return STRING
+	case '&', '|':
+		// The operators of guards. A single '|' is recognised by the
+		// machine.
+		if lex.p+1 < lex.pe && lex.data[lex.p+1] == lex.data[lex.p] {
+			tok := AND
+			if lex.data[lex.p] == '|' {
+				tok = OR
+			}
+			lex.p = lex.p + 2
+			lex.te = lex.p
+			return tok
+		}
+	case '.':
+		// The range of an integer sort. A single '.' is recognised by the
+		// machine.
+		if lex.p+1 < lex.pe && lex.data[lex.p+1] == '.' {
+			lex.p = lex.p + 2
+			lex.te = lex.p
+			return DOTDOT
+		}
+	default:
+		if tok, ok := symbols[lex.data[lex.p]]; ok {
+			lex.p++
+			lex.te = lex.p
+			return tok
+		}
+	}
+	return 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || (c >= '\t' && c <= '\r')
+}
@@ -3,10 +3,15 @@ package pifra
 import (
 	"bytes"
 	"container/list"
+	"context"
+	"errors"
 	"fmt"
+	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"text/template"
+	"time"
 )
 
 type Lts struct {
@@ -14,9 +19,22 @@ type Lts struct {
 	Transitions []Transition
 
 	RegSizeReached map[int]bool
+	// Visible actions of the explored states, if reported in a closed
+	// system.
+	Barbs map[int][]string
+	// Breakdown of the generation, if profiled.
+	Profile *Profile
+	// Unexplored states when the exploration was interrupted.
+	Frontier map[int]bool
+	// Reason the exploration was interrupted, if it was.
+	Interrupted error
 
 	StatesExplored  int
 	StatesGenerated int
+	// Numbers of states and transitions, including those streamed and not
+	// kept in States and Transitions.
+	StatesUnique      int
+	TransitionsUnique int
 }
 
 type Transition struct {
@@ -46,79 +64,321 @@ var a4GVLayout = []byte(`
 
 var gvLayout string
 
-func explore(root Configuration) Lts {
+// Maximum heap size in bytes before the exploration is interrupted. 0 is
+// unlimited.
+var maxMemory uint64
+
+// Number of states explored between heap size checks.
+const memoryCheckInterval = 256
+
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// exploration is the state of a breadth-first LTS exploration. It can be
+// checkpointed to a file and resumed.
+type exploration struct {
+	// Hash-consed processes of the visited states.
+	terms *termTable
 	// Visited states.
-	visited := make(map[string]int)
-	// Encountered transitions.
-	trnsSeen := make(map[Transition]bool)
+	visited map[stateKey]int
 	// Track which states have reached the register size.
-	regSizeReached := make(map[int]bool)
-	// LTS states.
-	states := make(map[int]Configuration)
-	// LTS transitions.
-	var trns []Transition
+	regSizeReached map[int]bool
+	// Barbs of the explored states in a closed system.
+	barbs map[int][]string
+	// LTS states. When streaming, explored states are removed.
+	states map[int]Configuration
+	// LTS transitions. When streaming, transitions are not kept.
+	trns []Transition
 	// State ID.
-	var stateId int
+	stateId int
+	// IDs of the states to be explored.
+	queue *list.List
+	// BFS depths of the states to be explored.
+	depths map[int]int
+	// BFS depth of the state being explored.
+	depth int
+
+	statesExplored  int
+	statesGenerated int
+	transitions     int
+
+	// Set when an observer stops the exploration.
+	stopped bool
+}
+
+func newExploration() *exploration {
+	return &exploration{
+		terms:          newTermTable(),
+		visited:        make(map[stateKey]int),
+		regSizeReached: make(map[int]bool),
+		barbs:          make(map[int][]string),
+		states:         make(map[int]Configuration),
+		queue:          list.New(),
+		depths:         make(map[int]int),
+	}
+}
 
-	applyStructrualCongruence(root)
-	rootKey := getConfigurationKey(root)
-	visited[rootKey] = stateId
-	states[stateId] = root
-	stateId++
+// addState returns the ID of the normalised configuration. An unvisited
+// configuration is added to the states, streamed, and queued unless the
+// observers prune it.
+func (e *exploration) addState(conf Configuration) (int, error) {
+	start := startPhase()
+	conf, key := e.terms.internConfiguration(conf)
+	id, ok := e.visited[key]
+	endPhase(phaseKey, start)
+	if ok {
+		profileDuplicate()
+		return id, nil
+	}
+	profileState(conf)
+	id = e.stateId
+	e.visited[key] = id
+	e.states[id] = conf
+	e.stateId++
+	verdict := notifyState(id, conf)
+	if verdict == Stop {
+		e.stopped = true
+	}
+	if verdict != Prune {
+		e.queue.PushBack(id)
+		if id != 0 {
+			e.depths[id] = e.depth + 1
+		}
+	}
+	if outputStream != nil {
+		return id, outputStream.writeState(id, conf)
+	}
+	return id, nil
+}
 
-	queue := list.New()
-	queue.PushBack(root)
-	dequeue := func() Configuration {
-		c := queue.Front()
-		queue.Remove(c)
-		return c.Value.(Configuration)
+// addTransition adds the transition to a configuration, or streams it.
+func (e *exploration) addTransition(trn Transition, dst Configuration) error {
+	e.transitions++
+	notifyTransition(trn)
+	if outputStream != nil {
+		return outputStream.writeTransition(trn, dst)
 	}
+	e.trns = append(e.trns, trn)
+	return nil
+}
 
-	var statesExplored int
-	var statesGenerated int
+// explore generates the LTS by a breadth-first traversal from the root
+// configuration, or from the checkpoint being resumed. If the context is done
+// or the memory limit is exceeded, the exploration stops and the partial LTS
+// is returned with the states left in the queue as the frontier.
+//
+// If an output stream is set, states and transitions are written to it as
+// they are discovered, and explored states and transitions are not kept in
+// the returned LTS.
+func explore(ctx context.Context, root Configuration) (Lts, error) {
+	if symmetryReduction {
+		initSymmetryReduction(root)
+	}
+	normalise := func(conf Configuration) Configuration {
+		conf = observeCiphertext(conf)
+		conf = applyStructrualCongruence(conf)
+		if symmetryReduction {
+			start := startPhase()
+			conf = reduceSymmetry(conf)
+			endPhase(phaseSymmetry, start)
+		}
+		return conf
+	}
+
+	sortError = nil
+	var e *exploration
+	if resumeFile != "" {
+		var err error
+		if e, err = readCheckpoint(resumeFile, root); err != nil {
+			return Lts{}, err
+		}
+	} else {
+		e = newExploration()
+		if _, err := e.addState(normalise(root)); err != nil {
+			return Lts{}, err
+		}
+	}
+
+	dequeue := func() int {
+		c := e.queue.Front()
+		e.queue.Remove(c)
+		id := c.Value.(int)
+		e.depth = e.depths[id]
+		delete(e.depths, id)
+		return id
+	}
+	start := time.Now()
+	lastCheckpoint := start
+	var interrupted error
 
 	// BFS traversal state exploration.
-	for queue.Len() > 0 && statesExplored < maxStatesExplored {
-		state := dequeue()
+	for e.queue.Len() > 0 && e.statesExplored < maxStatesExplored {
+		if e.stopped {
+			interrupted = errObserverStop
+			break
+		}
+		if interrupted = checkLimits(ctx, e.statesExplored); interrupted != nil {
+			break
+		}
+		if checkpointFile != "" && time.Since(lastCheckpoint) >= checkpointInterval {
+			if err := writeCheckpoint(checkpointFile, root, e); err != nil {
+				return Lts{}, err
+			}
+			lastCheckpoint = time.Now()
+		}
 
-		srcId := visited[getConfigurationKey(state)]
+		srcId := dequeue()
+		state := e.states[srcId]
 
 		if len(state.Registers.Registers) > registerSize {
-			regSizeReached[srcId] = true
+			e.regSizeReached[srcId] = true
+			notifyRegisterLimit(srcId)
 		} else {
-			confs := trans(state)
+			var confs []Configuration
+			// The ample sets do not account for the instantiation of
+			// variables.
+			if partialOrderReduction && !((symbolicSemantics || lateSemantics) && len(getVariables(state.Process)) > 0) {
+				start := startPhase()
+				var unfolds *unfoldings
+				confs, unfolds = ampleTrans(state)
+				endPhase(phaseTrans, start)
+				// Cycle proviso: the state is fully expanded if the ample
+				// set leads to a visited state, so that no transition is
+				// ignored along a cycle.
+				for _, conf := range confs {
+					_, dstKey := e.terms.internConfiguration(normalise(conf))
+					if _, ok := e.visited[dstKey]; ok {
+						confs = nil
+						break
+					}
+				}
+				if confs != nil {
+					notifyUnfolds(unfolds)
+				}
+			}
+			if confs == nil {
+				start := startPhase()
+				unfolds := newUnfoldings()
+				recordedUnfolds = unfolds
+				confs = getStateTrans(state)
+				recordedUnfolds = nil
+				endPhase(phaseTrans, start)
+				notifyUnfolds(unfolds)
+				if closedSystem && reportBarbs {
+					e.barbs[srcId] = getBarbs(confs)
+				}
+			} else if closedSystem && reportBarbs {
+				// The barbs are the visible actions of every transition,
+				// not only of the ample set.
+				e.barbs[srcId] = getBarbs(getStateTrans(state))
+			}
+			if sortError != nil {
+				return Lts{}, fmt.Errorf("s%d: %s", srcId, sortError)
+			}
+			if closedSystem {
+				confs = getTauTrans(confs)
+			}
+			// Transitions all have this source, so duplicates are only
+			// among these.
+			trnsSeen := make(map[Transition]bool)
 			for _, conf := range confs {
-				statesGenerated++
-				applyStructrualCongruence(conf)
-				dstKey := getConfigurationKey(conf)
-				if _, ok := visited[dstKey]; !ok {
-					visited[dstKey] = stateId
-					states[stateId] = conf
-					stateId++
-					queue.PushBack(conf)
+				e.statesGenerated++
+				conf = normalise(conf)
+				dstId, err := e.addState(conf)
+				if err != nil {
+					return Lts{}, err
 				}
 				trn := Transition{
 					Source:      srcId,
-					Destination: visited[dstKey],
+					Destination: dstId,
 					Label:       conf.Label,
 				}
 				if !trnsSeen[trn] {
 					trnsSeen[trn] = true
-					trns = append(trns, trn)
+					if err := e.addTransition(trn, conf); err != nil {
+						return Lts{}, err
+					}
 				}
 			}
 		}
 
-		statesExplored++
+		if outputStream != nil {
+			delete(e.states, srcId)
+			if err := outputStream.flush(); err != nil {
+				return Lts{}, err
+			}
+		}
+		e.statesExplored++
+
+		if observers != nil {
+			notifyProgress(Stats{
+				StatesExplored:  e.statesExplored,
+				StatesGenerated: e.statesGenerated,
+				StatesUnique:    e.stateId,
+				Transitions:     e.transitions,
+				StatesQueued:    e.queue.Len(),
+				Depth:           e.depth,
+				Elapsed:         time.Since(start),
+			})
+		}
+	}
+	if interrupted == nil && e.stopped {
+		interrupted = errObserverStop
+	}
+
+	if checkpointFile != "" {
+		if err := writeCheckpoint(checkpointFile, root, e); err != nil {
+			return Lts{}, err
+		}
+	}
+
+	frontier := make(map[int]bool)
+	if interrupted != nil {
+		for c := e.queue.Front(); c != nil; c = c.Next() {
+			frontier[c.Value.(int)] = true
+		}
 	}
 
 	return Lts{
-		States:          states,
-		Transitions:     trns,
-		RegSizeReached:  regSizeReached,
-		StatesExplored:  statesExplored,
-		StatesGenerated: statesGenerated,
+		States:            e.states,
+		Transitions:       e.trns,
+		RegSizeReached:    e.regSizeReached,
+		Barbs:             e.barbs,
+		Frontier:          frontier,
+		Interrupted:       interrupted,
+		StatesExplored:    e.statesExplored,
+		StatesGenerated:   e.statesGenerated,
+		StatesUnique:      e.stateId,
+		TransitionsUnique: e.transitions,
+	}, nil
+}
+
+// getStateTrans returns the transitions of a state in the semantics of the
+// exploration, with the transitions the environment cannot take removed.
+func getStateTrans(state Configuration) []Configuration {
+	var confs []Configuration
+	if symbolicSemantics {
+		confs = symbolicTrans(state)
+	} else if lateSemantics {
+		confs = lateTrans(state)
+	} else {
+		confs = trans(state)
 	}
+	return getEnvironmentTrans(state, confs)
+}
+
+// checkLimits returns the reason the exploration must stop, or nil.
+func checkLimits(ctx context.Context, statesExplored int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if maxMemory > 0 && statesExplored%memoryCheckInterval == 0 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		if m.HeapAlloc > maxMemory {
+			return errMemoryLimit
+		}
+	}
+	return nil
 }
 
 func generateGraphVizFile(lts Lts, outputStateNo bool) []byte {
@@ -146,7 +406,8 @@ func generateGraphVizFile(lts Lts, outputStateNo bool) []byte {
 		if outputStateNo {
 			config = "s" + strconv.Itoa(id)
 		} else {
-			config = prettyPrintRegister(conf.Registers) + " ⊢\n" + PrettyPrintAst(conf.Process)
+			config = prettyPrintRegister(conf.Registers) + " ⊢\n" + PrettyPrintAst(conf.Process) +
+				prettyPrintBarbs(lts, id, "\n")
 		}
 
 		var layout string
@@ -156,6 +417,9 @@ func generateGraphVizFile(lts Lts, outputStateNo bool) []byte {
 		if lts.RegSizeReached[id] {
 			layout = layout + "peripheries=3,"
 		}
+		if lts.Frontier[id] {
+			layout = layout + "style=dashed,"
+		}
 
 		vertex := VertexTemplate{
 			State:  "s" + strconv.Itoa(id),
@@ -187,12 +451,31 @@ func generateGraphVizFile(lts Lts, outputStateNo bool) []byte {
 }
 
 func prettyPrintGraphLabel(label Label) string {
+	return prettyPrintGraphAction(label) + prettyPrintRelabelling(label)
+}
+
+func prettyPrintGraphAction(label Label) string {
 	if label.Symbol.Type == SymbolTypTau {
 		return "τ"
 	}
+	if label.Symbol.Type == SymbolTypVariable {
+		if label.Symbol2.Type == SymbolTypDistinct {
+			return prettyPrintGraphSymbol(label.Symbol) + "≠" + prettyPrintGraphSymbol(label.Symbol2)
+		}
+		return prettyPrintGraphSymbol(label.Symbol) + "=" + prettyPrintGraphSymbol(label.Symbol2)
+	}
 	return prettyPrintGraphSymbol(label.Symbol) + prettyPrintGraphSymbol(label.Symbol2)
 }
 
+// prettyPrintRelabelling returns the relabelling of the registers of a
+// label, if any.
+func prettyPrintRelabelling(label Label) string {
+	if label.Relabelling == "" {
+		return ""
+	}
+	return " [" + label.Relabelling + "]"
+}
+
 func prettyPrintGraphSymbol(symbol Symbol) string {
 	s := symbol.Value
 	switch symbol.Type {
@@ -206,8 +489,16 @@ func prettyPrintGraphSymbol(symbol Symbol) string {
 		return strconv.Itoa(s) + "⊛"
 	case SymbolTypTau:
 		return "τ"
-	case SymbolTypKnown:
+	case SymbolTypKnown, SymbolTypDistinct:
 		return strconv.Itoa(s)
+	case SymbolTypVariable:
+		return varPrefix + strconv.Itoa(s)
+	case SymbolTypBoundInput:
+		return "(" + strconv.Itoa(s) + ")"
+	case SymbolTypBool, SymbolTypInt:
+		return "=" + prettyPrintDataSymbol(symbol)
+	case SymbolTypCipher:
+		return symbol.Cipher
 	}
 	return ""
 }
@@ -256,6 +547,9 @@ func generateGraphVizTexFile(lts Lts, outputStateNo bool) []byte {
 		if lts.RegSizeReached[id] {
 			layout = layout + `style="thick",`
 		}
+		if lts.Frontier[id] {
+			layout = layout + `style="dashed",`
+		}
 
 		vertex := VertexTemplate{
 			State:  "s" + strconv.Itoa(id),
@@ -303,6 +597,9 @@ func prettyPrintTexRegister(register Registers) string {
 }
 
 func getTexName(name string) string {
+	if string(name[0]) == "{" {
+		return getTexCipherName(name)
+	}
 	if string(name[0]) == "#" {
 		return "a" + "_{" + name[1:] + "}"
 	}
@@ -312,6 +609,9 @@ func getTexName(name string) string {
 	if string(name[0]) == "_" {
 		return name[1:]
 	}
+	if string(name[0]) == varPrefix {
+		return "v" + "_{" + name[1:] + "}"
+	}
 	return name
 }
 
@@ -332,8 +632,12 @@ func prettyPrintTexAstAcc(elem Element, str string) string {
 		return prettyPrintTexAstAcc(outElem.Next, str)
 	case ElemTypInput:
 		inpElem := elem.(*ElemInput)
+		input := getTexName(inpElem.Input.Name)
+		if inpElem.Sort.Type != SortAny {
+			input += ` : \mathtt{` + inpElem.Sort.String() + `}`
+		}
 		str += fmt.Sprintf(`%s ( %s ) . `,
-			getTexName(inpElem.Channel.Name), getTexName(inpElem.Input.Name))
+			getTexName(inpElem.Channel.Name), input)
 		return prettyPrintTexAstAcc(inpElem.Next, str)
 	case ElemTypMatch:
 		matchElem := elem.(*ElemEquality)
@@ -345,6 +649,25 @@ func prettyPrintTexAstAcc(elem Element, str string) string {
 				getTexName(matchElem.NameL.Name), getTexName(matchElem.NameR.Name))
 		}
 		return prettyPrintTexAstAcc(matchElem.Next, str)
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		str += fmt.Sprintf(`\lbrack %s \rbrack . `, prettyPrintTexGuard(guardElem.Guard))
+		return prettyPrintTexAstAcc(guardElem.Next, str)
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		str += fmt.Sprintf(`\mathsf{let} \ %s = %s \ \mathsf{in} \ `,
+			getTexName(letElem.Var.Name), prettyPrintTexExpr(letElem.Expr))
+		return prettyPrintTexAstAcc(letElem.Next, str)
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		op := "="
+		if ifElem.Inequality {
+			op = `\neq`
+		}
+		procThen := prettyPrintTexAstAcc(ifElem.Then, "")
+		procElse := prettyPrintTexAstAcc(ifElem.Else, "")
+		str += fmt.Sprintf(`( \mathsf{if} \ %s %s %s \ \mathsf{then} \ %s \ \mathsf{else} \ %s )`,
+			getTexName(ifElem.NameL.Name), op, getTexName(ifElem.NameR.Name), procThen, procElse)
 	case ElemTypRestriction:
 		resElem := elem.(*ElemRestriction)
 		str += fmt.Sprintf(`\nu %s . `,
@@ -383,9 +706,23 @@ func prettyPrintTexAstAcc(elem Element, str string) string {
 }
 
 func prettyPrintTexGraphLabel(label Label) string {
+	relabelling := ""
+	if label.Relabelling != "" {
+		relabelling = ` \, [` + strings.ReplaceAll(label.Relabelling, "→", ` \mapsto `) + `]`
+	}
+	return prettyPrintTexGraphAction(label) + relabelling
+}
+
+func prettyPrintTexGraphAction(label Label) string {
 	if label.Symbol.Type == SymbolTypTau {
 		return `\tau`
 	}
+	if label.Symbol.Type == SymbolTypVariable {
+		if label.Symbol2.Type == SymbolTypDistinct {
+			return prettyPrintTexGraphSymbol(label.Symbol) + ` \neq ` + prettyPrintTexGraphSymbol(label.Symbol2)
+		}
+		return prettyPrintTexGraphSymbol(label.Symbol) + ` = ` + prettyPrintTexGraphSymbol(label.Symbol2)
+	}
 	return prettyPrintTexGraphSymbol(label.Symbol) + ` \, ` + prettyPrintTexGraphSymbol(label.Symbol2)
 }
 
@@ -402,8 +739,16 @@ func prettyPrintTexGraphSymbol(symbol Symbol) string {
 		return strconv.Itoa(s) + `^{\circledast}`
 	case SymbolTypTau:
 		return `\tau`
-	case SymbolTypKnown:
+	case SymbolTypKnown, SymbolTypDistinct:
 		return strconv.Itoa(s)
+	case SymbolTypVariable:
+		return "v_{" + strconv.Itoa(s) + "}"
+	case SymbolTypBoundInput:
+		return "(" + strconv.Itoa(s) + ")"
+	case SymbolTypBool, SymbolTypInt:
+		return `{=}\mathtt{` + prettyPrintDataSymbol(symbol) + `}`
+	case SymbolTypCipher:
+		return texCipherReplacer.Replace(symbol.Cipher)
 	}
 	return ""
 }
@@ -424,9 +769,13 @@ func generatePrettyLts(lts Lts) []byte {
 	if lts.RegSizeReached[0] {
 		rootR = "+"
 	}
+	if lts.Frontier[0] {
+		rootR = rootR + "?"
+	}
 
 	rootString := "s0" + rootR + " = " +
-		prettyPrintRegister(root.Registers) + " |- " + PrettyPrintAst(root.Process)
+		prettyPrintRegister(root.Registers) + " |- " + PrettyPrintAst(root.Process) +
+		prettyPrintBarbs(lts, 0, "  ")
 	buffer.WriteString(rootString)
 
 	// Prevent extraneous new line if there are no edges.
@@ -440,13 +789,20 @@ func generatePrettyLts(lts Lts) []byte {
 		if lts.RegSizeReached[edge.Source] {
 			srcR = "+"
 		}
+		if lts.Frontier[edge.Source] {
+			srcR = srcR + "?"
+		}
 		dstR := ""
 		if lts.RegSizeReached[edge.Destination] {
 			dstR = "+"
 		}
+		if lts.Frontier[edge.Destination] {
+			dstR = dstR + "?"
+		}
 		transString := "s" + strconv.Itoa(edge.Source) + srcR + "  " +
 			prettyPrintLabel(edge.Label) + "  s" + strconv.Itoa(edge.Destination) + dstR + " = " +
-			prettyPrintRegister(vertex.Registers) + " |- " + PrettyPrintAst(vertex.Process)
+			prettyPrintRegister(vertex.Registers) + " |- " + PrettyPrintAst(vertex.Process) +
+			prettyPrintBarbs(lts, edge.Destination, "  ")
 		buffer.WriteString(transString)
 
 		// Prevent extraneous new line at last edge.
@@ -483,9 +839,22 @@ func prettyPrintRegister(register Registers) string {
 }
 
 func prettyPrintLabel(label Label) string {
+	if label.Relabelling != "" {
+		return strings.TrimSpace(prettyPrintAction(label)) + prettyPrintRelabelling(label)
+	}
+	return prettyPrintAction(label)
+}
+
+func prettyPrintAction(label Label) string {
 	if label.Symbol.Type == SymbolTypTau {
 		return "t   "
 	}
+	if label.Symbol.Type == SymbolTypVariable {
+		if label.Symbol2.Type == SymbolTypDistinct {
+			return prettyPrintSymbol(label.Symbol) + "!=" + prettyPrintSymbol(label.Symbol2)
+		}
+		return prettyPrintSymbol(label.Symbol) + "=" + prettyPrintSymbol(label.Symbol2)
+	}
 	return prettyPrintSymbol(label.Symbol) + prettyPrintSymbol(label.Symbol2)
 }
 
@@ -502,8 +871,16 @@ func prettyPrintSymbol(symbol Symbol) string {
 		return strconv.Itoa(s) + "^"
 	case SymbolTypTau:
 		return "t   "
-	case SymbolTypKnown:
+	case SymbolTypKnown, SymbolTypDistinct:
 		return strconv.Itoa(s) + " "
+	case SymbolTypVariable:
+		return varPrefix + strconv.Itoa(s)
+	case SymbolTypBoundInput:
+		return "(" + strconv.Itoa(s) + ")"
+	case SymbolTypBool, SymbolTypInt:
+		return "=" + prettyPrintDataSymbol(symbol) + " "
+	case SymbolTypCipher:
+		return symbol.Cipher + " "
 	}
 	return ""
 }
@@ -0,0 +1,42 @@
+package pifra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExploreInterrupted(t *testing.T) {
+	maxStatesExplored = 100
+	defer func() {
+		maxStatesExplored = 1
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	lts, err := generateLts(ctx, []byte(`a(x).0 | b(y).0`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lts.Interrupted != context.Canceled {
+		t.Errorf("interrupted: %v, expected: %v", lts.Interrupted, context.Canceled)
+	}
+	if lts.StatesExplored != 0 || len(lts.States) != 1 || !lts.Frontier[0] {
+		t.Errorf("states explored: %d, states: %d, frontier: %v",
+			lts.StatesExplored, len(lts.States), lts.Frontier)
+	}
+	output := string(generatePrettyLts(lts))
+	expected := "s0? = {(1,#1),(2,#2)} |- (#1(&1).0 | #2(&2).0)"
+	if output != expected {
+		t.Errorf("output: %s, expected: %s", output, expected)
+	}
+}
+
+func TestExploreNotInterrupted(t *testing.T) {
+	maxStatesExplored = 100
+	defer func() {
+		maxStatesExplored = 1
+	}()
+	lts, _ := generateLts(context.Background(), []byte(`a(x).0 | b(y).0`))
+	if lts.Interrupted != nil || len(lts.Frontier) != 0 {
+		t.Errorf("interrupted: %v, frontier: %v", lts.Interrupted, lts.Frontier)
+	}
+}
@@ -0,0 +1,151 @@
+package pifra
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Verdict is the decision of an observer on a discovered state.
+type Verdict int
+
+const (
+	// Continue explores the state.
+	Continue Verdict = iota
+	// Prune keeps the state in the LTS without exploring it.
+	Prune
+	// Stop interrupts the exploration.
+	Stop
+)
+
+// Stats are the statistics of an exploration in progress.
+type Stats struct {
+	StatesExplored  int
+	StatesGenerated int
+	StatesUnique    int
+	Transitions     int
+	// Number of states waiting to be explored.
+	StatesQueued int
+	// BFS depth of the last explored state.
+	Depth   int
+	Elapsed time.Duration
+}
+
+// Observer is notified of the events of an exploration. Callbacks are invoked
+// from the exploring goroutine, so they should return quickly.
+type Observer interface {
+	// OnState is called when a state is discovered. The verdict decides
+	// whether the state is explored.
+	OnState(id int, conf Configuration) Verdict
+	// OnTransition is called when a transition is added to the LTS.
+	OnTransition(trn Transition)
+	// OnRegisterLimit is called when a state is not explored because its
+	// registers exceed the maximum number of registers.
+	OnRegisterLimit(id int)
+	// OnUnfold is called when a process constant is unfolded to compute
+	// the transitions of a state.
+	OnUnfold(process string)
+	// OnProgress is called after each state is explored.
+	OnProgress(stats Stats)
+}
+
+// BaseObserver implements Observer with callbacks that do nothing. It can be
+// embedded to implement only some of the callbacks.
+type BaseObserver struct{}
+
+func (BaseObserver) OnState(id int, conf Configuration) Verdict {
+	return Continue
+}
+
+func (BaseObserver) OnTransition(trn Transition) {}
+
+func (BaseObserver) OnRegisterLimit(id int) {}
+
+func (BaseObserver) OnUnfold(process string) {}
+
+func (BaseObserver) OnProgress(stats Stats) {}
+
+// Observers of the current exploration.
+var observers []Observer
+
+var errObserverStop = errors.New("stopped by observer")
+
+// GenerateLts generates the LTS of the pi-calculus program with the options
+// of the flags, notifying the observers of the events of the exploration.
+func GenerateLts(ctx context.Context, input []byte, flags Flags, obs ...Observer) (Lts, error) {
+	initFlags(flags)
+	observers = obs
+	defer func() {
+		observers = nil
+	}()
+	return generateLts(ctx, input)
+}
+
+// notifyState returns the verdict on the state, which is Stop if any observer
+// stops, otherwise Prune if any observer prunes.
+func notifyState(id int, conf Configuration) Verdict {
+	verdict := Continue
+	for _, o := range observers {
+		if v := o.OnState(id, conf); v > verdict {
+			verdict = v
+		}
+	}
+	return verdict
+}
+
+func notifyTransition(trn Transition) {
+	for _, o := range observers {
+		o.OnTransition(trn)
+	}
+}
+
+func notifyRegisterLimit(id int) {
+	for _, o := range observers {
+		o.OnRegisterLimit(id)
+	}
+}
+
+// unfoldings are the calls of process constants unfolded to compute the
+// transitions of a state. The rules of parallel composition compute the
+// transitions of the components more than once, so each call is recorded
+// once, and the processes are notified after the transitions are chosen.
+type unfoldings struct {
+	calls     map[string]bool
+	processes []string
+}
+
+func newUnfoldings() *unfoldings {
+	return &unfoldings{
+		calls: make(map[string]bool),
+	}
+}
+
+// Unfoldings of the transitions being computed, or nil if they are not
+// recorded.
+var recordedUnfolds *unfoldings
+
+// recordUnfold records the unfolding of a call of a process constant.
+func recordUnfold(procElem *ElemProcess) {
+	if recordedUnfolds == nil {
+		return
+	}
+	call := PrettyPrintAst(procElem)
+	if !recordedUnfolds.calls[call] {
+		recordedUnfolds.calls[call] = true
+		recordedUnfolds.processes = append(recordedUnfolds.processes, procElem.Name)
+	}
+}
+
+func notifyUnfolds(unfolds *unfoldings) {
+	for _, process := range unfolds.processes {
+		for _, o := range observers {
+			o.OnUnfold(process)
+		}
+	}
+}
+
+func notifyProgress(stats Stats) {
+	for _, o := range observers {
+		o.OnProgress(stats)
+	}
+}
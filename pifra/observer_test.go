@@ -0,0 +1,198 @@
+package pifra
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type testObserver struct {
+	BaseObserver
+	states      int
+	transitions int
+	unfolds     map[string]int
+	limits      int
+	progress    []Stats
+	verdict     func(id int, conf Configuration) Verdict
+}
+
+func (o *testObserver) OnState(id int, conf Configuration) Verdict {
+	o.states++
+	if o.verdict != nil {
+		return o.verdict(id, conf)
+	}
+	return Continue
+}
+
+func (o *testObserver) OnTransition(trn Transition) {
+	o.transitions++
+}
+
+func (o *testObserver) OnRegisterLimit(id int) {
+	o.limits++
+}
+
+func (o *testObserver) OnUnfold(process string) {
+	o.unfolds[process]++
+}
+
+func (o *testObserver) OnProgress(stats Stats) {
+	o.progress = append(o.progress, stats)
+}
+
+func TestObserver(t *testing.T) {
+	input := []byte(`
+P(a) = a(x).Q(x)
+Q(a) = a'<a>.P(a)
+P(a)
+`)
+	flags := Flags{
+		MaxStates:    20,
+		RegisterSize: 1073741824,
+	}
+
+	o := &testObserver{
+		unfolds: make(map[string]int),
+	}
+	lts, err := GenerateLts(context.Background(), input, flags, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.states != len(lts.States) || o.transitions != len(lts.Transitions) {
+		t.Errorf("states: %d, transitions: %d, expected: %d, %d",
+			o.states, o.transitions, len(lts.States), len(lts.Transitions))
+	}
+	// Each explored state unfolds its call once.
+	if o.unfolds["P"] != 1 || o.unfolds["Q"] != 1 {
+		t.Errorf("unfolds: %v", o.unfolds)
+	}
+	if len(o.progress) != lts.StatesExplored {
+		t.Errorf("progress: %d, expected: %d", len(o.progress), lts.StatesExplored)
+	}
+	last := o.progress[len(o.progress)-1]
+	if last.StatesUnique != lts.StatesUnique || last.Transitions != lts.TransitionsUnique {
+		t.Errorf("progress: %+v", last)
+	}
+
+	// Pruned states are not explored.
+	o = &testObserver{
+		unfolds: make(map[string]int),
+		verdict: func(id int, conf Configuration) Verdict {
+			if id > 0 {
+				return Prune
+			}
+			return Continue
+		},
+	}
+	lts, _ = GenerateLts(context.Background(), input, flags, o)
+	if lts.StatesExplored != 1 || lts.Interrupted != nil {
+		t.Errorf("states explored: %d, interrupted: %v", lts.StatesExplored, lts.Interrupted)
+	}
+
+	// Stopping interrupts the exploration.
+	o = &testObserver{
+		unfolds: make(map[string]int),
+		verdict: func(id int, conf Configuration) Verdict {
+			if id == 1 {
+				return Stop
+			}
+			return Continue
+		},
+	}
+	lts, _ = GenerateLts(context.Background(), input, flags, o)
+	if lts.StatesExplored != 1 || lts.Interrupted != errObserverStop || !lts.Frontier[1] {
+		t.Errorf("states explored: %d, interrupted: %v, frontier: %v",
+			lts.StatesExplored, lts.Interrupted, lts.Frontier)
+	}
+
+	// States exceeding the registers are reported.
+	flags.RegisterSize = 0
+	o = &testObserver{
+		unfolds: make(map[string]int),
+	}
+	GenerateLts(context.Background(), input, flags, o)
+	if o.limits == 0 {
+		t.Error("register limit not reported")
+	}
+}
+
+func TestObserverUnfolds(t *testing.T) {
+	tests := map[string]struct {
+		input   []byte
+		unfolds map[string]int
+	}{
+		"call": {
+			input: []byte(`P(a)`),
+			unfolds: map[string]int{
+				"P": 1,
+			},
+		},
+		"parallel": {
+			input: []byte(`P(a) | P(b)`),
+			unfolds: map[string]int{
+				"P": 2,
+			},
+		},
+		"nested_parallel": {
+			input: []byte(`P(a) | (P(b) | P(c))`),
+			unfolds: map[string]int{
+				"P": 3,
+			},
+		},
+		"nested_call": {
+			input: []byte(`Q(a) | P(b)`),
+			unfolds: map[string]int{
+				"P": 2,
+				"Q": 1,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := append([]byte(`
+P(a) = a(x).0
+Q(a) = P(a) | P(a)
+`), tc.input...)
+			o := &testObserver{
+				unfolds: make(map[string]int),
+			}
+			// Only the root is explored.
+			flags := Flags{
+				MaxStates:    1,
+				RegisterSize: 1073741824,
+			}
+			if _, err := GenerateLts(context.Background(), input, flags, o); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(o.unfolds, tc.unfolds) {
+				t.Errorf("unfolds: %v, expected: %v", o.unfolds, tc.unfolds)
+			}
+		})
+	}
+}
+
+func TestObserverUnfoldsPOR(t *testing.T) {
+	// The ample sets fall back to the full expansion of every state.
+	input := []byte(`
+P(a) = a(x).P(a)
+P(a) | P(b)
+`)
+	unfolds := func(por bool) map[string]int {
+		o := &testObserver{
+			unfolds: make(map[string]int),
+		}
+		flags := Flags{
+			MaxStates:    20,
+			RegisterSize: 1073741824,
+			POR:          por,
+		}
+		if _, err := GenerateLts(context.Background(), input, flags, o); err != nil {
+			t.Fatal(err)
+		}
+		return o.unfolds
+	}
+	expected := unfolds(false)
+	if output := unfolds(true); !reflect.DeepEqual(output, expected) {
+		t.Errorf("unfolds: %v, expected: %v", output, expected)
+	}
+}
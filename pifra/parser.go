@@ -6,16 +6,12 @@ package pifra
 import __yyfmt__ "fmt"
 
 //line parser.y:2
-var undeclaredProcs []Element
 
-var curProcParams []string
+var undeclaredProcs []Element
 
 // All elements
 var curElem Element // Tracks the current element chain
 
-// Process Constants element
-var curPconstNames []Name // Tracks the process constant names
-
 // Sum element
 var curSum Element         // Current sum process.
 var sumStack []Element     // Sum processes encountered.
@@ -32,37 +28,76 @@ var curParLevelStack []int // Saves curParLevel at different bracket levels.
 var numParStack []int      // Saves the maximum curParLevel at different bracket levels.
 // Used for knowing how many elements to pop from parStack.
 
-//line parser.y:31
+// Conditional element
+var ifStack []*ElemIf // Conditionals whose branches are being parsed.
+
+//line parser.y:29
 type yySymType struct {
-	yys  int
-	name string
+	yys   int
+	name  string
+	line  int
+	guard *Guard
+	value Name
+	expr  *Expr
+	sort  Sort
+	arg   argument
+	args  []argument
+	sorts []Sort
+	names []string
 }
 
 const NAME = 57346
-const LBRACKET = 57347
-const RBRACKET = 57348
-const LANGLE = 57349
-const RANGLE = 57350
-const LSQBRACKET = 57351
-const RSQBRACKET = 57352
-const COMMA = 57353
-const EQUAL = 57354
-const VERTBAR = 57355
-const DOT = 57356
-const COMMENT = 57357
-const ZERO = 57358
-const APOSTROPHE = 57359
-const DOLLARSIGN = 57360
-const PLUS = 57361
-const EXCLAMATION = 57362
-const LOWPREC = 57363
-const LOWER_THAN_LBRACKET = 57364
+const STRING = 57347
+const INT = 57348
+const LBRACKET = 57349
+const RBRACKET = 57350
+const LANGLE = 57351
+const RANGLE = 57352
+const LSQBRACKET = 57353
+const RSQBRACKET = 57354
+const COMMA = 57355
+const EQUAL = 57356
+const VERTBAR = 57357
+const DOT = 57358
+const COMMENT = 57359
+const ZERO = 57360
+const APOSTROPHE = 57361
+const DOLLARSIGN = 57362
+const PLUS = 57363
+const EXCLAMATION = 57364
+const IMPORT = 57365
+const MAIN = 57366
+const IF = 57367
+const THEN = 57368
+const ELSE = 57369
+const AND = 57370
+const OR = 57371
+const LET = 57372
+const IN = 57373
+const TRUE = 57374
+const FALSE = 57375
+const BOOL = 57376
+const COLON = 57377
+const DOTDOT = 57378
+const MINUS = 57379
+const ENC = 57380
+const DEC = 57381
+const CASE = 57382
+const OF = 57383
+const MARKED = 57384
+const ENV = 57385
+const LBRACE = 57386
+const RBRACE = 57387
+const LOWPREC = 57388
+const LOWER_THAN_LBRACKET = 57389
 
 var yyToknames = [...]string{
 	"$end",
 	"error",
 	"$unk",
 	"NAME",
+	"STRING",
+	"INT",
 	"LBRACKET",
 	"RBRACKET",
 	"LANGLE",
@@ -79,9 +114,33 @@ var yyToknames = [...]string{
 	"DOLLARSIGN",
 	"PLUS",
 	"EXCLAMATION",
+	"IMPORT",
+	"MAIN",
+	"IF",
+	"THEN",
+	"ELSE",
+	"AND",
+	"OR",
+	"LET",
+	"IN",
+	"TRUE",
+	"FALSE",
+	"BOOL",
+	"COLON",
+	"DOTDOT",
+	"MINUS",
+	"ENC",
+	"DEC",
+	"CASE",
+	"OF",
+	"MARKED",
+	"ENV",
+	"LBRACE",
+	"RBRACE",
 	"LOWPREC",
 	"LOWER_THAN_LBRACKET",
 }
+
 var yyStatenames = [...]string{}
 
 const yyEofCode = 1
@@ -89,98 +148,156 @@ const yyErrCode = 2
 const yyInitialStackSize = 16
 
 //line yacctab:1
-var yyExca = [...]int{
+var yyExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 47,
-	12, 8,
-	-2, 35,
-	-1, 67,
-	12, 8,
-	-2, 35,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 90
-
-var yyAct = [...]int{
-
-	7, 32, 34, 36, 19, 42, 6, 19, 20, 53,
-	27, 20, 23, 43, 26, 22, 28, 21, 22, 24,
-	21, 28, 27, 61, 25, 35, 48, 27, 26, 71,
-	41, 64, 44, 63, 78, 55, 45, 69, 25, 70,
-	51, 52, 70, 74, 65, 56, 57, 67, 58, 59,
-	47, 50, 46, 37, 75, 46, 66, 62, 60, 54,
-	49, 38, 68, 33, 31, 72, 73, 30, 29, 40,
-	39, 18, 76, 59, 17, 77, 16, 15, 14, 13,
-	12, 11, 10, 9, 8, 5, 4, 3, 2, 1,
+const yyLast = 256
+
+var yyAct = [...]uint8{
+	11, 69, 54, 131, 66, 48, 67, 64, 49, 50,
+	44, 45, 166, 79, 129, 73, 46, 95, 29, 155,
+	182, 180, 30, 10, 85, 91, 29, 40, 136, 35,
+	30, 34, 51, 60, 100, 62, 31, 35, 72, 34,
+	179, 32, 12, 13, 31, 113, 75, 160, 82, 32,
+	101, 33, 80, 100, 51, 100, 159, 81, 90, 33,
+	100, 14, 15, 135, 100, 136, 100, 162, 103, 101,
+	152, 101, 145, 96, 154, 124, 101, 109, 110, 111,
+	101, 107, 101, 100, 115, 146, 51, 51, 118, 102,
+	120, 122, 97, 116, 126, 117, 84, 130, 127, 101,
+	133, 128, 138, 139, 137, 133, 140, 83, 108, 99,
+	141, 142, 143, 134, 144, 57, 53, 119, 57, 100,
+	92, 147, 94, 148, 84, 149, 150, 58, 93, 151,
+	58, 78, 134, 41, 57, 101, 157, 158, 169, 40,
+	57, 156, 41, 132, 55, 56, 58, 163, 40, 79,
+	70, 71, 58, 165, 164, 167, 88, 89, 168, 133,
+	171, 86, 132, 174, 114, 161, 172, 173, 176, 87,
+	68, 41, 57, 74, 42, 98, 181, 40, 53, 105,
+	57, 133, 183, 184, 58, 104, 153, 53, 123, 57,
+	177, 112, 58, 178, 53, 63, 57, 121, 55, 56,
+	53, 58, 57, 52, 70, 71, 55, 56, 58, 106,
+	61, 39, 45, 43, 58, 55, 56, 47, 36, 77,
+	39, 38, 55, 56, 76, 37, 175, 125, 55, 56,
+	38, 59, 28, 27, 26, 25, 24, 23, 22, 21,
+	20, 19, 18, 17, 16, 9, 8, 7, 6, 5,
+	4, 3, 2, 1, 170, 65,
 }
-var yyPact = [...]int{
 
-	-1000, 2, -1000, -1000, -1000, -1000, 7, 8, -1000, -1000,
+var yyPact = [...]int16{
+	-1000, 19, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	211, 118, 169, 209, 208, -28, -1000, -1000, -1000, -1000,
 	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	63, 60, -1000, 59, -1, 46, 57, -1000, -1000, -1,
-	-7, 18, 24, 44, -1000, 8, 21, 56, 43, -1,
-	-1, 3, 55, 23, -1, -1, 54, 9, 53, 25,
-	17, -9, 8, -1000, 34, 52, -1000, 8, -1000, -1000,
-	41, -1, 31, 15, -1, -1, 33, -1000, -1000, 9,
-	50, -1, -1000, 8, -1, 28, -1000, 8, -1000,
+	196, 190, 206, 190, 191, -1000, 166, 11, 164, 112,
+	-1000, -1000, -1000, 117, 136, -1000, 7, 11, 95, -4,
+	-1000, 147, 196, -1000, -1000, -1000, -1000, -1000, -1000, -1,
+	106, 108, -24, 57, 167, 96, -1000, 45, 54, -1000,
+	178, 172, 118, 202, 112, 98, 11, 11, 11, 187,
+	-1000, 0, 156, 11, 196, 196, 190, 103, 183, 174,
+	67, -1000, 190, 84, 112, -30, 11, 109, 49, 166,
+	190, 190, 109, 112, 112, 112, 166, 62, 69, 6,
+	118, 118, -1000, -1000, -1000, 118, -4, -1000, -1000, 190,
+	-1000, 190, -1000, 190, -1000, 11, -1000, 190, 39, 182,
+	-1000, 58, -1000, -17, 132, 11, 11, -1000, -1000, -1000,
+	-1000, 45, 43, 34, 157, 51, 11, -1000, -1000, -1000,
+	127, -1000, 11, -33, 11, 134, 128, 118, -1000, 112,
+	112, 12, 11, -1000, -1000, -1000, 190, -1000, -1000, -1000,
+	180, -1000, 32, 13, -1000, 11, -11, -1000, 109, -1000,
+	-1000, -1000, 11, -1000, -1000,
 }
-var yyPgo = [...]int{
 
-	0, 89, 88, 87, 86, 85, 1, 0, 84, 83,
-	82, 81, 80, 79, 78, 77, 76, 74, 71, 70,
-	69, 2, 68,
+var yyPgo = [...]uint8{
+	0, 2, 5, 8, 9, 1, 6, 3, 4, 7,
+	255, 254, 10, 253, 252, 251, 250, 249, 248, 247,
+	246, 245, 0, 244, 243, 242, 241, 240, 239, 238,
+	237, 236, 235, 234, 233, 232, 231, 227, 226, 224,
+	219, 217,
 }
-var yyR1 = [...]int{
 
-	0, 1, 1, 2, 2, 2, 3, 6, 6, 4,
-	5, 7, 7, 7, 7, 7, 7, 7, 7, 7,
-	7, 7, 16, 11, 11, 12, 13, 14, 15, 19,
-	10, 20, 9, 18, 21, 21, 17, 22, 8,
+var yyR1 = [...]int8{
+	0, 13, 13, 14, 14, 14, 14, 14, 14, 14,
+	19, 18, 20, 21, 21, 12, 12, 15, 16, 17,
+	22, 22, 22, 22, 22, 22, 22, 22, 22, 22,
+	22, 22, 22, 33, 26, 26, 27, 28, 2, 2,
+	3, 3, 4, 4, 4, 4, 4, 4, 4, 37,
+	38, 29, 36, 36, 30, 31, 32, 32, 39, 25,
+	40, 24, 35, 9, 9, 10, 10, 8, 8, 8,
+	7, 7, 7, 7, 11, 11, 6, 6, 6, 6,
+	6, 5, 5, 5, 5, 1, 1, 34, 41, 23,
 }
-var yyR2 = [...]int{
 
-	0, 0, 2, 1, 1, 1, 5, 3, 2, 3,
+var yyR2 = [...]int8{
+	0, 0, 2, 1, 1, 1, 1, 1, 1, 1,
+	4, 2, 2, 3, 4, 1, 3, 6, 3, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	1, 1, 1, 7, 6, 6, 6, 7, 4, 0,
-	4, 0, 4, 3, 3, 2, 1, 0, 4,
+	1, 1, 1, 1, 7, 6, 6, 4, 3, 1,
+	3, 1, 3, 4, 3, 4, 3, 4, 3, 0,
+	0, 8, 3, 4, 6, 9, 4, 6, 0, 4,
+	0, 4, 4, 0, 1, 1, 3, 1, 3, 3,
+	1, 3, 3, 4, 1, 3, 1, 3, 3, 6,
+	6, 1, 1, 1, 1, 1, 1, 1, 0, 4,
 }
-var yyChk = [...]int{
-
-	-1000, -1, -2, -3, -4, -5, 4, -7, -8, -9,
-	-10, -11, -12, -13, -14, -15, -16, -17, -18, 5,
-	9, 18, 16, 5, 12, 17, 7, 19, 13, -22,
-	4, 4, -6, 4, -21, -7, 4, 7, 4, -19,
-	-20, -7, 12, 20, 14, 12, 11, 6, 5, 4,
-	8, -7, -7, 6, 4, 12, -7, -7, -6, -21,
-	4, 14, 4, 8, 14, 10, 4, 6, -7, 6,
-	11, 14, -7, -7, 10, 4, -7, -7, 6,
+
+var yyChk = [...]int16{
+	-1000, -13, -14, -15, -16, -17, -18, -19, -20, -21,
+	4, -22, 23, 24, 42, 43, -23, -24, -25, -26,
+	-27, -28, -29, -30, -31, -32, -33, -34, -35, 7,
+	11, 25, 30, 40, 20, 18, 7, 14, 19, 9,
+	21, 15, 5, 4, -12, 4, 44, -41, -2, -3,
+	-4, -5, 7, 4, -1, 32, 33, 6, 18, -36,
+	-5, 4, -5, 4, -9, -10, -8, -6, 4, -5,
+	38, 39, -22, 4, 9, -6, -39, -40, 14, 13,
+	45, -12, -22, 12, 29, 28, 14, 22, 9, 10,
+	-2, 26, 14, 22, 14, 41, 16, 35, 8, 13,
+	21, 37, 35, 14, 7, 7, 7, -6, 10, -22,
+	-22, -22, 4, 45, 8, -22, -3, -4, -5, 14,
+	-5, 14, -5, 14, 8, -37, -5, 14, -6, 44,
+	-22, -7, 34, -1, 4, 14, 16, -8, -5, -5,
+	-7, -6, -6, -6, -9, 10, 16, -5, -5, -5,
+	-22, -5, 31, 4, 16, 36, 9, -22, -22, 13,
+	13, 8, 16, -22, 27, -22, 45, -22, -1, 10,
+	-11, -7, -6, -6, -22, -38, -5, 10, 13, 8,
+	8, -22, 31, -7, -22,
 }
-var yyDef = [...]int{
-
-	1, -2, 2, 3, 4, 5, 36, 10, 11, 12,
-	13, 14, 15, 16, 17, 18, 19, 20, 21, 37,
-	0, 0, 22, 0, 0, 0, 0, 29, 31, 0,
-	0, 0, 0, 0, 33, 9, 36, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, -2, 0, 0,
-	0, 30, 32, 38, 0, 0, 28, 6, 7, 34,
-	0, 0, 0, 0, 0, 0, 0, -2, 25, 35,
-	0, 0, 24, 26, 0, 0, 23, 27, 35,
+
+var yyDef = [...]int8{
+	1, -2, 2, 3, 4, 5, 6, 7, 8, 9,
+	87, 19, 0, 0, 0, 0, 20, 21, 22, 23,
+	24, 25, 26, 27, 28, 29, 30, 31, 32, 88,
+	0, 0, 0, 0, 0, 33, 63, 0, 0, 0,
+	58, 60, 11, 0, 12, 15, 0, 0, 0, 39,
+	41, 0, 0, 81, 82, 83, 84, 85, 86, 0,
+	0, 0, 0, 0, 0, 64, 65, 67, 81, 76,
+	0, 0, 18, 87, 0, 0, 0, 0, 0, 0,
+	13, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 49, 0, 0, 0, 0, 0, 0, 62, 0,
+	0, 0, 0, 0, 0, 0, 63, 0, 0, 59,
+	61, 10, 16, 14, 89, 37, 38, 40, 42, 0,
+	44, 0, 46, 0, 48, 0, 52, 0, 0, 0,
+	56, 0, 70, 0, 0, 0, 0, 66, 77, 78,
+	68, 69, 0, 0, 0, 0, 0, 43, 45, 47,
+	0, 53, 0, 0, 0, 0, 0, 17, 36, 0,
+	0, 62, 0, 35, 50, 54, 0, 57, 71, 72,
+	0, 74, 0, 0, 34, 0, 0, 73, 0, 79,
+	80, 51, 0, 75, 55,
 }
-var yyTok1 = [...]int{
 
+var yyTok1 = [...]int8{
 	1,
 }
-var yyTok2 = [...]int{
 
+var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
-	22,
+	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47,
 }
-var yyTok3 = [...]int{
+
+var yyTok3 = [...]int8{
 	0,
 }
 
@@ -262,9 +379,9 @@ func yyErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := yyPact[state]
+	base := int(yyPact[state])
 	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
-		if n := base + tok; n >= 0 && n < yyLast && yyChk[yyAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -274,13 +391,13 @@ func yyErrorMessage(state, lookAhead int) string {
 
 	if yyDef[state] == -2 {
 		i := 0
-		for yyExca[i] != -1 || yyExca[i+1] != state {
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; yyExca[i] >= 0; i += 2 {
-			tok := yyExca[i]
+			tok := int(yyExca[i])
 			if tok < TOKSTART || yyExca[i+1] == 0 {
 				continue
 			}
@@ -311,30 +428,30 @@ func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = yyTok1[0]
+		token = int(yyTok1[0])
 		goto out
 	}
 	if char < len(yyTok1) {
-		token = yyTok1[char]
+		token = int(yyTok1[char])
 		goto out
 	}
 	if char >= yyPrivate {
 		if char < yyPrivate+len(yyTok2) {
-			token = yyTok2[char-yyPrivate]
+			token = int(yyTok2[char-yyPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(yyTok3); i += 2 {
-		token = yyTok3[i+0]
+		token = int(yyTok3[i+0])
 		if token == char {
-			token = yyTok3[i+1]
+			token = int(yyTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = yyTok2[1] /* unknown char */
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
@@ -389,7 +506,7 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	yyn = yyPact[yystate]
+	yyn = int(yyPact[yystate])
 	if yyn <= yyFlag {
 		goto yydefault /* simple state */
 	}
@@ -400,8 +517,8 @@ yynewstate:
 	if yyn < 0 || yyn >= yyLast {
 		goto yydefault
 	}
-	yyn = yyAct[yyn]
-	if yyChk[yyn] == yytoken { /* valid shift */
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
 		yyrcvr.char = -1
 		yytoken = -1
 		yyVAL = yyrcvr.lval
@@ -414,7 +531,7 @@ yynewstate:
 
 yydefault:
 	/* default state action */
-	yyn = yyDef[yystate]
+	yyn = int(yyDef[yystate])
 	if yyn == -2 {
 		if yyrcvr.char < 0 {
 			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
@@ -423,18 +540,18 @@ yydefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if yyExca[xi+0] == -1 && yyExca[xi+1] == yystate {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			yyn = yyExca[xi+0]
+			yyn = int(yyExca[xi+0])
 			if yyn < 0 || yyn == yytoken {
 				break
 			}
 		}
-		yyn = yyExca[xi+1]
+		yyn = int(yyExca[xi+1])
 		if yyn < 0 {
 			goto ret0
 		}
@@ -456,10 +573,10 @@ yydefault:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				yyn = yyPact[yyS[yyp].yys] + yyErrCode
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
 				if yyn >= 0 && yyn < yyLast {
-					yystate = yyAct[yyn] /* simulate a shift of "error" */
-					if yyChk[yystate] == yyErrCode {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -495,7 +612,7 @@ yydefault:
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= yyR2[yyn]
+	yyp -= int(yyR2[yyn])
 	// yyp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
@@ -506,172 +623,375 @@ yydefault:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	yyn = yyR1[yyn]
-	yyg := yyPgo[yyn]
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
 	yyj := yyg + yyS[yyp].yys + 1
 
 	if yyj >= yyLast {
-		yystate = yyAct[yyg]
+		yystate = int(yyAct[yyg])
 	} else {
-		yystate = yyAct[yyj]
-		if yyChk[yystate] != -yyn {
-			yystate = yyAct[yyg]
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
 	}
 	// dummy call; replaced with literal code
 	switch yynt {
 
-	case 6:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.y:72
+	case 10:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:119
 		{
-			// Reverse order of curProcParams
-			for i := len(curProcParams)/2 - 1; i >= 0; i-- {
-				j := len(curProcParams) - 1 - i
-				curProcParams[i], curProcParams[j] = curProcParams[j], curProcParams[i]
-			}
-			name := yyDollar[1].name
-			DeclaredProcs[name] = DeclaredProcess{
-				Process:    curElem,
-				Parameters: curProcParams,
-			}
+			declareEntry(yyDollar[2].name, curElem, yyDollar[1].line)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind: declEntry,
+				line: yyDollar[1].line,
+				name: yyDollar[2].name,
+				proc: curElem,
+			})
 			curElem = nil
-			curProcParams = []string{}
 
-			Log("pconst decl")
+			Log("entry:", yyDollar[2].name)
 		}
-	case 7:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:91
+	case 11:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.y:134
 		{
-			curProcParams = append(curProcParams, yyDollar[1].name)
+			imports = append(imports, importDecl{
+				file: yyDollar[2].name,
+				line: yyDollar[1].line,
+			})
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind: declImport,
+				line: yyDollar[1].line,
+				name: yyDollar[2].name,
+			})
+
+			Log("import:", yyDollar[2].name)
 		}
-	case 8:
+	case 12:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:96
+//line parser.y:150
 		{
-			curProcParams = append(curProcParams, yyDollar[1].name)
+			declareMarkedNames(yyDollar[2].names)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind:  declMarked,
+				line:  yyDollar[1].line,
+				names: yyDollar[2].names,
+			})
+			Log(append([]string{"marked:"}, yyDollar[2].names...)...)
 		}
-	case 9:
+	case 13:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:102
+//line parser.y:162
+		{
+			declareEnvNames([]string{})
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind: declEnv,
+				line: yyDollar[1].line,
+			})
+			Log("env:")
+		}
+	case 14:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:172
+		{
+			declareEnvNames(yyDollar[3].names)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind:  declEnv,
+				line:  yyDollar[1].line,
+				names: yyDollar[3].names,
+			})
+			Log(append([]string{"env:"}, yyDollar[3].names...)...)
+		}
+	case 15:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:184
+		{
+			yyVAL.names = []string{yyDollar[1].name}
+		}
+	case 16:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:189
+		{
+			yyVAL.names = append(yyDollar[1].names, yyDollar[3].name)
+		}
+	case 17:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.y:195
+		{
+			params, sorts := getParameters(yyDollar[3].args, yyDollar[1].line)
+			declareProcess(yyDollar[1].name, DeclaredProcess{
+				Process:    curElem,
+				Parameters: params,
+				Sorts:      sorts,
+			}, yyDollar[1].line)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind:   declProcess,
+				line:   yyDollar[1].line,
+				name:   yyDollar[1].name,
+				params: params,
+				sorts:  sorts,
+				proc:   curElem,
+			})
+			curElem = nil
+
+			Log("pconst decl")
+		}
+	case 18:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:217
 		{
 			name := yyDollar[1].name
-			DeclaredProcs[name] = DeclaredProcess{
+			declareProcess(name, DeclaredProcess{
 				Process:    curElem,
 				Parameters: []string{},
-			}
+			}, yyDollar[1].line)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind: declProcess,
+				line: yyDollar[1].line,
+				name: name,
+				proc: curElem,
+			})
 			curElem = nil
 
 			Log("process")
 		}
-	case 10:
+	case 19:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:115
+//line parser.y:236
 		{
 			undeclaredProcs = append(undeclaredProcs, curElem)
+			sourceDecls = append(sourceDecls, sourceDecl{
+				kind: declUndeclared,
+				line: yyDollar[1].line,
+				proc: curElem,
+			})
 			curElem = nil
 		}
-	case 22:
+	case 33:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:145
+//line parser.y:275
 		{
 			Log("nil")
 			curElem = &ElemNil{}
 		}
-	case 23:
+	case 34:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line parser.y:152
+//line parser.y:282
 		{
-			channel := yyDollar[1].name
-			output := yyDollar[4].name
-			outputElem := &ElemOutput{
-				Channel: Name{
-					Name: channel,
-				},
-				Output: Name{
-					Name: output,
-				},
-				Next: curElem,
-			}
-			curElem = outputElem
-
-			Log("out:", channel, output)
+			curElem = newOutput(yyDollar[1].name, yyDollar[4].expr, curElem, yyDollar[1].line)
+			Log("out:", yyDollar[1].name, prettyPrintExpr(yyDollar[4].expr))
 		}
-	case 24:
+	case 35:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.y:170
+//line parser.y:288
 		{
-			channel := yyDollar[1].name
-			output := yyDollar[3].name
-			outputElem := &ElemOutput{
-				Channel: Name{
-					Name: channel,
-				},
-				Output: Name{
-					Name: output,
-				},
-				Next: curElem,
-			}
-			curElem = outputElem
-
-			Log("out:", channel, output)
+			curElem = newOutput(yyDollar[1].name, yyDollar[3].expr, curElem, yyDollar[1].line)
+			Log("out:", yyDollar[1].name, prettyPrintExpr(yyDollar[3].expr))
 		}
-	case 25:
+	case 36:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.y:189
+//line parser.y:295
 		{
-			channel := yyDollar[1].name
-			input := yyDollar[3].name
-			inputElem := &ElemInput{
-				Channel: Name{
-					Name: channel,
-				},
-				Input: Name{
-					Name: input,
-				},
-				Next: curElem,
+			curElem = newInput(yyDollar[1].name, yyDollar[3].args, curElem, yyDollar[1].line)
+			Log("inp:", yyDollar[1].name)
+		}
+	case 37:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:302
+		{
+			guard := yyDollar[2].guard
+			if guard.Type == GuardMatch {
+				curElem = &ElemEquality{
+					Inequality: guard.Inequality,
+					NameL:      guard.NameL,
+					NameR:      guard.NameR,
+					Next:       curElem,
+				}
+			} else {
+				curElem = &ElemGuard{
+					Guard: guard,
+					Next:  curElem,
+				}
 			}
-			curElem = inputElem
-
-			Log("inp:", channel, input)
+			setPosition(curElem, yyDollar[1].line)
+			Log("match:", prettyPrintGuard(guard))
+		}
+	case 38:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:323
+		{
+			yyVAL.guard = &Guard{
+				Type:   GuardOr,
+				GuardL: yyDollar[1].guard,
+				GuardR: yyDollar[3].guard,
+			}
+		}
+	case 40:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:335
+		{
+			yyVAL.guard = &Guard{
+				Type:   GuardAnd,
+				GuardL: yyDollar[1].guard,
+				GuardR: yyDollar[3].guard,
+			}
+		}
+	case 42:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:347
+		{
+			yyVAL.guard = &Guard{
+				NameL: yyDollar[1].value,
+				NameR: yyDollar[3].value,
+			}
+		}
+	case 43:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:355
+		{
+			yyVAL.guard = &Guard{
+				Inequality: true,
+				NameL:      yyDollar[1].value,
+				NameR:      yyDollar[4].value,
+			}
+		}
+	case 44:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:364
+		{
+			yyVAL.guard = &Guard{
+				Type:  GuardLess,
+				NameL: yyDollar[1].value,
+				NameR: yyDollar[3].value,
+			}
+		}
+	case 45:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:373
+		{
+			yyVAL.guard = &Guard{
+				Type:  GuardLessEqual,
+				NameL: yyDollar[1].value,
+				NameR: yyDollar[4].value,
+			}
+		}
+	case 46:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:382
+		{
+			yyVAL.guard = &Guard{
+				Type:  GuardLess,
+				NameL: yyDollar[3].value,
+				NameR: yyDollar[1].value,
+			}
+		}
+	case 47:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:391
+		{
+			yyVAL.guard = &Guard{
+				Type:  GuardLessEqual,
+				NameL: yyDollar[4].value,
+				NameR: yyDollar[1].value,
+			}
+		}
+	case 48:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:400
+		{
+			yyVAL.guard = yyDollar[2].guard
+		}
+	case 49:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:406
+		{
+			pushLevels()
 		}
-	case 26:
+	case 50:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.y:208
+//line parser.y:410
 		{
-			equalityElem := &ElemEquality{
-				NameL: Name{
+			popLevels()
+			ifStack[len(ifStack)-1].Then = curElem
+			curElem = nil
+			pushLevels()
+		}
+	case 51:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line parser.y:417
+		{
+			popLevels()
+			ifElem := ifStack[len(ifStack)-1]
+			ifStack = ifStack[:len(ifStack)-1]
+			ifElem.Else = curElem
+			curElem = ifElem
+			setPosition(curElem, yyDollar[1].line)
+			Log("if")
+		}
+	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:429
+		{
+			ifStack = append(ifStack, &ElemIf{
+				NameL: yyDollar[1].value,
+				NameR: yyDollar[3].value,
+			})
+			Log("condition:", yyDollar[1].value.Name, yyDollar[3].value.Name)
+		}
+	case 53:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:438
+		{
+			ifStack = append(ifStack, &ElemIf{
+				Inequality: true,
+				NameL:      yyDollar[1].value,
+				NameR:      yyDollar[4].value,
+			})
+			Log("condition:", yyDollar[1].value.Name, yyDollar[4].value.Name)
+		}
+	case 54:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.y:449
+		{
+			curElem = &ElemLet{
+				Var: Name{
 					Name: yyDollar[2].name,
 				},
-				NameR: Name{
-					Name: yyDollar[4].name,
-				},
+				Expr: yyDollar[4].expr,
 				Next: curElem,
 			}
-			curElem = equalityElem
-			Log("equality:", yyDollar[2].name, yyDollar[4].name)
+			setPosition(curElem, yyDollar[1].line)
+			Log("let:", yyDollar[2].name, prettyPrintExpr(yyDollar[4].expr))
 		}
-	case 27:
-		yyDollar = yyS[yypt-7 : yypt+1]
-//line parser.y:224
+	case 55:
+		yyDollar = yyS[yypt-9 : yypt+1]
+//line parser.y:463
 		{
-			equalityElem := &ElemEquality{
-				Inequality: true,
-				NameL: Name{
-					Name: yyDollar[2].name,
-				},
-				NameR: Name{
+			letElem := &ElemLet{
+				Var: Name{
 					Name: yyDollar[5].name,
 				},
+				Expr: &Expr{
+					Type: ExprDec,
+					ExprL: &Expr{
+						Name: yyDollar[2].value,
+					},
+					ExprR: &Expr{
+						Name: yyDollar[7].value,
+					},
+				},
 				Next: curElem,
 			}
-			curElem = equalityElem
-			Log("inequality:", yyDollar[2].name, yyDollar[5].name)
+			caseLets[letElem] = true
+			curElem = letElem
+			setPosition(curElem, yyDollar[1].line)
+			Log("case:", yyDollar[2].value.Name, yyDollar[5].name, yyDollar[7].value.Name)
 		}
-	case 28:
+	case 56:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.y:241
+//line parser.y:487
 		{
 			resElem := &ElemRestriction{
 				Restrict: Name{
@@ -680,11 +1000,27 @@ yydefault:
 				Next: curElem,
 			}
 			curElem = resElem
+			setPosition(curElem, yyDollar[1].line)
 			Log("new:", yyDollar[2].name)
 		}
-	case 29:
+	case 57:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.y:500
+		{
+			resElem := &ElemRestriction{
+				Restrict: Name{
+					Name: yyDollar[2].name,
+				},
+				Next: curElem,
+			}
+			restrictionSorts[resElem] = yyDollar[4].sort
+			curElem = resElem
+			setPosition(curElem, yyDollar[1].line)
+			Log("new:", yyDollar[2].name, yyDollar[4].sort.String())
+		}
+	case 58:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:254
+//line parser.y:515
 		{
 			// Track the maximum curSumLevel, i.e. no. of sums at this
 			// bracket level.
@@ -700,9 +1036,9 @@ yydefault:
 
 			Log("+")
 		}
-	case 30:
+	case 59:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.y:270
+//line parser.y:531
 		{
 			curSumLevel = curSumLevel - 1
 			if curSumLevel == 0 {
@@ -730,9 +1066,9 @@ yydefault:
 				curElem = curSum
 			}
 		}
-	case 31:
+	case 60:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:300
+//line parser.y:561
 		{
 			// Track the maximum curParLevel, i.e. no. of parallels at this
 			// bracket level.
@@ -748,9 +1084,9 @@ yydefault:
 
 			Log("|")
 		}
-	case 32:
+	case 61:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.y:316
+//line parser.y:577
 		{
 			curParLevel = curParLevel - 1
 			if curParLevel == 0 {
@@ -778,79 +1114,207 @@ yydefault:
 				curElem = curPar
 			}
 		}
-	case 33:
+	case 62:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:607
+		{
+			curElem = newProcessCall(yyDollar[1].name, yyDollar[3].args, yyDollar[1].line)
+			Log("pconsts:", yyDollar[1].name)
+		}
+	case 63:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line parser.y:614
+		{
+			yyVAL.args = nil
+		}
+	case 65:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:622
+		{
+			yyVAL.args = []argument{yyDollar[1].arg}
+		}
+	case 66:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:346
+//line parser.y:627
 		{
-			// Reverse order of curPconstNames
-			for i := len(curPconstNames)/2 - 1; i >= 0; i-- {
-				j := len(curPconstNames) - 1 - i
-				curPconstNames[i], curPconstNames[j] = curPconstNames[j], curPconstNames[i]
+			yyVAL.args = append(yyDollar[1].args, yyDollar[3].arg)
+		}
+	case 67:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:633
+		{
+			yyVAL.arg = argument{
+				expr: yyDollar[1].expr,
 			}
-			name := yyDollar[1].name
-			pconstElem := &ElemProcess{
-				Name:       name,
-				Parameters: curPconstNames,
+		}
+	case 68:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:640
+		{
+			yyVAL.arg = argument{
+				expr: &Expr{
+					Name: Name{
+						Name: yyDollar[1].name,
+					},
+				},
+				sort: yyDollar[3].sort,
 			}
-			curElem = pconstElem
-			curPconstNames = []Name{}
-			Log("pconsts:", name)
 		}
-	case 34:
+	case 69:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.y:364
+//line parser.y:652
 		{
-			curPconstNames = append(curPconstNames, Name{
-				Name: yyDollar[1].name,
-			})
+			yyVAL.arg = argument{
+				expr: yyDollar[3].expr,
+				name: yyDollar[1].name,
+			}
 		}
-	case 35:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.y:371
+	case 70:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:661
+		{
+			yyVAL.sort = Sort{
+				Type: SortBool,
+			}
+		}
+	case 71:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:668
+		{
+			yyVAL.sort = newIntSort(yyDollar[1].name, yyDollar[3].name, yyDollar[2].line)
+		}
+	case 72:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:673
+		{
+			yyVAL.sort = newChannelSort(yyDollar[1].name, nil, yyDollar[1].line)
+		}
+	case 73:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.y:678
+		{
+			yyVAL.sort = newChannelSort(yyDollar[1].name, yyDollar[3].sorts, yyDollar[1].line)
+		}
+	case 74:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:684
+		{
+			yyVAL.sorts = []Sort{yyDollar[1].sort}
+		}
+	case 75:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:689
+		{
+			yyVAL.sorts = append(yyDollar[1].sorts, yyDollar[3].sort)
+		}
+	case 76:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:695
+		{
+			yyVAL.expr = &Expr{
+				Name: yyDollar[1].value,
+			}
+		}
+	case 77:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:702
+		{
+			yyVAL.expr = &Expr{
+				Type:  ExprAdd,
+				ExprL: yyDollar[1].expr,
+				ExprR: &Expr{
+					Name: yyDollar[3].value,
+				},
+			}
+		}
+	case 78:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.y:713
+		{
+			yyVAL.expr = &Expr{
+				Type:  ExprSub,
+				ExprL: yyDollar[1].expr,
+				ExprR: &Expr{
+					Name: yyDollar[3].value,
+				},
+			}
+		}
+	case 79:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.y:724
+		{
+			yyVAL.expr = &Expr{
+				Type:  ExprEnc,
+				ExprL: yyDollar[3].expr,
+				ExprR: yyDollar[5].expr,
+			}
+		}
+	case 80:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.y:733
 		{
-			curPconstNames = append(curPconstNames, Name{
+			yyVAL.expr = &Expr{
+				Type:  ExprDec,
+				ExprL: yyDollar[3].expr,
+				ExprR: yyDollar[5].expr,
+			}
+		}
+	case 81:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:743
+		{
+			yyVAL.value = Name{
 				Name: yyDollar[1].name,
-			})
+			}
 		}
-	case 36:
+	case 82:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:379
+//line parser.y:750
+		{
+			yyVAL.value = newIntLiteral(yyDollar[1].name)
+		}
+	case 83:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:755
+		{
+			yyVAL.value = newBoolValue(true)
+		}
+	case 84:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:760
+		{
+			yyVAL.value = newBoolValue(false)
+		}
+	case 86:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:768
+		{
+			yyVAL.name = "0"
+		}
+	case 87:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.y:774
 		{
 			name := yyDollar[1].name
 			processElem := &ElemProcess{
 				Name: name,
 			}
 			curElem = processElem
+			setPosition(curElem, yyDollar[1].line)
 			Log("process:", name)
 		}
-	case 37:
+	case 88:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.y:390
-		{
-			// Sum elements:
-			// Save no. of sum on stack.
-			curSumLevelStack = append(curSumLevelStack, curSumLevel)
-			// Reset no. of sums.
-			curSumLevel = 0
-
-			// Parallel elements:
-			// Save no. of parallels on stack.
-			curParLevelStack = append(curParLevelStack, curParLevel)
-			// Reset no. of parallels.
-			curParLevel = 0
+//line parser.y:786
+		{
+			pushLevels()
 			Log("(")
 		}
-	case 38:
+	case 89:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.y:405
+//line parser.y:791
 		{
-			// Sum elements:
-			// Restore upper level no. of sums.
-			curSumLevel, curSumLevelStack = pop(curSumLevelStack)
-
-			// Parallel elements:
-			// Restore upper level no. of parallels.
-			curParLevel, curParLevelStack = pop(curParLevelStack)
+			popLevels()
 			Log(")")
 		}
 	}
@@ -3,14 +3,9 @@ package pifra
 
 var undeclaredProcs []Element
 
-var curProcParams []string
-
 // All elements
 var curElem Element          // Tracks the current element chain
 
-// Process Constants element
-var curPconstNames []Name  // Tracks the process constant names
-
 // Sum element
 var curSum Element            // Current sum process.
 var sumStack []Element        // Sum processes encountered.
@@ -26,13 +21,34 @@ var curParLevel int           // Current parallel element level.
 var curParLevelStack []int    // Saves curParLevel at different bracket levels.
 var numParStack []int         // Saves the maximum curParLevel at different bracket levels.
                               // Used for knowing how many elements to pop from parStack.
+
+// Conditional element
+var ifStack []*ElemIf         // Conditionals whose branches are being parsed.
 %}
 
 %union {
    name string
+   line int
+   guard *Guard
+   value Name
+   expr *Expr
+   sort Sort
+   arg argument
+   args []argument
+   sorts []Sort
+   names []string
 }
 
-%token <name> NAME
+%token <name> NAME STRING INT
+%type <name> numeral
+%type <guard> guard guard_conj guard_atom
+%type <value> value
+%type <expr> expr
+%type <sort> sort
+%type <arg> arg
+%type <args> args args_list
+%type <sorts> sorts
+%type <names> names
 %token NAME
     LBRACKET RBRACKET 
     LANGLE RANGLE
@@ -47,6 +63,29 @@ var numParStack []int         // Saves the maximum curParLevel at different brac
     DOLLARSIGN
     PLUS
     EXCLAMATION
+    IMPORT
+    MAIN
+    IF
+    THEN
+    ELSE
+    AND
+    OR
+    LET
+    IN
+    TRUE
+    FALSE
+    BOOL
+    COLON
+    DOTDOT
+    MINUS
+    ENC
+    DEC
+    CASE
+    OF
+    MARKED
+    ENV
+    LBRACE
+    RBRACE
 
 %nonassoc LOWPREC
 %nonassoc LOWER_THAN_LBRACKET
@@ -54,7 +93,7 @@ var numParStack []int         // Saves the maximum curParLevel at different brac
 %nonassoc RSQBRACKET
 %right VERTBAR
 %right PLUS
-%nonassoc DOT
+%nonassoc DOT ELSE IN
 %%
 
 stmts: /* empty */
@@ -66,45 +105,127 @@ stmt:
     process_decl
     |
     undecl
+    |
+    import_decl
+    |
+    entry_decl
+    |
+    marked_decl
+    |
+    env_decl
 
-pconstants_decl:
-    NAME LBRACKET pconst_decl_names EQUAL elem
+entry_decl:
+    MAIN NAME EQUAL elem
     {
-        // Reverse order of curProcParams
-        for i := len(curProcParams)/2-1; i >= 0; i-- {
-            j := len(curProcParams)-1-i
-            curProcParams[i], curProcParams[j] = curProcParams[j], curProcParams[i]
-        }
-        name := $1
-        DeclaredProcs[name] = DeclaredProcess{
-            Process: curElem,
-            Parameters: curProcParams,
-        }
+        declareEntry($2, curElem, $<line>1)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declEntry,
+            line: $<line>1,
+            name: $2,
+            proc: curElem,
+        })
         curElem = nil
-        curProcParams = []string{}
 
-        Log("pconst decl")
+        Log("entry:", $2)
     }
 
-pconst_decl_names:
-    NAME COMMA pconst_decl_names
+import_decl:
+    IMPORT STRING
     {
-        curProcParams = append(curProcParams, $1)
+        imports = append(imports, importDecl{
+            file: $2,
+            line: $<line>1,
+        })
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declImport,
+            line: $<line>1,
+            name: $2,
+        })
+
+        Log("import:", $2)
+    }
+
+marked_decl:
+    MARKED names
+    {
+        declareMarkedNames($2)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declMarked,
+            line: $<line>1,
+            names: $2,
+        })
+        Log(append([]string{"marked:"}, $2...)...)
+    }
+
+env_decl:
+    ENV LBRACE RBRACE
+    {
+        declareEnvNames([]string{})
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declEnv,
+            line: $<line>1,
+        })
+        Log("env:")
     }
     |
-    NAME RBRACKET
+    ENV LBRACE names RBRACE
     {
-        curProcParams = append(curProcParams, $1)
+        declareEnvNames($3)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declEnv,
+            line: $<line>1,
+            names: $3,
+        })
+        Log(append([]string{"env:"}, $3...)...)
+    }
+
+names:
+    NAME
+    {
+        $$ = []string{$1}
+    }
+    |
+    names COMMA NAME
+    {
+        $$ = append($1, $3)
+    }
+
+pconstants_decl:
+    NAME LBRACKET args RBRACKET EQUAL elem
+    {
+        params, sorts := getParameters($3, $<line>1)
+        declareProcess($1, DeclaredProcess{
+            Process: curElem,
+            Parameters: params,
+            Sorts: sorts,
+        }, $<line>1)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declProcess,
+            line: $<line>1,
+            name: $1,
+            params: params,
+            sorts: sorts,
+            proc: curElem,
+        })
+        curElem = nil
+
+        Log("pconst decl")
     }
 
 process_decl:
     NAME EQUAL elem
     {
         name := $1
-        DeclaredProcs[name] = DeclaredProcess{
+        declareProcess(name, DeclaredProcess{
             Process: curElem,
             Parameters: []string{},
-        }
+        }, $<line>1)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declProcess,
+            line: $<line>1,
+            name: name,
+            proc: curElem,
+        })
         curElem = nil
 
         Log("process")
@@ -114,6 +235,11 @@ undecl:
     elem
     {
         undeclaredProcs = append(undeclaredProcs, curElem)
+        sourceDecls = append(sourceDecls, sourceDecl{
+            kind: declUndeclared,
+            line: $<line>1,
+            proc: curElem,
+        })
         curElem = nil
     }
 
@@ -128,9 +254,13 @@ elem:
     |
     input
     |
-    equality
+    match
+    |
+    conditional
+    |
+    let
     |
-    inequality
+    case
     |
     restriction
     |
@@ -148,92 +278,208 @@ nil:
     }
 
 output:
-    NAME APOSTROPHE LANGLE NAME RANGLE DOT elem
+    NAME APOSTROPHE LANGLE expr RANGLE DOT elem
     {
-        channel := $1
-        output := $4
-        outputElem := &ElemOutput{
-            Channel: Name{
-                Name: channel,
-            },
-            Output: Name{
-                Name: output,
-            },
-            Next: curElem,
+        curElem = newOutput($1, $4, curElem, $<line>1)
+        Log("out:", $1, prettyPrintExpr($4))
+    }
+    |
+    NAME LANGLE expr RANGLE DOT elem
+    {
+        curElem = newOutput($1, $3, curElem, $<line>1)
+        Log("out:", $1, prettyPrintExpr($3))
+    }
+
+input:
+    NAME LBRACKET args RBRACKET DOT elem
+    {
+        curElem = newInput($1, $3, curElem, $<line>1)
+        Log("inp:", $1)
+    }
+
+match:
+    LSQBRACKET guard RSQBRACKET elem
+    {
+        guard := $2
+        if guard.Type == GuardMatch {
+            curElem = &ElemEquality{
+                Inequality: guard.Inequality,
+                NameL: guard.NameL,
+                NameR: guard.NameR,
+                Next: curElem,
+            }
+        } else {
+            curElem = &ElemGuard{
+                Guard: guard,
+                Next: curElem,
+            }
         }
-        curElem = outputElem
+        setPosition(curElem, $<line>1)
+        Log("match:", prettyPrintGuard(guard))
+    }
 
-        Log("out:", channel, output)
+guard:
+    guard OR guard_conj
+    {
+        $$ = &Guard{
+            Type: GuardOr,
+            GuardL: $1,
+            GuardR: $3,
+        }
     }
     |
-    NAME LANGLE NAME RANGLE DOT elem
+    guard_conj
+
+guard_conj:
+    guard_conj AND guard_atom
     {
-        channel := $1
-        output := $3
-        outputElem := &ElemOutput{
-            Channel: Name{
-                Name: channel,
-            },
-            Output: Name{
-                Name: output,
-            },
-            Next: curElem,
+        $$ = &Guard{
+            Type: GuardAnd,
+            GuardL: $1,
+            GuardR: $3,
         }
-        curElem = outputElem
-
-        Log("out:", channel, output)
     }
+    |
+    guard_atom
 
-input:
-    NAME LBRACKET NAME RBRACKET DOT elem
+guard_atom:
+    value EQUAL value
     {
-        channel := $1
-        input := $3
-        inputElem := &ElemInput{
-            Channel: Name{
-                Name: channel,
-            },
-            Input: Name{
-                Name: input,
-            },
-            Next: curElem,
+        $$ = &Guard{
+            NameL: $1,
+            NameR: $3,
+        }
+    }
+    |
+    value EXCLAMATION EQUAL value
+    {
+        $$ = &Guard{
+            Inequality: true,
+            NameL: $1,
+            NameR: $4,
         }
-        curElem = inputElem
+    }
+    |
+    value LANGLE value
+    {
+        $$ = &Guard{
+            Type: GuardLess,
+            NameL: $1,
+            NameR: $3,
+        }
+    }
+    |
+    value LANGLE EQUAL value
+    {
+        $$ = &Guard{
+            Type: GuardLessEqual,
+            NameL: $1,
+            NameR: $4,
+        }
+    }
+    |
+    value RANGLE value
+    {
+        $$ = &Guard{
+            Type: GuardLess,
+            NameL: $3,
+            NameR: $1,
+        }
+    }
+    |
+    value RANGLE EQUAL value
+    {
+        $$ = &Guard{
+            Type: GuardLessEqual,
+            NameL: $4,
+            NameR: $1,
+        }
+    }
+    |
+    LBRACKET guard RBRACKET
+    {
+        $$ = $2
+    }
 
-        Log("inp:", channel, input)
+conditional:
+    IF condition THEN
+    {
+        pushLevels()
+    }
+    elem ELSE
+    {
+        popLevels()
+        ifStack[len(ifStack)-1].Then = curElem
+        curElem = nil
+        pushLevels()
+    }
+    elem
+    {
+        popLevels()
+        ifElem := ifStack[len(ifStack)-1]
+        ifStack = ifStack[:len(ifStack)-1]
+        ifElem.Else = curElem
+        curElem = ifElem
+        setPosition(curElem, $<line>1)
+        Log("if")
+    }
+
+condition:
+    value EQUAL value
+    {
+        ifStack = append(ifStack, &ElemIf{
+            NameL: $1,
+            NameR: $3,
+        })
+        Log("condition:", $1.Name, $3.Name)
+    }
+    |
+    value EXCLAMATION EQUAL value
+    {
+        ifStack = append(ifStack, &ElemIf{
+            Inequality: true,
+            NameL: $1,
+            NameR: $4,
+        })
+        Log("condition:", $1.Name, $4.Name)
     }
 
-equality:
-    LSQBRACKET NAME EQUAL NAME RSQBRACKET elem
+let:
+    LET NAME EQUAL expr IN elem
     {
-        equalityElem := &ElemEquality{
-            NameL: Name{
+        curElem = &ElemLet{
+            Var: Name{
                 Name: $2,
             },
-            NameR: Name{
-                Name: $4,
-            },
+            Expr: $4,
             Next: curElem,
         }
-        curElem = equalityElem
-        Log("equality:", $2, $4)
+        setPosition(curElem, $<line>1)
+        Log("let:", $2, prettyPrintExpr($4))
     }
 
-inequality:
-    LSQBRACKET NAME EXCLAMATION EQUAL NAME RSQBRACKET elem
+case:
+    CASE value OF LBRACE NAME RBRACE value IN elem
     {
-        equalityElem := &ElemEquality{
-            Inequality: true,
-            NameL: Name{
-                Name: $2,
-            },
-            NameR: Name{
+        letElem := &ElemLet{
+            Var: Name{
                 Name: $5,
             },
+            Expr: &Expr{
+                Type: ExprDec,
+                ExprL: &Expr{
+                    Name: $2,
+                },
+                ExprR: &Expr{
+                    Name: $7,
+                },
+            },
             Next: curElem,
         }
-        curElem = equalityElem
-        Log("inequality:", $2, $5)
+        caseLets[letElem] = true
+        curElem = letElem
+        setPosition(curElem, $<line>1)
+        Log("case:", $2.Name, $5, $7.Name)
     }
 
 restriction:
@@ -246,8 +492,23 @@ restriction:
             Next: curElem,
         }
         curElem = resElem
+        setPosition(curElem, $<line>1)
         Log("new:", $2)
     }
+    |
+    DOLLARSIGN NAME COLON sort DOT elem
+    {
+        resElem := &ElemRestriction{
+            Restrict: Name{
+                Name: $2,
+            },
+            Next: curElem,
+        }
+        restrictionSorts[resElem] = $4
+        curElem = resElem
+        setPosition(curElem, $<line>1)
+        Log("new:", $2, $4.String())
+    }
 
 sum: 
     elem PLUS
@@ -342,36 +603,170 @@ parallel:
     }
 
 pconstants:
-    NAME LBRACKET names
+    NAME LBRACKET args RBRACKET
     {
-        // Reverse order of curPconstNames
-        for i := len(curPconstNames)/2-1; i >= 0; i-- {
-            j := len(curPconstNames)-1-i
-            curPconstNames[i], curPconstNames[j] = curPconstNames[j], curPconstNames[i]
+        curElem = newProcessCall($1, $3, $<line>1)
+        Log("pconsts:", $1)
+    }
+
+args:
+    /* empty */
+    {
+        $$ = nil
+    }
+    |
+    args_list
+
+args_list:
+    arg
+    {
+        $$ = []argument{$1}
+    }
+    |
+    args_list COMMA arg
+    {
+        $$ = append($1, $3)
+    }
+
+arg:
+    expr
+    {
+        $$ = argument{
+            expr: $1,
         }
-        name := $1
-        pconstElem := &ElemProcess{
-            Name: name,
-            Parameters: curPconstNames,
+    }
+    |
+    NAME COLON sort
+    {
+        $$ = argument{
+            expr: &Expr{
+                Name: Name{
+                    Name: $1,
+                },
+            },
+            sort: $3,
+        }
+    }
+    |
+    NAME EQUAL expr
+    {
+        $$ = argument{
+            expr: $3,
+            name: $1,
         }
-        curElem = pconstElem
-        curPconstNames = []Name{}
-        Log("pconsts:", name)
     }
 
-names:
-    NAME COMMA names
+sort:
+    BOOL
+    {
+        $$ = Sort{
+            Type: SortBool,
+        }
+    }
+    |
+    numeral DOTDOT numeral
     {
-        curPconstNames = append(curPconstNames, Name{
+        $$ = newIntSort($1, $3, $<line>2)
+    }
+    |
+    NAME LANGLE RANGLE
+    {
+        $$ = newChannelSort($1, nil, $<line>1)
+    }
+    |
+    NAME LANGLE sorts RANGLE
+    {
+        $$ = newChannelSort($1, $3, $<line>1)
+    }
+
+sorts:
+    sort
+    {
+        $$ = []Sort{$1}
+    }
+    |
+    sorts COMMA sort
+    {
+        $$ = append($1, $3)
+    }
+
+expr:
+    value
+    {
+        $$ = &Expr{
             Name: $1,
-        })
+        }
+    }
+    |
+    expr PLUS value
+    {
+        $$ = &Expr{
+            Type: ExprAdd,
+            ExprL: $1,
+            ExprR: &Expr{
+                Name: $3,
+            },
+        }
+    }
+    |
+    expr MINUS value
+    {
+        $$ = &Expr{
+            Type: ExprSub,
+            ExprL: $1,
+            ExprR: &Expr{
+                Name: $3,
+            },
+        }
     }
     |
-    NAME RBRACKET
+    ENC LBRACKET expr COMMA expr RBRACKET
     {
-        curPconstNames = append(curPconstNames, Name{
+        $$ = &Expr{
+            Type: ExprEnc,
+            ExprL: $3,
+            ExprR: $5,
+        }
+    }
+    |
+    DEC LBRACKET expr COMMA expr RBRACKET
+    {
+        $$ = &Expr{
+            Type: ExprDec,
+            ExprL: $3,
+            ExprR: $5,
+        }
+    }
+
+value:
+    NAME
+    {
+        $$ = Name{
             Name: $1,
-        })
+        }
+    }
+    |
+    numeral
+    {
+        $$ = newIntLiteral($1)
+    }
+    |
+    TRUE
+    {
+        $$ = newBoolValue(true)
+    }
+    |
+    FALSE
+    {
+        $$ = newBoolValue(false)
+    }
+
+numeral:
+    INT
+    |
+    ZERO
+    {
+        $$ = "0"
     }
 
 process:
@@ -382,33 +777,18 @@ process:
             Name: name,
         }
         curElem = processElem
+        setPosition(curElem, $<line>1)
         Log("process:", name)
     }
 
 parentheses:
     LBRACKET
     {
-        // Sum elements:
-        // Save no. of sum on stack.
-        curSumLevelStack = append(curSumLevelStack, curSumLevel)
-        // Reset no. of sums.
-        curSumLevel = 0
-
-        // Parallel elements:
-        // Save no. of parallels on stack.
-        curParLevelStack = append(curParLevelStack, curParLevel)
-        // Reset no. of parallels.
-        curParLevel = 0
+        pushLevels()
         Log("(")
     }
     elem RBRACKET
     {
-        // Sum elements:
-        // Restore upper level no. of sums. 
-        curSumLevel, curSumLevelStack = pop(curSumLevelStack)
-
-        // Parallel elements:
-        // Restore upper level no. of parallels. 
-        curParLevel, curParLevelStack = pop(curParLevelStack)
+        popLevels()
         Log(")")
     }
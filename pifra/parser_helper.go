@@ -2,12 +2,19 @@ package pifra
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type DeclaredProcess struct {
 	Process    Element
 	Parameters []string
+	// Sorts of the parameters, or nil if none is annotated.
+	Sorts []Sort
 }
 
 // DeclaredProcs is a map of name -> (process, parameters).
@@ -15,22 +22,510 @@ var DeclaredProcs map[string]DeclaredProcess
 
 var log = false
 
+// Position is a line of a program file.
+type position struct {
+	file string
+	line int
+}
+
+func (pos position) String() string {
+	if pos.file == "" {
+		return "line " + strconv.Itoa(pos.line)
+	}
+	return pos.file + ":" + strconv.Itoa(pos.line)
+}
+
+// importDecl is an import of a file at a line of the parsed file.
+type importDecl struct {
+	file string
+	line int
+}
+
+// Imports of the parsed file.
+var imports []importDecl
+
+// entryDecl is a named process which can be selected as the root process.
+type entryDecl struct {
+	name    string
+	process Element
+	line    int
+}
+
+// Entries of the parsed file in order of declaration.
+var entries []entryDecl
+
+// Entry selected as the root process, or empty for the undeclared process.
+var entryName string
+
+// Parsed file, or empty if the program is not read from a file.
+var parseFile string
+
+// Positions of the declarations of the declared processes.
+var declPositions map[string]position
+
+// Marked names declared by the program files in order of declaration.
+var declaredMarkedNames []string
+
+// Free names declared by env as the channels the environment can use, or nil
+// if the program files declare no env.
+var declaredEnvNames []string
+
+// Positions of the parsed elements, used to report sort errors.
+var elemPositions map[Element]position
+
+// Sorts of the annotated restrictions.
+var restrictionSorts map[*ElemRestriction]Sort
+
+// Names of the parameters of the arguments of the calls with named
+// arguments.
+var namedCalls map[*ElemProcess][]string
+
+// Lets of the decryptions written as case.
+var caseLets map[*ElemLet]bool
+
+// First error in the declarations of the parsed file.
+var declError error
+
 // InitProgram parses the byte array and returns the root undeclared process.
 func InitProgram(program []byte) (Element, error) {
+	return InitProgramFile(program, "")
+}
+
+// InitProgramFile parses the byte array of a program file, and the files it
+// imports, and returns the root undeclared process. Imports are resolved
+// relative to the directory of the importing file, or to the working
+// directory if the file is empty.
+func InitProgramFile(program []byte, file string) (Element, error) {
 	initParser()
 	boundNameIndex = 0
-	lex := newLexer(program)
-	if code := yyParse(lex); code != 0 {
-		return nil, fmt.Errorf(parseError)
+	if err := parseProgram(program, file); err != nil {
+		return nil, err
 	}
-	if len(undeclaredProcs) == 0 {
-		return nil, fmt.Errorf("a process must be undeclared to initialise the program")
+	proc, err := getEntry(entryName)
+	if err != nil {
+		return nil, err
+	}
+
+	loading := make(map[string]bool)
+	if file != "" {
+		loading[filepath.Clean(file)] = true
+	}
+	if err := loadImports(file, imports, loading, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	if err := resolveNamedCalls(); err != nil {
+		return nil, err
+	}
+	if err := checkSorts(proc); err != nil {
+		return nil, err
+	}
+
+	root := InitRootAst(proc)
+	return root, nil
+}
+
+// GetEntries returns the names of the entries of the program file in order
+// of declaration.
+func GetEntries(program []byte, file string) ([]string, error) {
+	initParser()
+	if err := parseProgram(program, file); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.name)
+	}
+	return names, nil
+}
+
+// getEntry returns the root process of the parsed file. It is the entry of
+// the name if specified, otherwise the undeclared process, or the entry if
+// the file has a single entry and no undeclared process.
+func getEntry(name string) (Element, error) {
+	if name != "" {
+		for _, entry := range entries {
+			if entry.name == name {
+				return entry.process, nil
+			}
+		}
+		return nil, fmt.Errorf("entry %s is not declared", name)
 	}
 	if len(undeclaredProcs) > 1 {
 		return nil, fmt.Errorf("there cannot be more than one undeclared processes")
 	}
-	root := InitRootAst(undeclaredProcs[0])
-	return root, nil
+	if len(undeclaredProcs) == 1 {
+		return undeclaredProcs[0], nil
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("a process must be undeclared to initialise the program")
+	}
+	if len(entries) > 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.name)
+		}
+		return nil, fmt.Errorf("an entry must be selected from %s", strings.Join(names, ", "))
+	}
+	return entries[0].process, nil
+}
+
+// parseProgram parses the byte array of a file, adding its declared
+// processes to the declared processes of the program.
+func parseProgram(program []byte, file string) error {
+	resetParser()
+	undeclaredProcs = []Element{}
+	imports = nil
+	entries = nil
+	sourceDecls = nil
+	comments = nil
+	tokenLines = make(map[int]bool)
+	parseFile = file
+	declError = nil
+	lex := newLexer(program)
+	if code := yyParse(lex); code != 0 {
+		return fmt.Errorf("%s: %s", position{file, lex.line}, parseError)
+	}
+	// The lexer stops at a character it does not recognise as if the input
+	// ended.
+	if lex.p < lex.pe {
+		r, _ := utf8.DecodeRune(lex.data[lex.p:])
+		return fmt.Errorf("%s: unexpected character %q", position{file, lex.line}, r)
+	}
+	return declError
+}
+
+// loadImports parses the files imported by a file, and the files they
+// import. The files being loaded are used to detect import cycles, and the
+// files already loaded are not parsed again.
+func loadImports(file string, imps []importDecl, loading map[string]bool, loaded map[string]bool) error {
+	for _, imp := range imps {
+		pos := position{file, imp.line}
+		path := imp.file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		path = filepath.Clean(path)
+		if loading[path] {
+			return fmt.Errorf("%s: import cycle through %s", pos, imp.file)
+		}
+		if loaded[path] {
+			continue
+		}
+
+		program, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", pos, err)
+		}
+		if err := parseProgram(program, path); err != nil {
+			return err
+		}
+		if len(undeclaredProcs) > 0 {
+			return fmt.Errorf("%s: an imported file cannot have undeclared processes", path)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("%s: an imported file cannot have entries", position{path, entries[0].line})
+		}
+
+		loading[path] = true
+		if err := loadImports(path, imports, loading, loaded); err != nil {
+			return err
+		}
+		delete(loading, path)
+		loaded[path] = true
+	}
+	return nil
+}
+
+// declErrorf sets the declaration error at a line of the parsed file, unless
+// an earlier error is set.
+func declErrorf(line int, format string, a ...interface{}) {
+	if declError == nil {
+		declError = fmt.Errorf("%s: %s", position{parseFile, line}, fmt.Sprintf(format, a...))
+	}
+}
+
+// argument is an argument of a process call with the name of its parameter
+// if named, or a parameter of a process declaration or an input with its
+// sort if annotated.
+type argument struct {
+	expr *Expr
+	sort Sort
+	name string
+}
+
+// getParameters returns the names and the sorts of parameters, where the
+// sorts are nil if none is annotated.
+func getParameters(args []argument, line int) ([]string, []Sort) {
+	params := []string{}
+	var sorts []Sort
+	annotated := false
+	for _, arg := range args {
+		if arg.name != "" {
+			declErrorf(line, "parameter %s is named", arg.name)
+		}
+		if arg.expr.Type != ExprName || arg.expr.Name.Type == Data {
+			declErrorf(line, "parameter %s is not a name", prettyPrintExpr(arg.expr))
+		}
+		params = append(params, prettyPrintExpr(arg.expr))
+		sorts = append(sorts, arg.sort)
+		if arg.sort.Type != SortAny {
+			annotated = true
+		}
+	}
+	if !annotated {
+		sorts = nil
+	}
+	return params, sorts
+}
+
+// newInput returns the input of a single parameter on a channel.
+func newInput(channel string, args []argument, next Element, line int) Element {
+	params, sorts := getParameters(args, line)
+	if len(params) != 1 {
+		declErrorf(line, "input on %s has %d parameters", channel, len(params))
+		return next
+	}
+	inpElem := &ElemInput{
+		Channel: Name{
+			Name: channel,
+		},
+		Input: Name{
+			Name: params[0],
+		},
+		Next: next,
+	}
+	if sorts != nil {
+		inpElem.Sort = sorts[0]
+	}
+	setPosition(inpElem, line)
+	return inpElem
+}
+
+// newOutput returns the output of the value of an expression on a channel.
+func newOutput(channel string, expr *Expr, next Element, line int) Element {
+	var bindings []binding
+	output := bindExpr(expr, &bindings)
+	return newLets(bindings, &ElemOutput{
+		Channel: Name{
+			Name: channel,
+		},
+		Output: output,
+		Next:   next,
+	}, line)
+}
+
+// newProcessCall returns the process constant of the values of arguments.
+func newProcessCall(name string, args []argument, line int) Element {
+	var bindings []binding
+	var params []Name
+	var paramNames []string
+	for _, arg := range args {
+		if arg.sort.Type != SortAny {
+			declErrorf(line, "argument %s of process %s has a sort", prettyPrintExpr(arg.expr), name)
+		}
+		if (arg.name != "") != (args[0].name != "") {
+			declErrorf(line, "arguments of process %s are named and positional", name)
+		}
+		params = append(params, bindExpr(arg.expr, &bindings))
+		paramNames = append(paramNames, arg.name)
+	}
+	procElem := &ElemProcess{
+		Name:       name,
+		Parameters: params,
+	}
+	if len(args) > 0 && args[0].name != "" {
+		namedCalls[procElem] = paramNames
+	}
+	return newLets(bindings, procElem, line)
+}
+
+// resolveNamedCalls orders the named arguments of the calls of the program
+// as the parameters of the declared processes, in order of position.
+func resolveNamedCalls() error {
+	var calls []*ElemProcess
+	for procElem := range namedCalls {
+		calls = append(calls, procElem)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		posI := elemPositions[calls[i]]
+		posJ := elemPositions[calls[j]]
+		if posI.file != posJ.file {
+			return posI.file < posJ.file
+		}
+		return posI.line < posJ.line
+	})
+
+	for _, procElem := range calls {
+		pos := elemPositions[procElem]
+		dp, ok := DeclaredProcs[procElem.Name]
+		if !ok {
+			return fmt.Errorf("%s: process %s is not declared", pos, procElem.Name)
+		}
+		isParam := make(map[string]bool)
+		for _, param := range dp.Parameters {
+			isParam[param] = true
+		}
+		args := make(map[string]Name)
+		for i, name := range namedCalls[procElem] {
+			if !isParam[name] {
+				return fmt.Errorf("%s: process %s has no parameter %s", pos, procElem.Name, name)
+			}
+			if _, ok := args[name]; ok {
+				return fmt.Errorf("%s: parameter %s of process %s is passed more than once", pos, name, procElem.Name)
+			}
+			args[name] = procElem.Parameters[i]
+		}
+		var params []Name
+		for _, param := range dp.Parameters {
+			arg, ok := args[param]
+			if !ok {
+				return fmt.Errorf("%s: parameter %s of process %s is not passed", pos, param, procElem.Name)
+			}
+			params = append(params, arg)
+		}
+		// The call is not shared before the program is initialised.
+		procElem.Parameters = params
+	}
+	return nil
+}
+
+// Compound expressions of outputs and process calls are bound by lets to the
+// variables %k, which cannot be lexed as names.
+var exprPrefix = "%"
+var exprIndex int
+
+// binding is a variable bound to the value of a compound expression.
+type binding struct {
+	variable Name
+	expr     *Expr
+}
+
+// bindExpr returns the name of the value of an expression, adding a binding
+// of a variable if the expression is compound.
+func bindExpr(expr *Expr, bindings *[]binding) Name {
+	if expr.Type == ExprName {
+		return expr.Name
+	}
+	exprIndex++
+	variable := Name{
+		Name: exprPrefix + strconv.Itoa(exprIndex),
+	}
+	*bindings = append(*bindings, binding{
+		variable: variable,
+		expr:     expr,
+	})
+	return variable
+}
+
+// newLets returns the process at a line in the scope of the lets of the
+// bindings in order.
+func newLets(bindings []binding, next Element, line int) Element {
+	setPosition(next, line)
+	for i := len(bindings) - 1; i >= 0; i-- {
+		next = &ElemLet{
+			Var:  bindings[i].variable,
+			Expr: bindings[i].expr,
+			Next: next,
+		}
+		setPosition(next, line)
+	}
+	return next
+}
+
+// newIntSort returns the integer sort of the range of two numerals.
+func newIntSort(min string, max string, line int) Sort {
+	sort := Sort{
+		Type: SortInt,
+	}
+	sort.Min, _ = strconv.Atoi(min)
+	sort.Max, _ = strconv.Atoi(max)
+	if sort.Min > sort.Max {
+		declErrorf(line, "sort %s is empty", sort)
+	}
+	return sort
+}
+
+// newChannelSort returns the channel sort of the sorts of its objects.
+func newChannelSort(name string, objects []Sort, line int) Sort {
+	if name != "ch" {
+		declErrorf(line, "unknown sort %s", name)
+	}
+	return Sort{
+		Type: SortChannel,
+		Channel: &ChannelSort{
+			Objects: objects,
+		},
+	}
+}
+
+// setPosition sets the position of a parsed element at a line of the parsed
+// file.
+func setPosition(elem Element, line int) {
+	elemPositions[elem] = position{parseFile, line}
+}
+
+// declareMarkedNames adds marked names, unless they are already marked.
+func declareMarkedNames(names []string) {
+	for _, name := range names {
+		marked := false
+		for _, markedName := range declaredMarkedNames {
+			if markedName == name {
+				marked = true
+			}
+		}
+		if !marked {
+			declaredMarkedNames = append(declaredMarkedNames, name)
+		}
+	}
+}
+
+// declareEnvNames adds names the environment can use.
+func declareEnvNames(names []string) {
+	if declaredEnvNames == nil {
+		declaredEnvNames = []string{}
+	}
+	for _, name := range names {
+		declared := false
+		for _, envName := range declaredEnvNames {
+			if envName == name {
+				declared = true
+			}
+		}
+		if !declared {
+			declaredEnvNames = append(declaredEnvNames, name)
+		}
+	}
+}
+
+// declareEntry adds an entry, unless an entry of the name is already declared.
+func declareEntry(name string, proc Element, line int) {
+	for _, entry := range entries {
+		if entry.name == name {
+			if declError == nil {
+				declError = fmt.Errorf("%s: entry %s is already declared at %s",
+					position{parseFile, line}, name, position{parseFile, entry.line})
+			}
+			return
+		}
+	}
+	entries = append(entries, entryDecl{
+		name:    name,
+		process: proc,
+		line:    line,
+	})
+}
+
+// declareProcess adds a declared process, unless it is already declared.
+func declareProcess(name string, dp DeclaredProcess, line int) {
+	pos := position{parseFile, line}
+	if declPos, ok := declPositions[name]; ok {
+		if declError == nil {
+			declError = fmt.Errorf("%s: process %s is already declared at %s", pos, name, declPos)
+		}
+		return
+	}
+	declPositions[name] = pos
+	DeclaredProcs[name] = dp
 }
 
 // Log prints debug statements.
@@ -43,6 +538,60 @@ func Log(strs ...string) {
 func initParser() {
 	DeclaredProcs = make(map[string]DeclaredProcess)
 	undeclaredProcs = []Element{}
+	declPositions = make(map[string]position)
+	elemPositions = make(map[Element]position)
+	restrictionSorts = make(map[*ElemRestriction]Sort)
+	namedCalls = make(map[*ElemProcess][]string)
+	caseLets = make(map[*ElemLet]bool)
+	tokenLines = make(map[int]bool)
+	declaredMarkedNames = nil
+	declaredEnvNames = nil
+	exprIndex = 0
+}
+
+// resetParser resets the state of the parser, which is left incomplete by a
+// syntax error.
+func resetParser() {
+	curElem = nil
+	curSum = nil
+	sumStack = nil
+	curSumLevel = 0
+	curSumLevelStack = nil
+	numSumStack = nil
+	curPar = nil
+	parStack = nil
+	curParLevel = 0
+	curParLevelStack = nil
+	numParStack = nil
+	ifStack = nil
+}
+
+// pushLevels saves the sum and parallel levels and resets them, on entering a
+// nested process such as a parenthesised process or a branch of a
+// conditional.
+func pushLevels() {
+	// Sum elements:
+	// Save no. of sum on stack.
+	curSumLevelStack = append(curSumLevelStack, curSumLevel)
+	// Reset no. of sums.
+	curSumLevel = 0
+
+	// Parallel elements:
+	// Save no. of parallels on stack.
+	curParLevelStack = append(curParLevelStack, curParLevel)
+	// Reset no. of parallels.
+	curParLevel = 0
+}
+
+// popLevels restores the sum and parallel levels saved by pushLevels.
+func popLevels() {
+	// Sum elements:
+	// Restore upper level no. of sums.
+	curSumLevel, curSumLevelStack = pop(curSumLevelStack)
+
+	// Parallel elements:
+	// Restore upper level no. of parallels.
+	curParLevel, curParLevelStack = pop(curParLevelStack)
 }
 
 func popParStack() Element {
@@ -1,7 +1,11 @@
 package pifra
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -79,6 +83,289 @@ a(b).P
 				},
 			},
 		},
+		"guard": {
+			input: []byte(`
+[a=b || a=c && (b!=c || c=c)]P
+			`),
+			declaredProcs: map[string]DeclaredProcess{},
+			undeclaredProcs: []Element{
+				&ElemGuard{
+					Guard: &Guard{
+						Type: GuardOr,
+						GuardL: &Guard{
+							NameL: Name{
+								Name: "a",
+							},
+							NameR: Name{
+								Name: "b",
+							},
+						},
+						GuardR: &Guard{
+							Type: GuardAnd,
+							GuardL: &Guard{
+								NameL: Name{
+									Name: "a",
+								},
+								NameR: Name{
+									Name: "c",
+								},
+							},
+							GuardR: &Guard{
+								Type: GuardOr,
+								GuardL: &Guard{
+									Inequality: true,
+									NameL: Name{
+										Name: "b",
+									},
+									NameR: Name{
+										Name: "c",
+									},
+								},
+								GuardR: &Guard{
+									NameL: Name{
+										Name: "c",
+									},
+									NameR: Name{
+										Name: "c",
+									},
+								},
+							},
+						},
+					},
+					Next: &ElemProcess{
+						Name: "P",
+					},
+				},
+			},
+		},
+		"conditional": {
+			input: []byte(`
+if a!=b then P else Q
+			`),
+			declaredProcs: map[string]DeclaredProcess{},
+			undeclaredProcs: []Element{
+				&ElemIf{
+					Inequality: true,
+					NameL: Name{
+						Name: "a",
+					},
+					NameR: Name{
+						Name: "b",
+					},
+					Then: &ElemProcess{
+						Name: "P",
+					},
+					Else: &ElemProcess{
+						Name: "Q",
+					},
+				},
+			},
+		},
+		"conditional_sum": {
+			input: []byte(`
+P + if a=b then Q + R else S + T
+			`),
+			declaredProcs: map[string]DeclaredProcess{},
+			undeclaredProcs: []Element{
+				&ElemSum{
+					ProcessL: &ElemProcess{
+						Name: "P",
+					},
+					ProcessR: &ElemSum{
+						ProcessL: &ElemIf{
+							NameL: Name{
+								Name: "a",
+							},
+							NameR: Name{
+								Name: "b",
+							},
+							Then: &ElemSum{
+								ProcessL: &ElemProcess{
+									Name: "Q",
+								},
+								ProcessR: &ElemProcess{
+									Name: "R",
+								},
+							},
+							Else: &ElemProcess{
+								Name: "S",
+							},
+						},
+						ProcessR: &ElemProcess{
+							Name: "T",
+						},
+					},
+				},
+			},
+		},
+		"data": {
+			input: []byte(`
+P(b: bool, n: 0..2) = [n<2]a'<n+1>.P(b, n)
+P(true, 0)
+			`),
+			declaredProcs: map[string]DeclaredProcess{
+				"P": DeclaredProcess{
+					Process: &ElemGuard{
+						Guard: &Guard{
+							Type: GuardLess,
+							NameL: Name{
+								Name: "n",
+							},
+							NameR: Name{
+								Name: "2",
+								Type: Data,
+							},
+						},
+						Next: &ElemLet{
+							Var: Name{
+								Name: "%1",
+							},
+							Expr: &Expr{
+								Type: ExprAdd,
+								ExprL: &Expr{
+									Name: Name{
+										Name: "n",
+									},
+								},
+								ExprR: &Expr{
+									Name: Name{
+										Name: "1",
+										Type: Data,
+									},
+								},
+							},
+							Next: &ElemOutput{
+								Channel: Name{
+									Name: "a",
+								},
+								Output: Name{
+									Name: "%1",
+								},
+								Next: &ElemProcess{
+									Name: "P",
+									Parameters: []Name{
+										{Name: "b"},
+										{Name: "n"},
+									},
+								},
+							},
+						},
+					},
+					Parameters: []string{"b", "n"},
+					Sorts: []Sort{
+						{Type: SortBool},
+						{Type: SortInt, Min: 0, Max: 2},
+					},
+				},
+			},
+			undeclaredProcs: []Element{
+				&ElemProcess{
+					Name: "P",
+					Parameters: []Name{
+						{Name: "true", Type: Data},
+						{Name: "0", Type: Data},
+					},
+				},
+			},
+		},
+		"channel_sort": {
+			input: []byte(`
+P(a: ch<ch<>>) = a(x: ch<>).0
+P(b)
+			`),
+			declaredProcs: map[string]DeclaredProcess{
+				"P": DeclaredProcess{
+					Process: &ElemInput{
+						Channel: Name{
+							Name: "a",
+						},
+						Input: Name{
+							Name: "x",
+						},
+						Sort: Sort{
+							Type:    SortChannel,
+							Channel: &ChannelSort{},
+						},
+						Next: &ElemNil{},
+					},
+					Parameters: []string{"a"},
+					Sorts: []Sort{
+						{
+							Type: SortChannel,
+							Channel: &ChannelSort{
+								Objects: []Sort{
+									{
+										Type:    SortChannel,
+										Channel: &ChannelSort{},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			undeclaredProcs: []Element{
+				&ElemProcess{
+					Name: "P",
+					Parameters: []Name{
+						{Name: "b"},
+					},
+				},
+			},
+		},
+		"case": {
+			input: []byte(`
+case x of {y}k in a'<enc(y,k)>.0
+			`),
+			declaredProcs: map[string]DeclaredProcess{},
+			undeclaredProcs: []Element{
+				&ElemLet{
+					Var: Name{
+						Name: "y",
+					},
+					Expr: &Expr{
+						Type: ExprDec,
+						ExprL: &Expr{
+							Name: Name{
+								Name: "x",
+							},
+						},
+						ExprR: &Expr{
+							Name: Name{
+								Name: "k",
+							},
+						},
+					},
+					Next: &ElemLet{
+						Var: Name{
+							Name: "%1",
+						},
+						Expr: &Expr{
+							Type: ExprEnc,
+							ExprL: &Expr{
+								Name: Name{
+									Name: "y",
+								},
+							},
+							ExprR: &Expr{
+								Name: Name{
+									Name: "k",
+								},
+							},
+						},
+						Next: &ElemOutput{
+							Channel: Name{
+								Name: "a",
+							},
+							Output: Name{
+								Name: "%1",
+							},
+							Next: &ElemNil{},
+						},
+					},
+				},
+			},
+		},
 		"restriction": {
 			input: []byte(`
 $a.P
@@ -565,3 +852,207 @@ $a.b(a).$a.(b'<a>.0 | $b.(a(b).0 | c(d).0))
 		})
 	}
 }
+
+func TestImports(t *testing.T) {
+	tests := map[string]struct {
+		files map[string]string
+		err   string
+	}{
+		"import": {
+			files: map[string]string{
+				"main.pi":       "import \"lib/a.pi\"\nimport \"lib/b.pi\"\nP(a)",
+				"lib/a.pi":      "import \"b.pi\"\nP(a) = Q(a)",
+				"lib/b.pi":      "Q(a) = a'<a>.0",
+				"lib/unused.pi": "R = 0",
+			},
+		},
+		"cycle": {
+			files: map[string]string{
+				"main.pi":  "import \"lib/a.pi\"\nP(a)",
+				"lib/a.pi": "P(a) = a'<a>.0\nimport \"../main.pi\"",
+			},
+			err: "lib/a.pi:2: import cycle through ../main.pi",
+		},
+		"duplicate": {
+			files: map[string]string{
+				"main.pi":  "import \"lib/a.pi\"\n\nP(a) = a(x).0\nP(a)",
+				"lib/a.pi": "P(a) = a'<a>.0",
+			},
+			err: "lib/a.pi:1: process P is already declared at main.pi:3",
+		},
+		"undeclared": {
+			files: map[string]string{
+				"main.pi":  "import \"lib/a.pi\"\nP(a)",
+				"lib/a.pi": "P(a) = a'<a>.0\nP(b)",
+			},
+			err: "lib/a.pi: an imported file cannot have undeclared processes",
+		},
+		"syntax_error": {
+			files: map[string]string{
+				"main.pi":  "import \"lib/a.pi\"\nP(a)",
+				"lib/a.pi": "P(a) =\n  a'<a>.\n",
+			},
+			err: "lib/a.pi:3: syntax error",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for file, program := range tc.files {
+				path := filepath.Join(dir, file)
+				os.MkdirAll(filepath.Dir(path), os.ModePerm)
+				if err := ioutil.WriteFile(path, []byte(program), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mainFile := filepath.Join(dir, "main.pi")
+			_, err := InitProgramFile([]byte(tc.files["main.pi"]), mainFile)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := DeclaredProcs["Q"]; !ok || len(DeclaredProcs) != 2 {
+					t.Errorf("declared processes: %v", DeclaredProcs)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error: %s", tc.err)
+			}
+			// Positions are relative to the directory of the files.
+			if msg := strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""); msg != tc.err {
+				t.Errorf("error: %s, expected: %s", msg, tc.err)
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	input := []byte(`
+P(a) = a'<a>.0
+main One = P(x)
+main Two = $y.P(y)
+`)
+	tests := map[string]struct {
+		input  []byte
+		entry  string
+		output string
+		err    string
+	}{
+		"entry": {
+			input:  input,
+			entry:  "Two",
+			output: "$&y_0.P(&y_0)",
+		},
+		"undeclared_entry": {
+			input: input,
+			entry: "Three",
+			err:   "entry Three is not declared",
+		},
+		"no_entry": {
+			input: input,
+			err:   "an entry must be selected from One, Two",
+		},
+		"single_entry": {
+			input:  []byte(`main One = a'<a>.0`),
+			output: "a'<a>.0",
+		},
+		"undeclared_process": {
+			input:  append([]byte(`a(x).0`), input...),
+			output: "a(&x_0).0",
+		},
+		"duplicate_entry": {
+			input: []byte("main One = 0\nmain One = 0"),
+			entry: "One",
+			err:   "line 2: entry One is already declared at line 1",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			entryName = tc.entry
+			defer func() {
+				entryName = ""
+			}()
+			proc, err := InitProgram(tc.input)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("error: %v, expected: %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := PrettyPrintAst(proc); output != tc.output {
+				t.Errorf("output: %s, expected: %s", output, tc.output)
+			}
+		})
+	}
+
+	entries, err := GetEntries(input, "")
+	if err != nil || !reflect.DeepEqual(entries, []string{"One", "Two"}) {
+		t.Errorf("entries: %v, error: %v", entries, err)
+	}
+}
+
+func TestNamedCalls(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		output string
+		err    string
+	}{
+		"named": {
+			input:  "Server(req, resp) = req(x).resp'<x>.0\nServer(resp=s, req=r)",
+			output: "Server(r, s)",
+		},
+		"zero_arity": {
+			input:  "P() = a'<b>.0\nP() | P",
+			output: "(P | P)",
+		},
+		"unknown_parameter": {
+			input: "P(a) = 0\nP(b=c)",
+			err:   "line 2: process P has no parameter b",
+		},
+		"missing_parameter": {
+			input: "P(a, b) = 0\nP(a=c)",
+			err:   "line 2: parameter b of process P is not passed",
+		},
+		"repeated_parameter": {
+			input: "P(a, b) = 0\nP(a=c, a=d)",
+			err:   "line 2: parameter a of process P is passed more than once",
+		},
+		"positional": {
+			input: "P(a, b) = 0\nP(a=c, d)",
+			err:   "line 2: arguments of process P are named and positional",
+		},
+		"undeclared": {
+			input: "Q(a=b)",
+			err:   "line 1: process Q is not declared",
+		},
+		"named_parameter": {
+			input: "P(a=b) = 0",
+			err:   "line 1: parameter a is named",
+		},
+		"arity": {
+			input: "P(a) = 0\nP()",
+			err:   "line 2: process P has 1 parameters, but is called with 0 arguments",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, err := InitProgram([]byte(tc.input))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("error: %v, expected: %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output := PrettyPrintAst(proc.(*ElemRoot).Next); output != tc.output {
+				t.Errorf("output: %s, expected: %s", output, tc.output)
+			}
+		})
+	}
+}
@@ -2,10 +2,13 @@ package pifra
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"time"
 )
 
@@ -16,9 +19,27 @@ type Flags struct {
 	RegisterSize int
 	MaxStates    int
 	DisableGC    bool
+	Symmetry     bool
+	Closed       bool
+	Barbs        bool
+	POR          bool
+	Symbolic     bool
+	Semantics    string
+	Async        bool
+	Entry        string
+	AllEntries   bool
+	Observe      []string
+	Timeout      time.Duration
+	MaxMemory    int
 
-	InputFile  string
-	OutputFile string
+	InputFile      string
+	OutputFile     string
+	CheckpointFile string
+	ResumeFile     string
+	Stream         string
+	Progress       bool
+	Profile        bool
+	StatsJSON      bool
 
 	GVLayout       string
 	GVOutputStates bool
@@ -30,10 +51,27 @@ type Flags struct {
 	Quiet bool
 }
 
+// File of the program, used to resolve its imports.
+var programFile string
+
 func initFlags(flags Flags) {
+	programFile = flags.InputFile
+	entryName = flags.Entry
 	maxStatesExplored = flags.MaxStates
 	registerSize = flags.RegisterSize
 	disableGarbageCollection = flags.DisableGC
+	symmetryReduction = flags.Symmetry
+	closedSystem = flags.Closed
+	reportBarbs = flags.Barbs
+	partialOrderReduction = flags.POR
+	symbolicSemantics = flags.Symbolic
+	lateSemantics = flags.Semantics == "late"
+	asyncSemantics = flags.Async
+	observedNames = flags.Observe
+	maxMemory = uint64(flags.MaxMemory) << 20
+	checkpointFile = flags.CheckpointFile
+	resumeFile = flags.ResumeFile
+	profiling = flags.Profile
 }
 
 // InteractiveMode allows the user to inspect interactively the LTS in a prompt.
@@ -43,7 +81,7 @@ func InteractiveMode(flags Flags) {
 		fmt.Print("> ")
 		reader := bufio.NewReader(os.Stdin)
 		input, _ := reader.ReadString('\n')
-		lts, err := generateLts([]byte(input))
+		lts, err := generateLts(context.Background(), []byte(input))
 		if err != nil {
 			fmt.Printf("error: %s\n", err)
 		} else {
@@ -55,7 +93,9 @@ func InteractiveMode(flags Flags) {
 
 // OutputMode generates an LTS from the pi-calculus program file and either writes
 // the output to a file, or prints the output if an output file is not specified.
-func OutputMode(flags Flags) error {
+// If the context is cancelled, or the timeout or memory limit is reached, the
+// partial LTS is output.
+func OutputMode(ctx context.Context, flags Flags) error {
 	initFlags(flags)
 	gvLayout = flags.GVLayout
 
@@ -66,16 +106,93 @@ func OutputMode(flags Flags) error {
 	}
 	inputTime := time.Since(inputTimeStart)
 
+	if !flags.AllEntries {
+		return outputLts(ctx, flags, input, inputTime)
+	}
+
+	// Generate the LTS of each entry, output to a file named after the entry.
+	entries, err := GetEntries(input, flags.InputFile)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		entryFlags := flags
+		entryFlags.Entry = entry
+		if flags.OutputFile != "" {
+			entryFlags.OutputFile = getEntryFile(flags.OutputFile, entry)
+		} else if !flags.Quiet || flags.Statistics || flags.Profile || flags.StatsJSON {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", entry)
+		}
+		initFlags(entryFlags)
+		if err := outputLts(ctx, entryFlags, input, inputTime); err != nil {
+			return fmt.Errorf("entry %s: %s", entry, err)
+		}
+	}
+	return nil
+}
+
+// getEntryFile returns the output file of an entry, with the name of the
+// entry appended to the name of the output file.
+func getEntryFile(outputFile string, entry string) string {
+	ext := path.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + "-" + entry + ext
+}
+
+// outputLts generates the LTS of the program and outputs it.
+func outputLts(ctx context.Context, flags Flags, input []byte, inputTime time.Duration) error {
+	if flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+		defer cancel()
+	}
+
+	if flags.Stream != "" && !flags.Quiet {
+		stream, err := newLtsStream(flags.Stream, flags.OutputFile)
+		if err != nil {
+			return err
+		}
+		outputStream = stream
+		defer func() {
+			outputStream = nil
+		}()
+	}
+
+	var progress *progressReporter
+	if flags.Progress {
+		progress = newProgressReporter(os.Stderr)
+		defer func(saved []Observer) {
+			observers = saved
+		}(observers)
+		observers = append(observers[:len(observers):len(observers)], progress)
+	}
+
 	programTimeStart := time.Now()
-	lts, err := generateLts(input)
+	lts, err := generateLts(ctx, input)
+	if progress != nil && progress.last.Elapsed != progress.lastReport {
+		progress.report()
+	}
+	streamed := outputStream != nil
+	if streamed {
+		if err := outputStream.close(lts.StatesUnique, lts.TransitionsUnique); err != nil {
+			return err
+		}
+	}
 	if err != nil {
 		return err
 	}
 	programElapsed := time.Since(programTimeStart)
+	if lts.Interrupted != nil {
+		fmt.Fprintf(os.Stderr, "warning: exploration interrupted: %s, %d unexplored states\n",
+			lts.Interrupted, len(lts.Frontier))
+	}
 
 	var outputTime time.Duration
 
-	if !flags.Quiet {
+	// A streamed LTS has been output while exploring.
+	if !flags.Quiet && !streamed {
 		if flags.OutputFile == "" {
 			// No output file specified. Print LTS.
 			output := generatePrettyLts(lts)
@@ -101,35 +218,85 @@ func OutputMode(flags Flags) error {
 		}
 	}
 
-	if flags.Statistics {
+	if flags.Statistics || flags.Profile || flags.StatsJSON {
 		if !flags.Quiet && flags.OutputFile == "" {
 			// Print new line if LTS is printed to standard output.
 			fmt.Println()
 		}
 		ioElapsed := inputTime + outputTime
-		fmt.Printf("states explored      %d\n", lts.StatesExplored)
-		fmt.Printf("states generated     %d\n", lts.StatesGenerated)
-		fmt.Printf("states unique        %d\n", len(lts.States))
-		fmt.Printf("transitions          %d\n", len(lts.Transitions))
-		fmt.Printf("time I/O             %s\n", ioElapsed)
-		fmt.Printf("time LTS generation  %s\n", programElapsed)
+		if flags.StatsJSON {
+			output, err := json.MarshalIndent(statistics{
+				StatesExplored:  lts.StatesExplored,
+				StatesGenerated: lts.StatesGenerated,
+				StatesUnique:    lts.StatesUnique,
+				Transitions:     lts.TransitionsUnique,
+				TimeIO:          ioElapsed,
+				TimeGeneration:  programElapsed,
+				Profile:         lts.Profile,
+			}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(output))
+		} else {
+			fmt.Printf("states explored      %d\n", lts.StatesExplored)
+			fmt.Printf("states generated     %d\n", lts.StatesGenerated)
+			fmt.Printf("states unique        %d\n", lts.StatesUnique)
+			fmt.Printf("transitions          %d\n", lts.TransitionsUnique)
+			fmt.Printf("time I/O             %s\n", ioElapsed)
+			fmt.Printf("time LTS generation  %s\n", programElapsed)
+			if lts.Profile != nil {
+				fmt.Print(lts.Profile)
+			}
+		}
 	}
 
 	return nil
 }
 
+// statistics are the LTS generation statistics in JSON.
+type statistics struct {
+	StatesExplored  int           `json:"states_explored"`
+	StatesGenerated int           `json:"states_generated"`
+	StatesUnique    int           `json:"states_unique"`
+	Transitions     int           `json:"transitions"`
+	TimeIO          time.Duration `json:"time_io_ns"`
+	TimeGeneration  time.Duration `json:"time_lts_generation_ns"`
+	Profile         *Profile      `json:"profile,omitempty"`
+}
+
 func writeFile(output []byte, outputFile string) error {
 	dir := path.Dir(outputFile)
 	os.MkdirAll(dir, os.ModePerm)
 	return ioutil.WriteFile(outputFile, output, 0644)
 }
 
-func generateLts(input []byte) (Lts, error) {
-	proc, err := InitProgram(input)
+func generateLts(ctx context.Context, input []byte) (Lts, error) {
+	if profiling {
+		profile = newProfile()
+		defer func() {
+			profile = nil
+		}()
+	}
+	start := startPhase()
+	proc, err := InitProgramFile(input, programFile)
+	endPhase(phaseParse, start)
 	if err != nil {
 		return Lts{}, err
 	}
+	if asyncSemantics {
+		if proc, err = initAsyncProcesses(proc); err != nil {
+			return Lts{}, err
+		}
+	}
+	if err := checkObservedNames(proc); err != nil {
+		return Lts{}, err
+	}
 	root := newRootConf(proc)
-	lts := explore(root)
-	return lts, nil
+	lts, err := explore(ctx, root)
+	if profile != nil {
+		profile.finish()
+		lts.Profile = profile
+	}
+	return lts, err
 }
@@ -1,6 +1,7 @@
 package pifra
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path"
@@ -83,7 +84,7 @@ func compareLts(t *testing.T, flags Flags, specificFlags map[string]Flags, testF
 		}
 		opts.OutputFile = outputPath
 		opts.InputFile = testPath
-		if err := OutputMode(opts); err != nil {
+		if err := OutputMode(context.Background(), opts); err != nil {
 			t.Error(err)
 		}
 	}
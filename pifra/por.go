@@ -0,0 +1,73 @@
+package pifra
+
+var partialOrderReduction bool
+
+// ampleTrans returns an ample set of the transitions of a normalised
+// configuration, or nil if the configuration must be fully expanded.
+//
+// The ample set consists of the transitions of a single parallel component
+// whose transitions are all internal. Such a component only acts on its own
+// private names, so its transitions are invisible and independent of the
+// transitions of the other components, and the other components cannot
+// communicate with it until it has moved. Exploring only these transitions
+// preserves the deadlocks and the reachable visible actions of the LTS,
+// provided the caller fully expands states whose ample set closes a cycle.
+//
+// The process constants unfolded to compute the ample set are returned rather
+// than notified, for the caller to notify if it explores the ample set.
+func ampleTrans(conf Configuration) ([]Configuration, *unfoldings) {
+	rootElem, ok := conf.Process.(*ElemRoot)
+	if !ok || rootElem.Next.Type() != ElemTypParallel {
+		return nil, nil
+	}
+	components := getPar(rootElem.Next)
+
+	var ample []Configuration
+	var unfolds *unfoldings
+	for i, component := range components {
+		componentUnfolds := newUnfoldings()
+		recordedUnfolds = componentUnfolds
+		tconfs := trans(Configuration{
+			Process:   component,
+			Registers: conf.Registers,
+		})
+		recordedUnfolds = nil
+		if len(tconfs) == 0 || (ample != nil && len(tconfs) >= len(ample)) {
+			continue
+		}
+		internal := true
+		for _, tconf := range tconfs {
+			if tconf.Label.Symbol.Type != SymbolTypTau {
+				internal = false
+				break
+			}
+		}
+		if !internal {
+			continue
+		}
+
+		// Place the successors of the component among the other
+		// components. Internal transitions leave the registers unchanged.
+		ample = nil
+		unfolds = componentUnfolds
+		for _, tconf := range tconfs {
+			elems := append([]Element{}, components...)
+			elems[i] = tconf.Process
+			var process Element = elems[len(elems)-1]
+			for j := len(elems) - 2; j >= 0; j-- {
+				process = &ElemParallel{
+					ProcessL: elems[j],
+					ProcessR: process,
+				}
+			}
+			ample = append(ample, Configuration{
+				Process: &ElemRoot{
+					Next: process,
+				},
+				Registers: conf.Registers,
+				Label:     tconf.Label,
+			})
+		}
+	}
+	return ample, unfolds
+}
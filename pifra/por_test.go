@@ -0,0 +1,92 @@
+package pifra
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAmpleTrans(t *testing.T) {
+	tests := map[string]struct {
+		input []byte
+		ample int
+	}{
+		"internal_component": {
+			input: []byte(`a(x).a(y).0 | $c.(c'<b>.0 | c(z).0)`),
+			ample: 1,
+		},
+		"least_internal_component": {
+			input: []byte(`$c.(c'<b>.0 | c(z).0 | c(z).0) | $d.(d'<b>.0 | d(z).0)`),
+			ample: 1,
+		},
+		"visible_components": {
+			input: []byte(`a(x).0 | b'<a>.0`),
+			ample: 0,
+		},
+		"communicating_components": {
+			input: []byte(`a(x).0 | a'<b>.0`),
+			ample: 0,
+		},
+		"single_component": {
+			input: []byte(`$c.(c'<b>.0 | c(z).0)`),
+			ample: 0,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, _ := InitProgram(tc.input)
+			conf := applyStructrualCongruence(newRootConf(proc))
+			ample, _ := ampleTrans(conf)
+			if len(ample) != tc.ample {
+				t.Errorf("ample transitions: %d, expected: %d", len(ample), tc.ample)
+			}
+		})
+	}
+}
+
+func TestPartialOrderReductionDeadlocks(t *testing.T) {
+	tests := map[string][]byte{
+		"independent": []byte(`
+a(x).b(y).0 | $c.(c'<a>.$d.(d'<a>.0 | d(w).0) | c(y).0) | $e.(e'<e>.0 | e(k).0)
+`),
+		"blocked": []byte(`
+$c.(c'<a>.a'<a>.0 | c(x).0) | $d.d(x).0
+`),
+		"cycle": []byte(`
+P(c) = c'<c>.P(c) + c(x).P(c)
+$c.(c'<c>.0 | P(c)) | a(x).0
+`),
+	}
+	deadlocks := func(input []byte) []string {
+		lts, _ := generateLts(context.Background(), input)
+		hasTrans := make(map[int]bool)
+		for _, trn := range lts.Transitions {
+			hasTrans[trn.Source] = true
+		}
+		var states []string
+		for id, conf := range lts.States {
+			if !hasTrans[id] {
+				states = append(states, prettyPrintRegister(conf.Registers)+PrettyPrintAst(conf.Process))
+			}
+		}
+		sort.Strings(states)
+		return states
+	}
+	maxStatesExplored = 1000
+	defer func() {
+		maxStatesExplored = 1
+		partialOrderReduction = false
+	}()
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			partialOrderReduction = false
+			expected := deadlocks(input)
+			partialOrderReduction = true
+			output := deadlocks(input)
+			if !reflect.DeepEqual(output, expected) {
+				t.Errorf("deadlocks: %v, expected: %v", output, expected)
+			}
+		})
+	}
+}
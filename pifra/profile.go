@@ -0,0 +1,178 @@
+package pifra
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type phase int
+
+const (
+	phaseParse phase = iota
+	phaseTrans
+	phaseEvalData
+	phaseRmMatches
+	phaseGarbageCollection
+	phaseRmRes
+	phaseScopeRes
+	phaseNormaliseNil
+	phaseNormaliseNames
+	phaseSortSumPar
+	phaseSortRes
+	phaseSymmetry
+	phaseKey
+
+	numPhases
+)
+
+var phaseNames = [numPhases]string{
+	"parse",
+	"trans",
+	"eval data",
+	"rm matches",
+	"gc",
+	"rm res",
+	"scope res",
+	"normalise nil",
+	"normalise names",
+	"sort sum par",
+	"sort res",
+	"symmetry",
+	"key",
+}
+
+var profiling bool
+
+// Profile of the current LTS generation, or nil if not profiling.
+var profile *Profile
+
+// Profile is the breakdown of an LTS generation by phase, with histograms of
+// the unique states.
+type Profile struct {
+	// Time spent in each phase.
+	Phases map[string]time.Duration `json:"phases_ns"`
+	// Number of generated states already visited.
+	DuplicateHits int `json:"duplicate_hits"`
+	// Number of unique states by number of registers.
+	RegisterSizes map[int]int `json:"register_sizes"`
+	// Number of unique states by number of process elements.
+	TermSizes map[int]int `json:"term_sizes"`
+
+	phases [numPhases]time.Duration
+}
+
+func newProfile() *Profile {
+	return &Profile{
+		Phases:        make(map[string]time.Duration),
+		RegisterSizes: make(map[int]int),
+		TermSizes:     make(map[int]int),
+	}
+}
+
+// startPhase returns the start time of a phase if profiling.
+func startPhase() time.Time {
+	if profile == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// endPhase adds the time since the start to the phase if profiling.
+func endPhase(p phase, start time.Time) {
+	if profile != nil {
+		profile.phases[p] += time.Since(start)
+	}
+}
+
+// endStartPhase ends the phase and returns the start time of the next phase
+// if profiling.
+func endStartPhase(p phase, start time.Time) time.Time {
+	if profile == nil {
+		return start
+	}
+	now := time.Now()
+	profile.phases[p] += now.Sub(start)
+	return now
+}
+
+// profileState adds a unique state to the histograms if profiling.
+func profileState(conf Configuration) {
+	if profile != nil {
+		profile.RegisterSizes[len(conf.Registers.Registers)]++
+		profile.TermSizes[getTermSize(conf.Process)]++
+	}
+}
+
+// profileDuplicate counts a generated state already visited if profiling.
+func profileDuplicate() {
+	if profile != nil {
+		profile.DuplicateHits++
+	}
+}
+
+// finish records the phase times by name.
+func (p *Profile) finish() {
+	for i, d := range p.phases {
+		p.Phases[phaseNames[i]] = d
+	}
+}
+
+// String returns the profile in the format of the statistics.
+func (p *Profile) String() string {
+	var sb strings.Builder
+	for i, d := range p.phases {
+		sb.WriteString(fmt.Sprintf("%-21s%s\n", "time "+phaseNames[i], d))
+	}
+	sb.WriteString(fmt.Sprintf("%-21s%d\n", "duplicate hits", p.DuplicateHits))
+	sb.WriteString(fmt.Sprintf("%-21s%s\n", "register sizes", prettyPrintHistogram(p.RegisterSizes)))
+	sb.WriteString(fmt.Sprintf("%-21s%s\n", "term sizes", prettyPrintHistogram(p.TermSizes)))
+	return sb.String()
+}
+
+// prettyPrintHistogram returns the histogram as "size:count" pairs in order
+// of size.
+func prettyPrintHistogram(histogram map[int]int) string {
+	var sizes []int
+	for size := range histogram {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+	var strs []string
+	for _, size := range sizes {
+		strs = append(strs, strconv.Itoa(size)+":"+strconv.Itoa(histogram[size]))
+	}
+	return strings.Join(strs, " ")
+}
+
+// getTermSize returns the number of elements of the process.
+func getTermSize(elem Element) int {
+	switch elem.Type() {
+	case ElemTypOutput:
+		return 1 + getTermSize(elem.(*ElemOutput).Next)
+	case ElemTypInput:
+		return 1 + getTermSize(elem.(*ElemInput).Next)
+	case ElemTypMatch:
+		return 1 + getTermSize(elem.(*ElemEquality).Next)
+	case ElemTypGuard:
+		return 1 + getTermSize(elem.(*ElemGuard).Next)
+	case ElemTypLet:
+		return 1 + getTermSize(elem.(*ElemLet).Next)
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		return 1 + getTermSize(ifElem.Then) + getTermSize(ifElem.Else)
+	case ElemTypRestriction:
+		return 1 + getTermSize(elem.(*ElemRestriction).Next)
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		return 1 + getTermSize(sumElem.ProcessL) + getTermSize(sumElem.ProcessR)
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		return 1 + getTermSize(parElem.ProcessL) + getTermSize(parElem.ProcessR)
+	case ElemTypRoot:
+		return getTermSize(elem.(*ElemRoot).Next)
+	}
+	return 1
+}
@@ -0,0 +1,76 @@
+package pifra
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Profile:      true,
+	}
+	lts, err := GenerateLts(context.Background(), []byte(`
+P(a) = a(x).$y.(x'<y>.0 | P(y))
+P(a) | b(z).[z=b]P(z)
+`), flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := lts.Profile
+	if p == nil {
+		t.Fatal("no profile")
+	}
+	if len(p.Phases) != int(numPhases) || p.Phases["trans"] == 0 || p.Phases["parse"] == 0 {
+		t.Errorf("phases: %v", p.Phases)
+	}
+	if p.DuplicateHits != lts.StatesGenerated-(lts.StatesUnique-1) {
+		t.Errorf("duplicate hits: %d, expected: %d", p.DuplicateHits,
+			lts.StatesGenerated-(lts.StatesUnique-1))
+	}
+	var registerSizes, termSizes int
+	for _, n := range p.RegisterSizes {
+		registerSizes += n
+	}
+	for _, n := range p.TermSizes {
+		termSizes += n
+	}
+	if registerSizes != lts.StatesUnique || termSizes != lts.StatesUnique {
+		t.Errorf("histogram totals: %d, %d, expected: %d", registerSizes, termSizes, lts.StatesUnique)
+	}
+
+	flags.Profile = false
+	lts, _ = GenerateLts(context.Background(), []byte(`a(x).0`), flags)
+	if lts.Profile != nil {
+		t.Error("profile without profiling")
+	}
+}
+
+func TestGetTermSize(t *testing.T) {
+	tests := map[string]struct {
+		input []byte
+		size  int
+	}{
+		"nil": {
+			input: []byte(`0`),
+			size:  1,
+		},
+		"prefixes": {
+			input: []byte(`a(x).b'<x>.0`),
+			size:  3,
+		},
+		"par_sum_res": {
+			input: []byte(`$a.(a'<b>.0 | b(x).0 + c(x).0)`),
+			size:  9,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, _ := InitProgram(tc.input)
+			if size := getTermSize(proc); size != tc.size {
+				t.Errorf("size: %d, expected: %d", size, tc.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package pifra
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// Time between progress reports.
+var progressInterval = time.Second
+
+// progressReporter is an observer periodically writing the progress of the
+// exploration.
+type progressReporter struct {
+	BaseObserver
+	w io.Writer
+
+	last        Stats
+	lastReport  time.Duration
+	transitions int
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	return &progressReporter{
+		w: w,
+	}
+}
+
+func (p *progressReporter) OnProgress(stats Stats) {
+	p.last = stats
+	if stats.Elapsed-p.lastReport >= progressInterval {
+		p.report()
+	}
+}
+
+// report writes the last statistics, with the transitions per second since
+// the previous report.
+func (p *progressReporter) report() {
+	stats := p.last
+	var rate float64
+	if elapsed := stats.Elapsed - p.lastReport; elapsed > 0 {
+		rate = float64(stats.Transitions-p.transitions) / elapsed.Seconds()
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	fmt.Fprintf(p.w, "[%s] explored %d, generated %d, unique %d, queued %d, "+
+		"%.0f transitions/s, depth %d, memory %d MiB\n",
+		stats.Elapsed.Round(time.Second), stats.StatesExplored, stats.StatesGenerated,
+		stats.StatesUnique, stats.StatesQueued, rate, stats.Depth, m.HeapAlloc>>20)
+
+	p.lastReport = stats.Elapsed
+	p.transitions = stats.Transitions
+}
@@ -0,0 +1,36 @@
+package pifra
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter(t *testing.T) {
+	progressInterval = 0
+	defer func() {
+		progressInterval = time.Second
+	}()
+	var output bytes.Buffer
+	progress := newProgressReporter(&output)
+	flags := Flags{
+		MaxStates:    5,
+		RegisterSize: 1073741824,
+	}
+	lts, err := GenerateLts(context.Background(), []byte(`a(x).b(y).c(z).0`), flags, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != lts.StatesExplored {
+		t.Fatalf("reports: %d, expected: %d", len(lines), lts.StatesExplored)
+	}
+	if !strings.Contains(lines[0], "explored 1, generated 4, unique 2, queued 1") {
+		t.Errorf("report: %s", lines[0])
+	}
+	if !strings.Contains(lines[len(lines)-1], "depth 3") {
+		t.Errorf("report: %s", lines[len(lines)-1])
+	}
+}
@@ -0,0 +1,405 @@
+package pifra
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The sorts of the names of a program are inferred before the exploration
+// by Milner's sorting: the objects of the prefixes on a channel have the same
+// sorts, so every channel has a sort ch<s1,...,sn>, and the arguments of the
+// calls of a process have the sorts of its parameters. The annotated sorts of
+// parameters, inputs and restrictions are the initial sorts of their names,
+// and data values and integer expressions have data sorts. Sorts may be
+// recursive, e.g. the sort of a channel carrying itself.
+
+// sortVar is a sort being inferred, which is unknown if its sort is SortAny.
+// The sort of a channel is given by the sort variables of its objects, and
+// the ranges of integer sorts are not distinguished. The free names, the
+// restricted names and the unannotated inputs are names, so their unknown
+// sorts cannot be data sorts.
+type sortVar struct {
+	parent  *sortVar
+	sort    Sort
+	objects []*sortVar
+	name    bool
+}
+
+func (v *sortVar) find() *sortVar {
+	if v.parent == nil {
+		return v
+	}
+	v.parent = v.parent.find()
+	return v.parent
+}
+
+// sortChecker infers the sorts of the names of a program.
+type sortChecker struct {
+	// Sort variables of the free names and of the bound names in scope.
+	names map[string]*sortVar
+	// Sort variables of the parameters of the declared processes.
+	params map[string][]*sortVar
+	// Position of the element being checked.
+	pos position
+}
+
+// checkSorts checks the sorts of the declared processes and the root
+// process, and returns the first sort or arity error.
+func checkSorts(proc Element) error {
+	c := &sortChecker{
+		names:  make(map[string]*sortVar),
+		params: make(map[string][]*sortVar),
+	}
+
+	var procNames []string
+	for name, dp := range DeclaredProcs {
+		procNames = append(procNames, name)
+		var params []*sortVar
+		for i := range dp.Parameters {
+			if dp.Sorts != nil {
+				params = append(params, newSortVar(dp.Sorts[i]))
+			} else {
+				params = append(params, &sortVar{})
+			}
+		}
+		c.params[name] = params
+	}
+	// Processes are checked in order of declaration, so that the first
+	// error is deterministic.
+	sort.Slice(procNames, func(i, j int) bool {
+		posI := declPositions[procNames[i]]
+		posJ := declPositions[procNames[j]]
+		if posI.file != posJ.file {
+			return posI.file < posJ.file
+		}
+		return posI.line < posJ.line
+	})
+
+	for _, name := range procNames {
+		dp := DeclaredProcs[name]
+		c.pos = declPositions[name]
+		if err := c.bind(dp.Parameters, c.params[name], func() error {
+			return c.check(dp.Process)
+		}); err != nil {
+			return err
+		}
+	}
+	return c.check(proc)
+}
+
+// newSortVar returns the sort variable of an annotated sort.
+func newSortVar(s Sort) *sortVar {
+	v := &sortVar{
+		sort: s,
+	}
+	if s.Type == SortChannel {
+		v.sort.Channel = nil
+		for _, object := range s.Channel.Objects {
+			v.objects = append(v.objects, newSortVar(object))
+		}
+	}
+	return v
+}
+
+// bind checks in the scope of the names bound to sort variables.
+func (c *sortChecker) bind(names []string, vars []*sortVar, check func() error) error {
+	type saved struct {
+		v  *sortVar
+		ok bool
+	}
+	var saves []saved
+	for i, name := range names {
+		v, ok := c.names[name]
+		saves = append(saves, saved{v, ok})
+		c.names[name] = vars[i]
+	}
+	err := check()
+	for i := len(names) - 1; i >= 0; i-- {
+		if saves[i].ok {
+			c.names[names[i]] = saves[i].v
+		} else {
+			delete(c.names, names[i])
+		}
+	}
+	return err
+}
+
+// nameVar returns the sort variable of a name or a data value.
+func (c *sortChecker) nameVar(name Name) *sortVar {
+	if name.Type == Data {
+		if _, ok := getBoolValue(name); ok {
+			return &sortVar{sort: Sort{Type: SortBool}}
+		}
+		return &sortVar{sort: Sort{Type: SortInt}}
+	}
+	v, ok := c.names[name.Name]
+	if !ok {
+		v = &sortVar{
+			name: true,
+		}
+		c.names[name.Name] = v
+	}
+	return v
+}
+
+// exprVar returns the sort variable of the value of an expression. The
+// operands of sums and differences are integers, and ciphertexts are not
+// sorted.
+func (c *sortChecker) exprVar(e *Expr) (*sortVar, error) {
+	switch e.Type {
+	case ExprName:
+		return c.nameVar(e.Name), nil
+	case ExprAdd, ExprSub:
+		for _, name := range getExprNames(e) {
+			if err := c.unify(c.nameVar(name), &sortVar{sort: Sort{Type: SortInt}},
+				"%s of sort %s is used with sort %s", name.Name); err != nil {
+				return nil, err
+			}
+		}
+		return &sortVar{sort: Sort{Type: SortInt}}, nil
+	}
+	for _, name := range getExprNames(e) {
+		c.nameVar(name)
+	}
+	return &sortVar{}, nil
+}
+
+// useChannel unifies the sort of a channel with the sort of the channels
+// carrying an object.
+func (c *sortChecker) useChannel(channel Name, object *sortVar) error {
+	v := c.nameVar(channel)
+	root := v.find()
+	if root.sort.Type == SortChannel && len(root.objects) != 1 {
+		return fmt.Errorf("%s: channel %s of sort %s has arity %d, but is used with arity 1",
+			c.pos, channel.Name, sortString(root), len(root.objects))
+	}
+	return c.unify(v, &sortVar{
+		sort: Sort{
+			Type: SortChannel,
+		},
+		objects: []*sortVar{object},
+	}, "%s of sort %s is used as a channel of sort %s", channel.Name)
+}
+
+// unify unifies two sort variables, or returns an error formatted with a
+// name and the sorts of the variables if they have different sorts.
+func (c *sortChecker) unify(a *sortVar, b *sortVar, format string, name string) error {
+	if !unifiable(a, b, make(map[[2]*sortVar]bool)) {
+		return fmt.Errorf("%s: "+format, c.pos, name, sortString(a), sortString(b))
+	}
+	unify(a, b)
+	return nil
+}
+
+// unifiable reports whether two sort variables can be unified, where the
+// pairs of variables already compared are assumed unifiable.
+func unifiable(a *sortVar, b *sortVar, seen map[[2]*sortVar]bool) bool {
+	a = a.find()
+	b = b.find()
+	if a == b || seen[[2]*sortVar{a, b}] {
+		return true
+	}
+	seen[[2]*sortVar{a, b}] = true
+	if a.sort.Type == SortAny {
+		return !a.name || !b.sort.isData()
+	}
+	if b.sort.Type == SortAny {
+		return !b.name || !a.sort.isData()
+	}
+	if a.sort.Type != b.sort.Type || len(a.objects) != len(b.objects) {
+		return false
+	}
+	for i := range a.objects {
+		if !unifiable(a.objects[i], b.objects[i], seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// unify unifies two unifiable sort variables. The variables are merged
+// before their objects, so that recursive sorts terminate.
+func unify(a *sortVar, b *sortVar) {
+	a = a.find()
+	b = b.find()
+	if a == b {
+		return
+	}
+	if a.sort.Type == SortAny {
+		a.parent = b
+		b.name = b.name || a.name
+		return
+	}
+	b.parent = a
+	if b.sort.Type == SortAny {
+		a.name = a.name || b.name
+		return
+	}
+	for i := range a.objects {
+		unify(a.objects[i], b.objects[i])
+	}
+}
+
+// sortString returns the sort of a sort variable, where an unknown sort is
+// "_", or "name" if it is a name, and a recursive occurrence of a channel
+// sort is "...".
+func sortString(v *sortVar) string {
+	visiting := make(map[*sortVar]bool)
+	var sortStringAcc func(v *sortVar) string
+	sortStringAcc = func(v *sortVar) string {
+		v = v.find()
+		switch v.sort.Type {
+		case SortAny:
+			if v.name {
+				return "name"
+			}
+			return "_"
+		case SortBool:
+			return "bool"
+		case SortInt:
+			return "int"
+		}
+		if visiting[v] {
+			return "..."
+		}
+		visiting[v] = true
+		var objects []string
+		for _, object := range v.objects {
+			objects = append(objects, sortStringAcc(object))
+		}
+		delete(visiting, v)
+		return "ch<" + strings.Join(objects, ",") + ">"
+	}
+	return sortStringAcc(v)
+}
+
+// check infers the sorts of the names of a process.
+func (c *sortChecker) check(elem Element) error {
+	if pos, ok := elemPositions[elem]; ok {
+		c.pos = pos
+	}
+	switch elem.Type() {
+	case ElemTypOutput:
+		outElem := elem.(*ElemOutput)
+		if err := c.useChannel(outElem.Channel, c.nameVar(outElem.Output)); err != nil {
+			return err
+		}
+		return c.check(outElem.Next)
+	case ElemTypInput:
+		inpElem := elem.(*ElemInput)
+		v := newSortVar(inpElem.Sort)
+		v.name = !inpElem.Sort.isData()
+		if err := c.useChannel(inpElem.Channel, v); err != nil {
+			return err
+		}
+		return c.bind([]string{inpElem.Input.Name}, []*sortVar{v}, func() error {
+			return c.check(inpElem.Next)
+		})
+	case ElemTypMatch:
+		matchElem := elem.(*ElemEquality)
+		if err := c.compare(matchElem.NameL, matchElem.NameR); err != nil {
+			return err
+		}
+		return c.check(matchElem.Next)
+	case ElemTypGuard:
+		guardElem := elem.(*ElemGuard)
+		if err := c.checkGuard(guardElem.Guard); err != nil {
+			return err
+		}
+		return c.check(guardElem.Next)
+	case ElemTypLet:
+		letElem := elem.(*ElemLet)
+		v, err := c.exprVar(letElem.Expr)
+		if err != nil {
+			return err
+		}
+		return c.bind([]string{letElem.Var.Name}, []*sortVar{v}, func() error {
+			return c.check(letElem.Next)
+		})
+	case ElemTypIf:
+		ifElem := elem.(*ElemIf)
+		if err := c.compare(ifElem.NameL, ifElem.NameR); err != nil {
+			return err
+		}
+		if err := c.check(ifElem.Then); err != nil {
+			return err
+		}
+		return c.check(ifElem.Else)
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		v := &sortVar{
+			name: true,
+		}
+		if s, ok := restrictionSorts[resElem]; ok {
+			if s.isData() {
+				return fmt.Errorf("%s: restricted name %s has sort %s", c.pos, resElem.Restrict.Name, s)
+			}
+			v = newSortVar(s)
+		}
+		return c.bind([]string{resElem.Restrict.Name}, []*sortVar{v}, func() error {
+			return c.check(resElem.Next)
+		})
+	case ElemTypSum:
+		sumElem := elem.(*ElemSum)
+		if err := c.check(sumElem.ProcessL); err != nil {
+			return err
+		}
+		return c.check(sumElem.ProcessR)
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		if err := c.check(parElem.ProcessL); err != nil {
+			return err
+		}
+		return c.check(parElem.ProcessR)
+	case ElemTypProcess:
+		return c.checkCall(elem.(*ElemProcess))
+	case ElemTypRoot:
+		return c.check(elem.(*ElemRoot).Next)
+	}
+	return nil
+}
+
+// compare unifies the sorts of two compared names.
+func (c *sortChecker) compare(nameL Name, nameR Name) error {
+	return c.unify(c.nameVar(nameL), c.nameVar(nameR), "%s of sort %s is compared with a name of sort %s", nameL.Name)
+}
+
+func (c *sortChecker) checkGuard(g *Guard) error {
+	switch g.Type {
+	case GuardAnd, GuardOr:
+		if err := c.checkGuard(g.GuardL); err != nil {
+			return err
+		}
+		return c.checkGuard(g.GuardR)
+	case GuardLess, GuardLessEqual:
+		for _, name := range []Name{g.NameL, g.NameR} {
+			if err := c.unify(c.nameVar(name), &sortVar{sort: Sort{Type: SortInt}},
+				"%s of sort %s is used with sort %s", name.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.compare(g.NameL, g.NameR)
+}
+
+// checkCall unifies the sorts of the arguments of a call of a declared
+// process with the sorts of its parameters.
+func (c *sortChecker) checkCall(procElem *ElemProcess) error {
+	dp, ok := DeclaredProcs[procElem.Name]
+	if !ok {
+		return nil
+	}
+	if len(procElem.Parameters) != len(dp.Parameters) {
+		return fmt.Errorf("%s: process %s has %d parameters, but is called with %d arguments",
+			c.pos, procElem.Name, len(dp.Parameters), len(procElem.Parameters))
+	}
+	for i, param := range procElem.Parameters {
+		if err := c.unify(c.nameVar(param), c.params[procElem.Name][i],
+			"argument %s of sort %s is passed for a parameter of sort %s", param.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
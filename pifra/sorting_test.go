@@ -0,0 +1,70 @@
+package pifra
+
+import "testing"
+
+func TestCheckSorts(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		err   string
+	}{
+		"inferred": {
+			input: "a(x).x(y: 0..2).[y < 2]0 | a'<b>.b'<1>.0",
+		},
+		"recursive": {
+			input: "a'<a>.a(x).x'<a>.0",
+		},
+		"annotated": {
+			input: "P(a: ch<ch<>>) = a(x).0\n$b: ch<>.$c.c'<b>.P(c)",
+		},
+		"data_parameter": {
+			input: "P(n) = a'<n>.0\nP(1) | P(2)",
+		},
+		"object_sort": {
+			input: "a'<b>.0 | a'<true>.0",
+			err:   "line 1: a of sort ch<name> is used as a channel of sort ch<bool>",
+		},
+		"arity": {
+			input: "$x: ch<>.x'<a>.0",
+			err:   "line 1: channel x of sort ch<> has arity 0, but is used with arity 1",
+		},
+		"data_channel": {
+			input: "P(n: 0..1) =\n  n'<a>.0\nP(0)",
+			err:   "line 2: n of sort int is used as a channel of sort ch<name>",
+		},
+		"argument": {
+			input: "P(a: ch<ch<>>) = 0\n$b: ch<bool>.P(b)",
+			err:   "line 2: argument b of sort ch<bool> is passed for a parameter of sort ch<ch<>>",
+		},
+		"call_arity": {
+			input: "P(x) = 0\nP(a, b)",
+			err:   "line 2: process P has 1 parameters, but is called with 2 arguments",
+		},
+		"comparison": {
+			input: "a(x: bool).[x = b]0",
+			err:   "line 1: x of sort bool is compared with a name of sort name",
+		},
+		"integer": {
+			input: "let x = true+1 in 0",
+			err:   "line 1: true of sort bool is used with sort int",
+		},
+		"restriction": {
+			input: "$x: bool.0",
+			err:   "line 1: restricted name x has sort bool",
+		},
+		"unknown_sort": {
+			input: "$x: chan<>.0",
+			err:   "line 1: unknown sort chan",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := InitProgram([]byte(tc.input))
+			if tc.err == "" && err != nil {
+				t.Errorf("error: %v", err)
+			}
+			if tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Errorf("error: %v, expected: %s", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package pifra
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ltsStream writes the states and transitions of an LTS as they are
+// discovered by the exploration.
+type ltsStream interface {
+	// writeState writes a newly discovered state.
+	writeState(id int, conf Configuration) error
+	// writeTransition writes a transition and the configuration of its
+	// destination.
+	writeTransition(trn Transition, dst Configuration) error
+	// flush writes the buffered output, so partial results survive crashes.
+	flush() error
+	// close completes the output with the final numbers of states and
+	// transitions.
+	close(states int, transitions int) error
+}
+
+// Stream the exploration writes to, or nil if the LTS is output at the end.
+var outputStream ltsStream
+
+var errStreamFormat = errors.New(`stream format must be "pretty", "aut" or "json"`)
+
+var errStreamAutFile = errors.New("streaming the .aut format requires an output file")
+
+// newLtsStream returns a stream writing in the format to the file, or to
+// the standard output if no file is specified.
+func newLtsStream(format string, outputFile string) (ltsStream, error) {
+	if format != "pretty" && format != "aut" && format != "json" {
+		return nil, errStreamFormat
+	}
+	if format == "aut" && outputFile == "" {
+		return nil, errStreamAutFile
+	}
+
+	file := os.Stdout
+	if outputFile != "" {
+		os.MkdirAll(path.Dir(outputFile), os.ModePerm)
+		var err error
+		if file, err = os.Create(outputFile); err != nil {
+			return nil, err
+		}
+	}
+	w := bufio.NewWriter(file)
+
+	switch format {
+	case "pretty":
+		return &prettyStream{
+			file: file,
+			w:    w,
+		}, nil
+	case "aut":
+		// The header is rewritten with the numbers of states and
+		// transitions when the stream is closed.
+		if _, err := fmt.Fprint(w, getAutHeader(0, 0)); err != nil {
+			return nil, err
+		}
+		return &autStream{
+			file: file,
+			w:    w,
+		}, nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonStream{
+		file: file,
+		w:    w,
+		enc:  enc,
+	}, nil
+}
+
+// closeFile closes the file unless it is the standard output.
+func closeFile(file *os.File) error {
+	if file == os.Stdout {
+		return nil
+	}
+	return file.Close()
+}
+
+// prettyStream writes the LTS in the pretty-printed format. States reaching
+// the register size are not marked, as they are only known once explored.
+type prettyStream struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+func (s *prettyStream) writeState(id int, conf Configuration) error {
+	if id != 0 {
+		return nil
+	}
+	_, err := io.WriteString(s.w, "s0 = "+
+		prettyPrintRegister(conf.Registers)+" |- "+PrettyPrintAst(conf.Process))
+	return err
+}
+
+func (s *prettyStream) writeTransition(trn Transition, dst Configuration) error {
+	_, err := io.WriteString(s.w, "\ns"+strconv.Itoa(trn.Source)+"  "+
+		prettyPrintLabel(trn.Label)+"  s"+strconv.Itoa(trn.Destination)+" = "+
+		prettyPrintRegister(dst.Registers)+" |- "+PrettyPrintAst(dst.Process))
+	return err
+}
+
+func (s *prettyStream) flush() error {
+	return s.w.Flush()
+}
+
+func (s *prettyStream) close(states int, transitions int) error {
+	if _, err := io.WriteString(s.w, "\n"); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return closeFile(s.file)
+}
+
+// autStream writes the LTS in the Aldebaran (.aut) format.
+type autStream struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// getAutHeader returns the .aut header padded to a fixed width, so that it
+// can be rewritten in place.
+func getAutHeader(states int, transitions int) string {
+	return fmt.Sprintf("des (0, %20d, %20d)\n", transitions, states)
+}
+
+func (s *autStream) writeState(id int, conf Configuration) error {
+	return nil
+}
+
+func (s *autStream) writeTransition(trn Transition, dst Configuration) error {
+	_, err := fmt.Fprintf(s.w, "(%d, %q, %d)\n", trn.Source, getAutLabel(trn.Label), trn.Destination)
+	return err
+}
+
+func getAutLabel(label Label) string {
+	if label.Symbol.Type == SymbolTypTau {
+		return "tau"
+	}
+	return strings.TrimSpace(prettyPrintLabel(label))
+}
+
+func (s *autStream) flush() error {
+	return s.w.Flush()
+}
+
+func (s *autStream) close(states int, transitions int) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.WriteAt([]byte(getAutHeader(states, transitions)), 0); err != nil {
+		return err
+	}
+	return closeFile(s.file)
+}
+
+// jsonStream writes the LTS as JSON lines, one object per state and
+// transition.
+type jsonStream struct {
+	file *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+type jsonState struct {
+	State     int            `json:"state"`
+	Registers map[int]string `json:"registers"`
+	Process   string         `json:"process"`
+}
+
+type jsonTransition struct {
+	Source      int    `json:"source"`
+	Label       string `json:"label"`
+	Destination int    `json:"destination"`
+}
+
+func (s *jsonStream) writeState(id int, conf Configuration) error {
+	return s.enc.Encode(jsonState{
+		State:     id,
+		Registers: conf.Registers.Registers,
+		Process:   PrettyPrintAst(conf.Process),
+	})
+}
+
+func (s *jsonStream) writeTransition(trn Transition, dst Configuration) error {
+	return s.enc.Encode(jsonTransition{
+		Source:      trn.Source,
+		Label:       strings.TrimSpace(prettyPrintLabel(trn.Label)),
+		Destination: trn.Destination,
+	})
+}
+
+func (s *jsonStream) flush() error {
+	return s.w.Flush()
+}
+
+func (s *jsonStream) close(states int, transitions int) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return closeFile(s.file)
+}
@@ -0,0 +1,63 @@
+package pifra
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	input := []byte(`
+P(a) = a(x).$y.(x'<y>.0 | P(y))
+P(a) | b(z).[z=b]P(z)
+`)
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input.pi")
+	if err := ioutil.WriteFile(inputFile, input, 0644); err != nil {
+		t.Fatal(err)
+	}
+	flags := Flags{
+		MaxStates:    20,
+		RegisterSize: 1073741824,
+		InputFile:    inputFile,
+		Pretty:       true,
+	}
+	outputMode := func(stream string, outputFile string) []byte {
+		opts := flags
+		opts.Stream = stream
+		opts.OutputFile = filepath.Join(dir, outputFile)
+		if err := OutputMode(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		output, err := ioutil.ReadFile(opts.OutputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+
+	expected := outputMode("", "expected.txt")
+	output := outputMode("pretty", "output.txt")
+	if !bytes.Equal(output, append(expected, '\n')) {
+		t.Errorf("streamed:\n%s\nexpected:\n%s", output, expected)
+	}
+
+	output = outputMode("aut", "output.aut")
+	lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	lts, _ := generateLts(context.Background(), input)
+	header := getAutHeader(len(lts.States), len(lts.Transitions))
+	if string(lines[0])+"\n" != header {
+		t.Errorf("header: %s, expected: %s", lines[0], header)
+	}
+	if len(lines)-1 != len(lts.Transitions) {
+		t.Errorf("transitions: %d, expected: %d", len(lines)-1, len(lts.Transitions))
+	}
+
+	output = outputMode("json", "output.json")
+	lines = bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	if len(lines) != len(lts.States)+len(lts.Transitions) {
+		t.Errorf("lines: %d, expected: %d", len(lines), len(lts.States)+len(lts.Transitions))
+	}
+}
@@ -0,0 +1,591 @@
+package pifra
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Explore the symbolic semantics, where inputs receive a variable instead of
+// every register name and a fresh name.
+var symbolicSemantics bool
+
+var varPrefix = "?"
+
+// Name of the constraint ?distinct(?k, a), that the variable ?k is distinct
+// from the name a. It is a process constant which cannot be declared, so it
+// has no transitions, and its names are substituted with the process.
+var distinctProcess = varPrefix + "distinct"
+
+// symbolicTrans returns the symbolic transitions of a configuration.
+//
+// Each input of the environment has a single transition, which substitutes a
+// variable ?k for the input name and is labelled "i ?k". The variable is not
+// in the registers, as its value is unknown. Once the transitions of a
+// configuration depend on the value of a variable, i.e. the variable is a
+// channel or the object of an output prefix, the configuration only has the
+// transitions instantiating the variable, labelled "?k=j" for each register
+// label j and "?k=j*" for a fresh name. A variable is also instantiated
+// before a fresh output, so that its value cannot be a name extruded after
+// its input.
+//
+// A match or conditional comparing a variable with the name of register j
+// only has the constraint transitions "?k=j", which substitutes the name for
+// the variable, and "?k!=j", which adds the constraint ?distinct(?k, a) that
+// the variable is distinct from the name a. The constraints decide the later
+// comparisons of the variable with the name, and exclude the name from the
+// instantiations of the variable.
+func symbolicTrans(conf Configuration) []Configuration {
+	vars := getVariables(conf.Process)
+	tconfs := trans(conf)
+
+	if len(vars) > 0 {
+		demanded, compared := getVariableDemands(conf.Process)
+		for _, v := range vars {
+			if demanded[v] {
+				return instantiateVariable(conf, v)
+			}
+		}
+		for _, v := range vars {
+			if len(compared[v]) > 0 {
+				return splitVariable(conf, v, compared[v][0])
+			}
+		}
+		for _, tconf := range tconfs {
+			if tconf.Label.Symbol2.Type == SymbolTypFreshOutput {
+				return instantiateVariable(conf, vars[0])
+			}
+		}
+	}
+
+	// The least variable index not in the configuration.
+	index := 1
+	for _, v := range vars {
+		if getVariableIndex(v) == index {
+			index++
+		}
+	}
+
+	var sconfs []Configuration
+	for _, tconf := range tconfs {
+		// The inputs of data values are kept as in the early semantics.
+		if tconf.Label.Symbol.Type != SymbolTypInput || isDataSymbol(tconf.Label.Symbol2) {
+			sconfs = append(sconfs, tconf)
+			continue
+		}
+		// The input of a fresh name stands for the inputs of all names,
+		// and the inputs of the register names are dropped.
+		if tconf.Label.Symbol2.Type != SymbolTypFreshInput {
+			continue
+		}
+		name := tconf.Registers.GetName(tconf.Label.Symbol2.Value)
+		tconf.Process = subName(tconf.Process, Name{
+			Name: name,
+		}, Name{
+			Name: varPrefix + strconv.Itoa(index),
+		})
+		tconf.Registers = conf.Registers
+		tconf.Label.Symbol2 = Symbol{
+			Type:  SymbolTypVariable,
+			Value: index,
+		}
+		sconfs = append(sconfs, tconf)
+	}
+	return sconfs
+}
+
+// instantiateVariable returns the configurations substituting each register
+// name the variable is not constrained to be distinct from, and a fresh name,
+// for the variable.
+func instantiateVariable(conf Configuration, v string) []Configuration {
+	varSymbol := Symbol{
+		Type:  SymbolTypVariable,
+		Value: getVariableIndex(v),
+	}
+
+	var confs []Configuration
+	for _, label := range conf.Registers.Labels() {
+		process, ok := resolveConstraints(subName(conf.Process, Name{
+			Name: v,
+		}, Name{
+			Name: conf.Registers.GetName(label),
+		}))
+		if !ok {
+			continue
+		}
+		iconf := conf
+		iconf.Process = process
+		iconf.Label = Label{
+			Symbol: varSymbol,
+			Symbol2: Symbol{
+				Type:  SymbolTypKnown,
+				Value: label,
+			},
+		}
+		confs = append(confs, iconf)
+	}
+
+	// The fresh name is renamed by the normalisation of fresh names.
+	name := bnPrefix + v
+	iconf := conf
+	iconf.Process, _ = resolveConstraints(subName(conf.Process, Name{
+		Name: v,
+	}, Name{
+		Name: name,
+	}))
+	iconf.Registers = conf.Registers.copy()
+	iconf.Label = Label{
+		Symbol: varSymbol,
+		Symbol2: Symbol{
+			Type:  SymbolTypFreshInput,
+			Value: iconf.Registers.UpdateMin(name, GetAllFreeNames(iconf.Process)),
+		},
+	}
+	return append(confs, iconf)
+}
+
+// splitVariable returns the configurations of the constraints that the
+// variable is the register name, which is substituted for the variable, and
+// that the variable is distinct from the name.
+func splitVariable(conf Configuration, v string, name Name) []Configuration {
+	varSymbol := Symbol{
+		Type:  SymbolTypVariable,
+		Value: getVariableIndex(v),
+	}
+	label := conf.Registers.GetLabel(name.Name)
+
+	var confs []Configuration
+	if process, ok := resolveConstraints(subName(conf.Process, Name{
+		Name: v,
+	}, name)); ok {
+		econf := conf
+		econf.Process = process
+		econf.Label = Label{
+			Symbol: varSymbol,
+			Symbol2: Symbol{
+				Type:  SymbolTypKnown,
+				Value: label,
+			},
+		}
+		confs = append(confs, econf)
+	}
+
+	constraint := &ElemProcess{
+		Name: distinctProcess,
+		Parameters: []Name{
+			{Name: v},
+			name,
+		},
+	}
+	dconf := conf
+	if rootElem, ok := conf.Process.(*ElemRoot); ok {
+		dconf.Process = &ElemRoot{
+			Next: &ElemParallel{
+				ProcessL: constraint,
+				ProcessR: rootElem.Next,
+			},
+		}
+	} else {
+		dconf.Process = &ElemParallel{
+			ProcessL: constraint,
+			ProcessR: conf.Process,
+		}
+	}
+	dconf.Label = Label{
+		Symbol: varSymbol,
+		Symbol2: Symbol{
+			Type:  SymbolTypDistinct,
+			Value: label,
+		},
+	}
+	return append(confs, dconf)
+}
+
+// getConstraints returns the names each variable is constrained to be
+// distinct from by the unguarded constraints of the process.
+func getConstraints(elem Element) map[string]map[string]bool {
+	constraints := make(map[string]map[string]bool)
+	var getConstraintsAcc func(elem Element)
+	getConstraintsAcc = func(elem Element) {
+		switch elem.Type() {
+		case ElemTypProcess:
+			procElem := elem.(*ElemProcess)
+			if procElem.Name != distinctProcess {
+				return
+			}
+			v := procElem.Parameters[0].Name
+			if constraints[v] == nil {
+				constraints[v] = make(map[string]bool)
+			}
+			constraints[v][procElem.Parameters[1].Name] = true
+		case ElemTypRestriction:
+			getConstraintsAcc(elem.(*ElemRestriction).Next)
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			getConstraintsAcc(parElem.ProcessL)
+			getConstraintsAcc(parElem.ProcessR)
+		case ElemTypRoot:
+			getConstraintsAcc(elem.(*ElemRoot).Next)
+		}
+	}
+	getConstraintsAcc(elem)
+	return constraints
+}
+
+// resolveConstraints returns the process without the constraints of the
+// instantiated variables, and whether they hold.
+func resolveConstraints(elem Element) (Element, bool) {
+	switch elem.Type() {
+	case ElemTypProcess:
+		procElem := elem.(*ElemProcess)
+		if procElem.Name != distinctProcess || isVariable(procElem.Parameters[0].Name) {
+			return elem, true
+		}
+		if procElem.Parameters[0].Name == procElem.Parameters[1].Name {
+			return elem, false
+		}
+		return &ElemNil{}, true
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		next, ok := resolveConstraints(resElem.Next)
+		if next != resElem.Next {
+			elem = &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
+		return elem, ok
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL, okL := resolveConstraints(parElem.ProcessL)
+		procR, okR := resolveConstraints(parElem.ProcessR)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			elem = &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+		return elem, okL && okR
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		next, ok := resolveConstraints(rootElem.Next)
+		if next != rootElem.Next {
+			elem = &ElemRoot{
+				Next: next,
+			}
+		}
+		return elem, ok
+	}
+	return elem, true
+}
+
+// getVariables returns the variables of the process in order.
+func getVariables(elem Element) []string {
+	set := make(map[string]bool)
+	for _, name := range GetAllFreeNames(elem) {
+		if isVariable(name) {
+			set[name] = true
+		}
+	}
+	var vars []string
+	for v := range set {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return getVariableIndex(vars[i]) < getVariableIndex(vars[j])
+	})
+	return vars
+}
+
+func isVariable(name string) bool {
+	return strings.HasPrefix(name, varPrefix)
+}
+
+func getVariableIndex(v string) int {
+	index, _ := strconv.Atoi(v[len(varPrefix):])
+	return index
+}
+
+// getDemandedVariables returns the variables the transitions of the process
+// depend on, i.e. the variables in the channels and outputs of the unguarded
+// prefixes and in the undecided unguarded matches and conditionals.
+func getDemandedVariables(elem Element) map[string]bool {
+	demanded, compared := getVariableDemands(elem)
+	for v := range compared {
+		demanded[v] = true
+	}
+	return demanded
+}
+
+// getVariableDemands returns the variables whose values the transitions of
+// the process depend on, and the register names each variable is compared
+// with by the undecided unguarded matches and conditionals, unfolding process
+// constants. A comparison of a variable with a restricted name, or with a
+// name it is constrained to be distinct from, is decided not to hold. The
+// processes guarded by matches which do not hold, and the branches of
+// conditionals not taken, are not considered.
+func getVariableDemands(elem Element) (map[string]bool, map[string][]Name) {
+	constraints := getConstraints(elem)
+	demanded := make(map[string]bool)
+	compared := make(map[string][]Name)
+	demand := func(name Name) {
+		for _, name := range getCipherNames(name) {
+			if name.Type == Free && isVariable(name.Name) {
+				demanded[name.Name] = true
+			}
+		}
+	}
+	// compare returns whether the names are equal if it is decided, and
+	// otherwise records the comparison.
+	compare := func(nameL Name, nameR Name) (equal bool, decided bool) {
+		if equal, decided := decideComparison(nameL, nameR, constraints); decided {
+			return equal, true
+		}
+		if isVariable(nameR.Name) {
+			nameL, nameR = nameR, nameL
+		}
+		if isVariable(nameR.Name) || nameR.Type != Free {
+			demand(nameL)
+			demand(nameR)
+		} else {
+			compared[nameL.Name] = append(compared[nameL.Name], nameR)
+		}
+		return false, false
+	}
+	// Process constants being unfolded, keyed by name and parameters.
+	unfolding := make(map[string]bool)
+
+	var getDemandedVariablesAcc func(elem Element)
+	getDemandedVariablesAcc = func(elem Element) {
+		switch elem.Type() {
+		case ElemTypOutput:
+			outElem := elem.(*ElemOutput)
+			demand(outElem.Channel)
+			demand(outElem.Output)
+		case ElemTypInput:
+			demand(elem.(*ElemInput).Channel)
+		case ElemTypMatch:
+			matchElem := elem.(*ElemEquality)
+			equal, decided := compare(matchElem.NameL, matchElem.NameR)
+			if decided && equal != matchElem.Inequality {
+				getDemandedVariablesAcc(matchElem.Next)
+			}
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			names := getGuardNames(guardElem.Guard)
+			for _, name := range names {
+				if isVariable(name.Name) {
+					for _, name := range names {
+						demand(name)
+					}
+					return
+				}
+			}
+			if guardElem.Guard.holds() {
+				getDemandedVariablesAcc(guardElem.Next)
+			}
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			for _, name := range getExprNames(letElem.Expr) {
+				demand(name)
+			}
+			getDemandedVariablesAcc(letElem.Next)
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			equal, decided := compare(ifElem.NameL, ifElem.NameR)
+			if !decided {
+				return
+			}
+			if equal != ifElem.Inequality {
+				getDemandedVariablesAcc(ifElem.Then)
+			} else {
+				getDemandedVariablesAcc(ifElem.Else)
+			}
+		case ElemTypRestriction:
+			getDemandedVariablesAcc(elem.(*ElemRestriction).Next)
+		case ElemTypSum:
+			sumElem := elem.(*ElemSum)
+			getDemandedVariablesAcc(sumElem.ProcessL)
+			getDemandedVariablesAcc(sumElem.ProcessR)
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			getDemandedVariablesAcc(parElem.ProcessL)
+			getDemandedVariablesAcc(parElem.ProcessR)
+		case ElemTypProcess:
+			procElem := elem.(*ElemProcess)
+			dp, ok := DeclaredProcs[procElem.Name]
+			if !ok || len(dp.Parameters) != len(procElem.Parameters) {
+				return
+			}
+			processKey := PrettyPrintAst(procElem)
+			if unfolding[processKey] {
+				return
+			}
+			proc := dp.Process
+			for i, oldName := range dp.Parameters {
+				proc = subName(proc, Name{
+					Name: oldName,
+				}, procElem.Parameters[i])
+			}
+			unfolding[processKey] = true
+			getDemandedVariablesAcc(proc)
+			delete(unfolding, processKey)
+		case ElemTypRoot:
+			getDemandedVariablesAcc(elem.(*ElemRoot).Next)
+		}
+	}
+	getDemandedVariablesAcc(elem)
+	return demanded, compared
+}
+
+// decideComparison returns whether the names compared by a match or
+// conditional are equal, and whether it is decided. A variable is not equal to
+// a restricted name, nor to a name it is constrained to be distinct from.
+func decideComparison(nameL Name, nameR Name, constraints map[string]map[string]bool) (equal bool, decided bool) {
+	if !isVariable(nameL.Name) && !isVariable(nameR.Name) || nameL == nameR {
+		return nameL.Name == nameR.Name, true
+	}
+	if isVariable(nameR.Name) {
+		nameL, nameR = nameR, nameL
+	}
+	if nameR.Type == Bound ||
+		nameR.Type == Free && !isVariable(nameR.Name) && constraints[nameL.Name][nameR.Name] {
+		return false, true
+	}
+	return false, false
+}
+
+// rmDecidedMatches returns the process with each unguarded match and
+// conditional comparing a variable replaced by its continuation if the
+// comparison is decided, and without the constraints of the variables or
+// names no longer in the process. Otherwise the variables of matches which can never
+// hold, and their constraints, would keep equal states apart.
+func rmDecidedMatches(elem Element) Element {
+	constraints := getConstraints(elem)
+	var rmDecidedMatchesAcc func(elem Element) Element
+	rmDecidedMatchesAcc = func(elem Element) Element {
+		switch elem.Type() {
+		case ElemTypMatch:
+			matchElem := elem.(*ElemEquality)
+			if !isVariable(matchElem.NameL.Name) && !isVariable(matchElem.NameR.Name) {
+				return elem
+			}
+			equal, decided := decideComparison(matchElem.NameL, matchElem.NameR, constraints)
+			if !decided {
+				return elem
+			}
+			if equal != matchElem.Inequality {
+				return rmDecidedMatchesAcc(matchElem.Next)
+			}
+			return &ElemNil{}
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			if !isVariable(ifElem.NameL.Name) && !isVariable(ifElem.NameR.Name) {
+				return elem
+			}
+			equal, decided := decideComparison(ifElem.NameL, ifElem.NameR, constraints)
+			if !decided {
+				return elem
+			}
+			if equal != ifElem.Inequality {
+				return rmDecidedMatchesAcc(ifElem.Then)
+			}
+			return rmDecidedMatchesAcc(ifElem.Else)
+		case ElemTypRestriction:
+			resElem := elem.(*ElemRestriction)
+			next := rmDecidedMatchesAcc(resElem.Next)
+			if next != resElem.Next {
+				return &ElemRestriction{
+					Restrict: resElem.Restrict,
+					Next:     next,
+				}
+			}
+		case ElemTypSum:
+			sumElem := elem.(*ElemSum)
+			procL := rmDecidedMatchesAcc(sumElem.ProcessL)
+			procR := rmDecidedMatchesAcc(sumElem.ProcessR)
+			if procL.Type() == ElemTypNil {
+				return procR
+			}
+			if procR.Type() == ElemTypNil {
+				return procL
+			}
+			if procL != sumElem.ProcessL || procR != sumElem.ProcessR {
+				return &ElemSum{
+					ProcessL: procL,
+					ProcessR: procR,
+				}
+			}
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			procL := rmDecidedMatchesAcc(parElem.ProcessL)
+			procR := rmDecidedMatchesAcc(parElem.ProcessR)
+			if procL != parElem.ProcessL || procR != parElem.ProcessR {
+				return &ElemParallel{
+					ProcessL: procL,
+					ProcessR: procR,
+				}
+			}
+		case ElemTypRoot:
+			rootElem := elem.(*ElemRoot)
+			next := rmDecidedMatchesAcc(rootElem.Next)
+			if next != rootElem.Next {
+				return &ElemRoot{
+					Next: next,
+				}
+			}
+		}
+		return elem
+	}
+	elem = rmDecidedMatchesAcc(elem)
+
+	// The names of the constraints are not free names of the process.
+	names := make(map[string]bool)
+	for _, name := range GetAllFreeNames(elem) {
+		names[name] = true
+	}
+	return rmConstraints(elem, func(v string, name string) bool {
+		return names[v] && (names[name] || markedNames[name])
+	})
+}
+
+// rmConstraints returns the process without the unguarded constraints that
+// are not live.
+func rmConstraints(elem Element, live func(v string, name string) bool) Element {
+	switch elem.Type() {
+	case ElemTypProcess:
+		procElem := elem.(*ElemProcess)
+		if procElem.Name == distinctProcess &&
+			!live(procElem.Parameters[0].Name, procElem.Parameters[1].Name) {
+			return &ElemNil{}
+		}
+	case ElemTypRestriction:
+		resElem := elem.(*ElemRestriction)
+		next := rmConstraints(resElem.Next, live)
+		if next != resElem.Next {
+			return &ElemRestriction{
+				Restrict: resElem.Restrict,
+				Next:     next,
+			}
+		}
+	case ElemTypParallel:
+		parElem := elem.(*ElemParallel)
+		procL := rmConstraints(parElem.ProcessL, live)
+		procR := rmConstraints(parElem.ProcessR, live)
+		if procL != parElem.ProcessL || procR != parElem.ProcessR {
+			return &ElemParallel{
+				ProcessL: procL,
+				ProcessR: procR,
+			}
+		}
+	case ElemTypRoot:
+		rootElem := elem.(*ElemRoot)
+		next := rmConstraints(rootElem.Next, live)
+		if next != rootElem.Next {
+			return &ElemRoot{
+				Next: next,
+			}
+		}
+	}
+	return elem
+}
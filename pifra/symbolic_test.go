@@ -0,0 +1,160 @@
+package pifra
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSymbolicSemantics(t *testing.T) {
+	input := []byte(`a(x).a(y).[x=b]c'<y>.0`)
+	output := `s0 = {(1,#1),(2,#2),(3,#3)} |- #1(&1).#1(&2).[&1=#2]#3'<&2>.0
+s0  1 ?1  s1 = {(1,#1),(2,#2),(3,#3)} |- #1(&1).[?1=#2]#3'<&1>.0
+s1  1 ?2  s2 = {(2,#2),(3,#3)} |- [?1=#2]#3'<?2>.0
+s2  ?1=2   s3 = {(2,#2),(3,#3)} |- [#2=#2]#3'<?2>.0
+s2  ?1!=2   s4 = {} |- 0
+s3  ?2=2   s5 = {(2,#2),(3,#3)} |- [#2=#2]#3'<#2>.0
+s3  ?2=3   s6 = {(2,#2),(3,#3)} |- [#2=#2]#3'<#3>.0
+s3  ?2=1*  s7 = {(1,#1),(2,#2),(3,#3)} |- [#2=#2]#3'<#1>.0
+s5  3'2   s4 = {} |- 0
+s6  3'3   s4 = {} |- 0
+s7  3'1   s4 = {} |- 0`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Symbolic:     true,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+// The constraint that a variable is distinct from a name decides the
+// comparisons with the name, which are removed, and excludes the name from
+// the instantiations of the variable.
+func TestSymbolicSemanticsConstraint(t *testing.T) {
+	input := []byte(`a(x).(([x=b]c'<x>.0) + ([x!=b]x'<b>.0))`)
+	output := `s0 = {(1,#1),(2,#2),(3,#3)} |- #1(&1).([&1!=#2]&1'<#2>.0 + [&1=#2]#3'<&1>.0)
+s0  1 ?1  s1 = {(2,#2),(3,#3)} |- ([?1!=#2]?1'<#2>.0 + [?1=#2]#3'<?1>.0)
+s1  ?1=2   s2 = {(2,#2),(3,#3)} |- ([#2!=#2]#2'<#2>.0 + [#2=#2]#3'<#2>.0)
+s1  ?1!=2   s3 = {(2,#2)} |- (?1'<#2>.0 | ?distinct(?1, #2))
+s2  3'2   s4 = {} |- 0
+s3  ?1=1*  s5 = {(1,#1),(2,#2)} |- #1'<#2>.0
+s5  1'2   s4 = {} |- 0`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Symbolic:     true,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+// A match of a variable with a restricted name never holds, so it is removed
+// with the variable and the states differing only in it are identified.
+func TestSymbolicSemanticsDecidedMatch(t *testing.T) {
+	input := []byte(`
+Store(pass) = $secret.pass'<secret>.Store(pass)
+Test(pass) = pub(x).pass(secret).(Test(pass) + [x=secret]bad'<bad>.0)
+$pass.(Store(pass) | Test(pass))
+`)
+	output := `s0 = {(1,#1),(2,#2)} |- $&1.(Store(&1) | Test(&1))
+s0  2 ?1  s1 = {(1,#1),(2,#2)} |- $&1.(&1(&2).(Test(&1) + [?1=&2]#1'<#1>.0) | Store(&1))
+s1  t     s0 = {(1,#1),(2,#2)} |- $&1.(Store(&1) | Test(&1))`
+
+	flags := Flags{
+		MaxStates:    100,
+		RegisterSize: 1073741824,
+		Symbolic:     true,
+	}
+	defer initFlags(Flags{
+		MaxStates:    1,
+		RegisterSize: 1073741824,
+	})
+	lts, err := GenerateLts(context.Background(), input, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(generatePrettyLts(lts)); out != output {
+		t.Errorf("output:\n%s\nexpected:\n%s", out, output)
+	}
+}
+
+func TestGetDemandedVariables(t *testing.T) {
+	tests := map[string]struct {
+		input    []byte
+		demanded map[string]bool
+	}{
+		"output": {
+			input: []byte(`v1'<v2>.v3'<v3>.0`),
+			demanded: map[string]bool{
+				"?1": true,
+				"?2": true,
+			},
+		},
+		"input": {
+			input: []byte(`v1(x).0 | a(y).v2'<y>.0`),
+			demanded: map[string]bool{
+				"?1": true,
+			},
+		},
+		"match": {
+			input: []byte(`([a=v1]v2'<a>.0) + ([a=b]v3'<a>.0) + ([a=a]v4'<a>.0)`),
+			demanded: map[string]bool{
+				"?1": true,
+				"?4": true,
+			},
+		},
+		"process": {
+			input: []byte(`
+P(x, y) = x'<x>.0 | P(y, x)
+P(v1, v2) | a(z).P(v3, v3)
+`),
+			demanded: map[string]bool{
+				"?1": true,
+				"?2": true,
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, err := InitProgram(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Variables cannot be parsed, so the names vk are
+			// substituted by the variables ?k.
+			for i := 1; i <= 4; i++ {
+				proc = subName(proc, Name{
+					Name: "v" + strconv.Itoa(i),
+				}, Name{
+					Name: varPrefix + strconv.Itoa(i),
+				})
+			}
+			demanded := getDemandedVariables(proc)
+			if !reflect.DeepEqual(demanded, tc.demanded) {
+				t.Errorf("demanded: %v, expected: %v", demanded, tc.demanded)
+			}
+		})
+	}
+}
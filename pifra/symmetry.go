@@ -0,0 +1,496 @@
+package pifra
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var symmetryReduction bool
+
+// Free names occurring in the process definitions and marked names. These
+// are never renamed by symmetry reduction.
+var symmetryFixedNames map[string]bool
+
+func initSymmetryReduction(root Configuration) {
+	symmetryFixedNames = make(map[string]bool)
+	initialNames := make(map[string]bool)
+	for _, name := range root.Registers.Registers {
+		initialNames[name] = true
+		if markedNames[name] || hiddenNames[name] {
+			symmetryFixedNames[name] = true
+		}
+	}
+	for _, dp := range DeclaredProcs {
+		for _, name := range getNames(dp.Process) {
+			if initialNames[name.Name] {
+				symmetryFixedNames[name.Name] = true
+			}
+		}
+	}
+}
+
+// Maximum number of passes of the symmetry reduction of a configuration.
+const maxSymmetryPasses = 3
+
+// reduceSymmetry returns a representative of the configuration up to
+// permutation of isomorphic parallel components and relabelling of the
+// registers holding names created during exploration. The configuration must
+// be in normal form.
+//
+// Each component has a shape, i.e. the hash of its structure with local
+// names numbered by first occurrence, refined by the shapes of the components
+// sharing a non-fixed free name with it. The components are sorted by shape,
+// and the non-fixed free names are then renamed in order of first occurrence.
+// The representative is not guaranteed to be canonical, which only weakens
+// the reduction.
+//
+// Renaming may reorder the normalised configuration, so the reduction is
+// repeated until the configuration is stable, up to maxSymmetryPasses.
+//
+// The registers of the representative are a relabelling of the registers of
+// the configuration, which is recorded in its label. The fresh name of the
+// label is relabelled to the register of the representative holding it.
+func reduceSymmetry(conf Configuration) Configuration {
+	label := conf.Label
+	relabelling := make(map[int]int)
+	for l := range conf.Registers.Registers {
+		relabelling[l] = l
+	}
+	for pass := 0; pass < maxSymmetryPasses; pass++ {
+		next, step, changed := reduceSymmetryStep(conf)
+		if !changed {
+			break
+		}
+		for l, current := range relabelling {
+			if newLabel, ok := step[current]; ok {
+				relabelling[l] = newLabel
+			}
+		}
+		conf = next
+	}
+	conf.Label = relabel(label, relabelling, conf.Registers)
+	return conf
+}
+
+// reduceSymmetryStep returns the configuration with its components sorted by
+// shape and its non-fixed free names renamed, the new labels of the
+// relabelled registers, and whether the configuration is changed.
+func reduceSymmetryStep(conf Configuration) (Configuration, map[int]int, bool) {
+	rootElem, ok := conf.Process.(*ElemRoot)
+	if !ok {
+		return conf, nil, false
+	}
+	components := []Element{rootElem.Next}
+	if rootElem.Next.Type() == ElemTypParallel {
+		components = getPar(rootElem.Next)
+	}
+
+	// Refine the shape of each component with the shapes of the components
+	// sharing a non-fixed free name with it.
+	baseShapes := make([]uint64, len(components))
+	componentNames := make([][]string, len(components))
+	sharing := make(map[string][]int)
+	for i, component := range components {
+		baseShapes[i] = getComponentShape(component)
+		seen := make(map[string]bool)
+		for _, name := range getNames(component) {
+			if isSymmetricName(name) && !seen[name.Name] {
+				seen[name.Name] = true
+				componentNames[i] = append(componentNames[i], name.Name)
+				sharing[name.Name] = append(sharing[name.Name], i)
+			}
+		}
+	}
+	shapes := make([][]uint64, len(components))
+	for i := range components {
+		var neighbours []uint64
+		for _, name := range componentNames[i] {
+			for _, other := range sharing[name] {
+				if other != i {
+					neighbours = append(neighbours, baseShapes[other])
+				}
+			}
+		}
+		sort.Slice(neighbours, func(j, k int) bool {
+			return neighbours[j] < neighbours[k]
+		})
+		shapes[i] = append([]uint64{baseShapes[i]}, neighbours...)
+	}
+
+	order := make([]int, len(components))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lessShape(shapes[order[i]], shapes[order[j]])
+	})
+	ordering := make([]Element, len(components))
+	for i, j := range order {
+		ordering[i] = components[j]
+	}
+	return renameSymmetricNames(conf, ordering)
+}
+
+// lessShape reports whether the refined shape a is ordered before b.
+func lessShape(a []uint64, b []uint64) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func isSymmetricName(name Name) bool {
+	return name.Type == Free && !symmetryFixedNames[name.Name] && !isVariable(name.Name)
+}
+
+// renameSymmetricNames renames the non-fixed free names in order of first
+// occurrence in the ordered components, permutes their register labels
+// accordingly and normalises the result. It also returns the new labels of
+// the relabelled registers, and whether the configuration is changed.
+func renameSymmetricNames(conf Configuration, components []Element) (Configuration, map[int]int, bool) {
+	var order []string
+	seen := make(map[string]bool)
+	visit := func(name Name) {
+		if isSymmetricName(name) && !seen[name.Name] {
+			seen[name.Name] = true
+			order = append(order, name.Name)
+		}
+	}
+	for _, component := range components {
+		for _, name := range getNames(component) {
+			visit(name)
+		}
+	}
+	// Names only held by the register are ordered by label.
+	for _, label := range conf.Registers.Labels() {
+		visit(Name{
+			Name: conf.Registers.GetName(label),
+		})
+	}
+
+	// Canonical names are the least names not among the fixed names.
+	newNames := make(map[string]string)
+	fni := 1
+	for _, name := range order {
+		fn := fnPrefix + strconv.Itoa(fni)
+		for symmetryFixedNames[fn] {
+			fni = fni + 1
+			fn = fnPrefix + strconv.Itoa(fni)
+		}
+		fni = fni + 1
+		newNames[name] = fn
+	}
+
+	// Rebuild the process with the components in order, so that bound
+	// names are numbered in order when normalised.
+	var process Element = components[len(components)-1]
+	for i := len(components) - 2; i >= 0; i-- {
+		process = &ElemParallel{
+			ProcessL: components[i],
+			ProcessR: process,
+		}
+	}
+	process = &ElemRoot{
+		Next: process,
+	}
+
+	// Rename through temporary names so renamings do not overlap.
+	for i, name := range order {
+		process = subName(process, Name{
+			Name: name,
+		}, Name{
+			Name: "%" + strconv.Itoa(i),
+		})
+	}
+	for i, name := range order {
+		process = subName(process, Name{
+			Name: "%" + strconv.Itoa(i),
+		}, Name{
+			Name: newNames[name],
+		})
+	}
+
+	// The renamed names are placed at the least labels not holding a fixed
+	// name, in order of the new names.
+	registers := make(map[int]string)
+	for label, name := range conf.Registers.Registers {
+		if _, ok := newNames[name]; !ok {
+			registers[label] = name
+		}
+	}
+	relabelling := make(map[int]int)
+	label := 1
+	for _, name := range order {
+		for _, ok := registers[label]; ok; _, ok = registers[label] {
+			label++
+		}
+		registers[label] = newNames[name]
+		if oldLabel := conf.Registers.GetLabel(name); oldLabel != -1 {
+			relabelling[oldLabel] = label
+		}
+	}
+
+	// The configuration is stable if the components are in order, and the
+	// names and their labels are unchanged.
+	changed := false
+	for name, newName := range newNames {
+		if name != newName {
+			changed = true
+		}
+	}
+	for oldLabel, newLabel := range relabelling {
+		if oldLabel != newLabel {
+			changed = true
+		}
+	}
+	if rootElem := conf.Process.(*ElemRoot); !changed && rootElem.Next.Type() == ElemTypParallel {
+		for i, component := range getPar(rootElem.Next) {
+			if component != components[i] {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return conf, nil, false
+	}
+
+	conf.Process = process
+	conf.Registers = Registers{
+		Size:      conf.Registers.Size,
+		Registers: registers,
+	}
+	return applyStructrualCongruence(conf), relabelling, true
+}
+
+// relabel returns the label with its fresh name relabelled and the
+// relabelling of the other registers recorded. A fresh name discarded from the
+// registers keeps its label unless another register is relabelled to it, in
+// which case it takes the least label not held in the registers.
+func relabel(label Label, relabelling map[int]int, registers Registers) Label {
+	fresh := -1
+	for _, symbol := range []*Symbol{&label.Symbol, &label.Symbol2} {
+		if symbol.Type == SymbolTypFreshInput || symbol.Type == SymbolTypFreshOutput {
+			fresh = symbol.Value
+			if newLabel, ok := relabelling[symbol.Value]; ok {
+				symbol.Value = newLabel
+			} else if _, ok := registers.Registers[symbol.Value]; ok {
+				newLabel := 1
+				for _, ok := registers.Registers[newLabel]; ok; _, ok = registers.Registers[newLabel] {
+					newLabel++
+				}
+				symbol.Value = newLabel
+			}
+		}
+	}
+
+	var labels []int
+	for l, newLabel := range relabelling {
+		if l != newLabel && l != fresh {
+			labels = append(labels, l)
+		}
+	}
+	sort.Ints(labels)
+	var pairs []string
+	for _, l := range labels {
+		pairs = append(pairs, strconv.Itoa(l)+"→"+strconv.Itoa(relabelling[l]))
+	}
+	label.Relabelling = strings.Join(pairs, ",")
+	return label
+}
+
+// getComponentShape returns the hash of the structure of the component, where
+// the bound names and the non-fixed free names are numbered by first
+// occurrence.
+func getComponentShape(elem Element) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	writeInt := func(i uint64) {
+		binary.LittleEndian.PutUint64(buf, i)
+		h.Write(buf)
+	}
+	local := make(map[Name]uint64)
+	var writeName func(name Name)
+	writeName = func(name Name) {
+		writeInt(uint64(name.Type))
+		switch {
+		case name.Type == Ciphertext:
+			writeName(name.Cipher.Message)
+			writeName(name.Cipher.Key)
+		case name.Type == Bound || isSymmetricName(name):
+			if _, ok := local[name]; !ok {
+				local[name] = uint64(len(local))
+			}
+			writeInt(local[name])
+		default:
+			writeInt(uint64(len(name.Name)))
+			h.Write([]byte(name.Name))
+		}
+	}
+	var writeExpr func(e *Expr)
+	writeExpr = func(e *Expr) {
+		writeInt(uint64(e.Type))
+		if e.Type == ExprName {
+			writeName(e.Name)
+			return
+		}
+		writeExpr(e.ExprL)
+		writeExpr(e.ExprR)
+	}
+	var writeGuard func(g *Guard)
+	writeGuard = func(g *Guard) {
+		writeInt(uint64(g.Type))
+		if !g.isComparison() {
+			writeGuard(g.GuardL)
+			writeGuard(g.GuardR)
+			return
+		}
+		if g.Inequality {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+		writeName(g.NameL)
+		writeName(g.NameR)
+	}
+	writeBool := func(b bool) {
+		if b {
+			writeInt(1)
+		} else {
+			writeInt(0)
+		}
+	}
+
+	var writeElem func(elem Element)
+	writeElem = func(elem Element) {
+		writeInt(uint64(elem.Type()))
+		switch elem.Type() {
+		case ElemTypOutput:
+			outElem := elem.(*ElemOutput)
+			writeName(outElem.Channel)
+			writeName(outElem.Output)
+			writeElem(outElem.Next)
+		case ElemTypInput:
+			inpElem := elem.(*ElemInput)
+			writeName(inpElem.Channel)
+			writeName(inpElem.Input)
+			writeInt(uint64(inpElem.Sort.Type))
+			writeInt(uint64(inpElem.Sort.Min))
+			writeInt(uint64(inpElem.Sort.Max))
+			writeElem(inpElem.Next)
+		case ElemTypMatch:
+			matchElem := elem.(*ElemEquality)
+			writeBool(matchElem.Inequality)
+			writeName(matchElem.NameL)
+			writeName(matchElem.NameR)
+			writeElem(matchElem.Next)
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			writeGuard(guardElem.Guard)
+			writeElem(guardElem.Next)
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			writeName(letElem.Var)
+			writeExpr(letElem.Expr)
+			writeElem(letElem.Next)
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			writeBool(ifElem.Inequality)
+			writeName(ifElem.NameL)
+			writeName(ifElem.NameR)
+			writeElem(ifElem.Then)
+			writeElem(ifElem.Else)
+		case ElemTypRestriction:
+			resElem := elem.(*ElemRestriction)
+			writeName(resElem.Restrict)
+			writeElem(resElem.Next)
+		case ElemTypSum:
+			sumElem := elem.(*ElemSum)
+			writeElem(sumElem.ProcessL)
+			writeElem(sumElem.ProcessR)
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			writeElem(parElem.ProcessL)
+			writeElem(parElem.ProcessR)
+		case ElemTypProcess:
+			procElem := elem.(*ElemProcess)
+			writeInt(uint64(len(procElem.Name)))
+			h.Write([]byte(procElem.Name))
+			writeInt(uint64(len(procElem.Parameters)))
+			for _, param := range procElem.Parameters {
+				writeName(param)
+			}
+		case ElemTypRoot:
+			writeElem(elem.(*ElemRoot).Next)
+		}
+	}
+	writeElem(elem)
+	return h.Sum64()
+}
+
+// getNames returns the names of the element in pretty-printed order.
+func getNames(elem Element) []Name {
+	var names []Name
+	var getNamesAcc func(elem Element)
+	getNamesAcc = func(elem Element) {
+		switch elem.Type() {
+		case ElemTypNil:
+		case ElemTypOutput:
+			outElem := elem.(*ElemOutput)
+			names = append(names, outElem.Channel, outElem.Output)
+			getNamesAcc(outElem.Next)
+		case ElemTypInput:
+			inpElem := elem.(*ElemInput)
+			names = append(names, inpElem.Channel, inpElem.Input)
+			getNamesAcc(inpElem.Next)
+		case ElemTypMatch:
+			matchElem := elem.(*ElemEquality)
+			names = append(names, matchElem.NameL, matchElem.NameR)
+			getNamesAcc(matchElem.Next)
+		case ElemTypGuard:
+			guardElem := elem.(*ElemGuard)
+			names = append(names, getGuardNames(guardElem.Guard)...)
+			getNamesAcc(guardElem.Next)
+		case ElemTypLet:
+			letElem := elem.(*ElemLet)
+			names = append(names, letElem.Var)
+			names = append(names, getExprNames(letElem.Expr)...)
+			getNamesAcc(letElem.Next)
+		case ElemTypIf:
+			ifElem := elem.(*ElemIf)
+			names = append(names, ifElem.NameL, ifElem.NameR)
+			getNamesAcc(ifElem.Then)
+			getNamesAcc(ifElem.Else)
+		case ElemTypRestriction:
+			resElem := elem.(*ElemRestriction)
+			names = append(names, resElem.Restrict)
+			getNamesAcc(resElem.Next)
+		case ElemTypSum:
+			sumElem := elem.(*ElemSum)
+			getNamesAcc(sumElem.ProcessL)
+			getNamesAcc(sumElem.ProcessR)
+		case ElemTypParallel:
+			parElem := elem.(*ElemParallel)
+			getNamesAcc(parElem.ProcessL)
+			getNamesAcc(parElem.ProcessR)
+		case ElemTypProcess:
+			procElem := elem.(*ElemProcess)
+			names = append(names, procElem.Parameters...)
+		case ElemTypRoot:
+			rootElem := elem.(*ElemRoot)
+			getNamesAcc(rootElem.Next)
+		}
+	}
+	getNamesAcc(elem)
+
+	// The names of ciphertexts are in pretty-printed order.
+	var cipherNames []Name
+	for _, name := range names {
+		cipherNames = append(cipherNames, getCipherNames(name)...)
+	}
+	return cipherNames
+}
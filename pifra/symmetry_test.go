@@ -0,0 +1,167 @@
+package pifra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReduceSymmetry(t *testing.T) {
+	tests := map[string]struct {
+		inputA []byte
+		inputB []byte
+		equal  bool
+	}{
+		"permuted_components": {
+			inputA: []byte(`a'<b>.0 | b(x).0`),
+			inputB: []byte(`b'<a>.0 | a(x).0`),
+			equal:  true,
+		},
+		"permuted_replicas": {
+			inputA: []byte(`a(x).b'<x>.0 | c(x).d'<x>.0`),
+			inputB: []byte(`c(x).b'<x>.0 | a(x).d'<x>.0`),
+			equal:  true,
+		},
+		"different_structure": {
+			inputA: []byte(`a'<b>.0 | b(x).0`),
+			inputB: []byte(`a'<b>.0 | a(x).0`),
+			equal:  false,
+		},
+		"fixed_names": {
+			inputA: []byte(`_a'<b>.0 | b(x).0`),
+			inputB: []byte(`b'<_a>.0 | _a(x).0`),
+			equal:  false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			reduce := func(input []byte) string {
+				proc, _ := InitProgram(input)
+				root := newRootConf(proc)
+				initSymmetryReduction(root)
+				conf := reduceSymmetry(applyStructrualCongruence(root))
+				return prettyPrintRegister(conf.Registers) + PrettyPrintAst(conf.Process)
+			}
+			keyA := reduce(tc.inputA)
+			keyB := reduce(tc.inputB)
+			if (keyA == keyB) != tc.equal {
+				t.Errorf("%s, %s: equal: %t, expected: %t", keyA, keyB, keyA == keyB, tc.equal)
+			}
+		})
+	}
+}
+
+func TestReduceSymmetryIdempotent(t *testing.T) {
+	proc, _ := InitProgram([]byte(`a(x).$y.(x'<y>.0 | b'<y>.0) | c(x).$y.(x'<y>.0 | d'<y>.0)`))
+	root := newRootConf(proc)
+	initSymmetryReduction(root)
+	for _, conf := range trans(root) {
+		conf = reduceSymmetry(applyStructrualCongruence(conf))
+		again := reduceSymmetry(conf)
+		key := prettyPrintRegister(conf.Registers) + PrettyPrintAst(conf.Process)
+		keyAgain := prettyPrintRegister(again.Registers) + PrettyPrintAst(again.Process)
+		if key != keyAgain {
+			t.Errorf("reduced: %s, expected: %s", keyAgain, key)
+		}
+	}
+}
+
+func TestReduceSymmetryTraces(t *testing.T) {
+	tests := map[string][]byte{
+		"received_channel":       []byte(`a(x).x'<b>.0`),
+		"received_output":        []byte(`a(x).b'<x>.x(y).0`),
+		"received_channel_input": []byte(`a(x).b(y).x'<y>.0`),
+		"fresh_output":           []byte(`a'<b>.a'<b>.0 | $c.b'<c>.c(x).0`),
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracesA := symmetryTraces(t, input, false)
+			tracesB := symmetryTraces(t, input, true)
+			if len(tracesA) != len(tracesB) {
+				t.Fatalf("traces: %v, expected: %v", tracesB, tracesA)
+			}
+			for trace := range tracesA {
+				if !tracesB[trace] {
+					t.Errorf("traces: %v, expected: %v", tracesB, tracesA)
+				}
+			}
+		})
+	}
+}
+
+// symmetryTraces returns the traces of the LTS of the program, with the
+// register labels of each trace replaced by the names they hold, numbered by
+// first occurrence in the trace. The LTS must be acyclic.
+func symmetryTraces(t *testing.T, input []byte, symmetry bool) map[string]bool {
+	symmetryReduction = symmetry
+	maxStatesExplored = 100
+	defer func() {
+		symmetryReduction = false
+		maxStatesExplored = 1
+	}()
+	proc, err := InitProgram(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lts, err := explore(context.Background(), newRootConf(proc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traces := make(map[string]bool)
+	var walk func(state int, names map[int]int, fresh int, trace []int)
+	walk = func(state int, names map[int]int, fresh int, trace []int) {
+		end := true
+		for _, trn := range lts.Transitions {
+			if trn.Source != state {
+				continue
+			}
+			end = false
+			next := make(map[int]int)
+			for label, name := range names {
+				next[label] = name
+			}
+			if trn.Label.Relabelling != "" {
+				for _, pair := range strings.Split(trn.Label.Relabelling, ",") {
+					var label, newLabel int
+					fmt.Sscanf(pair, "%d→%d", &label, &newLabel)
+					next[newLabel] = names[label]
+				}
+			}
+			step := append([]int{}, trace...)
+			for _, symbol := range []Symbol{trn.Label.Symbol, trn.Label.Symbol2} {
+				switch symbol.Type {
+				case SymbolTypFreshInput, SymbolTypFreshOutput:
+					fresh--
+					next[symbol.Value] = fresh
+					step = append(step, fresh)
+				case SymbolTypInput, SymbolTypOutput, SymbolTypKnown:
+					step = append(step, names[symbol.Value])
+				}
+			}
+			walk(trn.Destination, next, fresh, append(step, 0))
+		}
+		if end {
+			numbers := make(map[int]int)
+			var sb strings.Builder
+			for _, name := range trace {
+				if name == 0 {
+					sb.WriteString(";")
+					continue
+				}
+				if _, ok := numbers[name]; !ok {
+					numbers[name] = len(numbers) + 1
+				}
+				fmt.Fprintf(&sb, " %d", numbers[name])
+			}
+			traces[sb.String()] = true
+		}
+	}
+	names := make(map[int]int)
+	for label := range lts.States[0].Registers.Registers {
+		names[label] = label
+	}
+	walk(0, names, 0, nil)
+	return traces
+}
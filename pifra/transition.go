@@ -1,10 +1,9 @@
 package pifra
 
 import (
+	"fmt"
 	"sort"
 	"strconv"
-
-	"github.com/mohae/deepcopy"
 )
 
 var maxStatesExplored = 1
@@ -14,6 +13,13 @@ type Configuration struct {
 	Process   Element
 	Registers Registers
 	Label     Label
+
+	// Ciphertext sent by the output or received by the input of a
+	// SymbolTypCipher label, which the label only holds over register
+	// labels.
+	ciphertext Name
+	// Ciphertexts observed by the environment, which it can send.
+	known []Name
 }
 
 type SymbolType int
@@ -25,16 +31,27 @@ const (
 	SymbolTypFreshInput
 	SymbolTypFreshOutput
 	SymbolTypKnown
+	SymbolTypVariable
+	SymbolTypDistinct
+	SymbolTypBoundInput
+	SymbolTypBool
+	SymbolTypInt
+	SymbolTypCipher
 )
 
 type Symbol struct {
 	Type  SymbolType
 	Value int
+	// Ciphertext of a SymbolTypCipher, over register labels.
+	Cipher string
 }
 
 type Label struct {
 	Symbol  Symbol
 	Symbol2 Symbol
+	// Relabelling of the registers of the source held by the destination
+	// under symmetry reduction, e.g. "1→2,2→1".
+	Relabelling string
 }
 
 type Registers struct {
@@ -118,21 +135,40 @@ func (reg *Registers) GetLabel(name string) int {
 	return -1
 }
 
-func newRootConf(process Element) Configuration {
+// copy returns a copy of the register which can be modified without
+// affecting configurations sharing the original.
+func (reg Registers) copy() Registers {
+	registers := make(map[int]string, len(reg.Registers))
+	for label, name := range reg.Registers {
+		registers[label] = name
+	}
+	return Registers{
+		Size:      reg.Size,
+		Registers: registers,
+	}
+}
+
+// Marked names of the root configuration. They are kept in the registers
+// under their own names in the first slots, and are never garbage collected,
+// renamed by the normalisation or renamed by symmetry reduction.
+var markedNames map[string]bool
+
+// getRootFreeNames returns the free names of the process and of the declared
+// processes.
+func getRootFreeNames(process Element) map[string]bool {
 	fns := GetAllFreeNames(process)
 
 	for _, dp := range DeclaredProcs {
 		// Perform alpha conversion on the declared process
 		// to determine scope.
-		proc := deepcopy.Copy(dp.Process).(Element)
 		bni := boundNameIndex
-		DoAlphaConversion(proc)
+		proc := DoAlphaConversion(dp.Process)
 		boundNameIndex = bni
 
 		// Change the parameter names to bound so they are not
 		// included in the free names.
 		for _, oldName := range dp.Parameters {
-			subName(proc, Name{
+			proc = subName(proc, Name{
 				Name: oldName,
 			}, Name{
 				Name: oldName,
@@ -144,48 +180,74 @@ func newRootConf(process Element) Configuration {
 		fns = append(fns, GetAllFreeNames(proc)...)
 	}
 
-	freshNamesSet := make(map[string]bool)
+	freeNames := make(map[string]bool)
 	for _, freshName := range fns {
-		freshNamesSet[freshName] = true
+		freeNames[freshName] = true
 	}
+	return freeNames
+}
 
-	var markedNames []string
+func newRootConf(process Element) Configuration {
+	freshNamesSet := getRootFreeNames(process)
+	initHiddenNames(freshNamesSet)
+
+	// The declared marked names are followed by the free names prefixed by
+	// "_", which are marked names without a declaration.
+	markedNames = make(map[string]bool)
+	marked := append([]string{}, declaredMarkedNames...)
+	for _, name := range marked {
+		markedNames[name] = true
+	}
+	var undeclaredMarked []string
 	var freshNames []string
 	for name := range freshNamesSet {
+		if markedNames[name] {
+			continue
+		}
 		if string(name[0]) == "_" {
-			markedNames = append(markedNames, name)
+			undeclaredMarked = append(undeclaredMarked, name)
 		} else {
 			freshNames = append(freshNames, name)
 		}
 	}
-	sort.Strings(markedNames)
+	sort.Strings(undeclaredMarked)
 	sort.Strings(freshNames)
+	for _, name := range undeclaredMarked {
+		markedNames[name] = true
+		marked = append(marked, name)
+	}
 
-	// Place marked names ("_"-prefixed names) first in the register.
+	// Place marked names first in the register.
 	register := make(map[int]string)
 	regIndex := 1
-	for _, name := range markedNames {
+	for _, name := range marked {
 		register[regIndex] = name
 		regIndex++
 	}
 
-	// Initialise the registers with generated free names.
+	// Initialise the registers with generated free names. The hidden names
+	// keep their own names.
 	for i, name := range freshNames {
 		fn := fnPrefix + strconv.Itoa(i+1)
+		if hiddenNames[name] {
+			fn = name
+		}
 		register[regIndex] = fn
 
 		// Substitute the actual name with a generated free name.
-		subName(process, Name{
+		process = subName(process, Name{
 			Name: name,
 		}, Name{
 			Name: fn,
 		})
 
-		for _, dp := range DeclaredProcs {
+		for procName, dp := range DeclaredProcs {
+			proc := dp.Process
+
 			// Change the parameter names to bound so they are not
 			// substituted with the generated free name.
 			for _, oldName := range dp.Parameters {
-				subName(dp.Process, Name{
+				proc = subName(proc, Name{
 					Name: oldName,
 				}, Name{
 					Name: oldName,
@@ -195,7 +257,7 @@ func newRootConf(process Element) Configuration {
 
 			// Substitute the actual name with a generated free name
 			// in the process definition.
-			subName(dp.Process, Name{
+			proc = subName(proc, Name{
 				Name: name,
 			}, Name{
 				Name: fn,
@@ -204,17 +266,21 @@ func newRootConf(process Element) Configuration {
 			// Undo change of parameter names to bound so
 			// unfolded processes are properly alpha-converted.
 			for _, oldName := range dp.Parameters {
-				subName(dp.Process, Name{
+				proc = subName(proc, Name{
 					Name: oldName,
 					Type: Bound,
 				}, Name{
 					Name: oldName,
 				})
 			}
+
+			dp.Process = proc
+			DeclaredProcs[procName] = dp
 		}
 
 		regIndex++
 	}
+
 	return Configuration{
 		Process: process,
 		Registers: Registers{
@@ -226,85 +292,113 @@ func newRootConf(process Element) Configuration {
 
 var recVisitedProcs map[string]bool
 
+// trans returns the configurations reachable from the configuration in one
+// transition. Elements are immutable and registers are copied before they
+// are modified, so the successors share unchanged subtrees with conf.
 func trans(conf Configuration) []Configuration {
 	switch conf.Process.Type() {
 	// DBLINP = INP1 + INP2A/INP2B
 	case ElemTypInput:
-		inp1Conf := conf
-		inpElem := inp1Conf.Process.(*ElemInput)
+		inpElem := conf.Process.(*ElemInput)
 
 		// Find the input channel label in the register.
-		inpLabel := inp1Conf.Registers.GetLabel(inpElem.Channel.Name)
-		inp1Conf.Label = Label{
+		inpLabel := conf.Registers.GetLabel(inpElem.Channel.Name)
+		inp1Label := Label{
 			Symbol: Symbol{
 				Type:  SymbolTypInput,
 				Value: inpLabel,
 			},
 		}
 
-		// INP2A
+		// INP of a data value
 		var confs []Configuration
-		for _, label := range inp1Conf.Registers.Labels() {
-			inp2aConf := deepcopy.Copy(inp1Conf).(Configuration)
-			inp2aElem := inp2aConf.Process.(*ElemInput)
-			substituteName(inp2aElem, inp2aElem.Input, Name{
-				Name: inp2aConf.Registers.GetName(label),
-				Type: Free,
-			})
+		if inpElem.Sort.isData() {
+			for _, value := range inpElem.Sort.values() {
+				inpConf := conf
+				inpConf.Label = inp1Label
+				inpConf.Label.Symbol2 = getDataSymbol(value)
+				inpConf.Process = substituteName(inpElem.Next, inpElem.Input, value)
+				confs = append(confs, inpConf)
+			}
+			return confs
+		}
+
+		// INP of a placeholder, in the late semantics and in a closed
+		// system, where only communications substitute the placeholder
+		if lateSemantics || closedSystem {
+			return []Configuration{lateInp(conf, inpElem, inp1Label)}
+		}
+
+		// INP2A
+		for _, label := range conf.Registers.Labels() {
+			inp2aConf := conf
+			inp2aConf.Label = inp1Label
 			inp2aConf.Label.Symbol2 = Symbol{
 				Type:  SymbolTypKnown,
 				Value: label,
 			}
-			inp2aConf.Process = inp2aElem.Next
+			inp2aConf.Process = substituteName(inpElem.Next, inpElem.Input, Name{
+				Name: conf.Registers.GetName(label),
+				Type: Free,
+			})
+			confs = append(confs, inp2aConf)
+		}
+		for _, ciphertext := range conf.known {
+			inp2aConf := conf
+			inp2aConf.Label = inp1Label
+			inp2aConf.Label.Symbol2 = getCipherSymbol(ciphertext, conf.Registers)
+			inp2aConf.Process = substituteName(inpElem.Next, inpElem.Input, ciphertext)
+			inp2aConf.ciphertext = ciphertext
 			confs = append(confs, inp2aConf)
 		}
 
 		// INP2B
-		inp2bConf := inp1Conf
-		inp2bElem := inp2bConf.Process.(*ElemInput)
+		inp2bConf := conf
+		inp2bConf.Label = inp1Label
 		// Change the input bound name to a fresh name.
-		substituteName(inp2bElem, inp2bElem.Input, Name{
-			Name: inp2bElem.Input.Name,
+		name := inpElem.Input.Name
+		next := substituteName(inpElem.Next, inpElem.Input, Name{
+			Name: name,
 			Type: Free,
 		})
 
-		name := inp2bElem.Input.Name
-		freshNamesP := GetAllFreeNames(inp2bElem.Next)
+		freshNamesP := GetAllFreeNames(next)
+		inp2bConf.Registers = conf.Registers.copy()
 		inp2bConf.Label.Symbol2 = Symbol{
 			Type:  SymbolTypFreshInput,
 			Value: inp2bConf.Registers.UpdateMin(name, freshNamesP),
 		}
-		inp2bConf.Process = inp2bElem.Next
+		inp2bConf.Process = next
 
 		return append(confs, inp2bConf)
 
 	// DBLOUT = OUT1 + OUT2
 	case ElemTypOutput:
-		out1Conf := conf
-		outElem := out1Conf.Process.(*ElemOutput)
+		outElem := conf.Process.(*ElemOutput)
+
+		outLabel := conf.Registers.GetLabel(outElem.Channel.Name)
 
-		outLabel := out1Conf.Registers.GetLabel(outElem.Channel.Name)
-		out1Conf.Label = Label{
+		// OUT2
+		out2Conf := conf
+		out2Conf.Label = Label{
 			Symbol: Symbol{
 				Type:  SymbolTypOutput,
 				Value: outLabel,
 			},
+			Symbol2: Symbol{
+				Type:  SymbolTypKnown,
+				Value: conf.Registers.GetLabel(outElem.Output.Name),
+			},
 		}
-
-		// OUT2
-		var confs []Configuration
-		out2Conf := out1Conf
-		out2Elem := out2Conf.Process.(*ElemOutput)
-
-		label := out2Conf.Registers.GetLabel(out2Elem.Output.Name)
-
-		out2Conf.Label.Symbol2 = Symbol{
-			Type:  SymbolTypKnown,
-			Value: label,
+		switch outElem.Output.Type {
+		case Data:
+			out2Conf.Label.Symbol2 = getDataSymbol(outElem.Output)
+		case Ciphertext:
+			out2Conf.Label.Symbol2 = getCipherSymbol(outElem.Output, conf.Registers)
+			out2Conf.ciphertext = outElem.Output
 		}
-		out2Conf.Process = out2Elem.Next
-		confs = append(confs, out2Conf)
-		return confs
+		out2Conf.Process = outElem.Next
+		return []Configuration{out2Conf}
 
 	// MATCH
 	case ElemTypMatch:
@@ -316,7 +410,6 @@ func trans(conf Configuration) []Configuration {
 			(matchElem.Inequality && matchElem.NameL.Name != matchElem.NameR.Name) {
 			// o ¦- P
 			matchConf := conf
-			matchElem = matchConf.Process.(*ElemEquality)
 			matchConf.Process = matchElem.Next
 			// o ¦- P -t-> o ¦- P^'
 			tconfs := trans(matchConf)
@@ -326,6 +419,48 @@ func trans(conf Configuration) []Configuration {
 
 		return confs
 
+	// MATCH
+	case ElemTypGuard:
+		guardElem := conf.Process.(*ElemGuard)
+		// o ¦- [g]P
+		if !guardElem.Guard.holds() {
+			return []Configuration{}
+		}
+		// o ¦- P
+		guardConf := conf
+		guardConf.Process = guardElem.Next
+		// o ¦- P -t-> o ¦- P^'
+		return trans(guardConf)
+
+	// LET
+	case ElemTypLet:
+		letElem := conf.Process.(*ElemLet)
+		// o ¦- let x = e in P
+		value, ok := letElem.Expr.eval()
+		if !ok {
+			return []Configuration{}
+		}
+		// o ¦- P{v/x}
+		letConf := conf
+		letConf.Process = substituteName(letElem.Next, letElem.Var, value)
+		// o ¦- P{v/x} -t-> o ¦- P^'
+		return trans(letConf)
+
+	// MATCH, MISMATCH
+	case ElemTypIf:
+		ifElem := conf.Process.(*ElemIf)
+		ifConf := conf
+		// o ¦- if a=b then P else Q
+		if (ifElem.NameL.Name == ifElem.NameR.Name) != ifElem.Inequality {
+			// o ¦- P
+			ifConf.Process = ifElem.Then
+		} else {
+			// o ¦- Q
+			ifConf.Process = ifElem.Else
+		}
+		// o ¦- P -t-> o ¦- P^'
+		return trans(ifConf)
+
 	// RES, OPEN
 	case ElemTypRestriction:
 		var confs []Configuration
@@ -335,34 +470,44 @@ func trans(conf Configuration) []Configuration {
 
 		// RES
 		// P^
-		resConf := deepcopy.Copy(conf).(Configuration)
-		resElem := resConf.Process.(*ElemRestriction)
+		resConf := conf
+		resElem := conf.Process.(*ElemRestriction)
 		resName := resElem.Restrict.Name
 		resConf.Process = resElem.Next
 		// (o+a) ¦- P^
+		resConf.Registers = conf.Registers.copy()
 		resLabel := resConf.Registers.UpdateMax(resName)
 		// (o+a) ¦- P^ -t-> (o'+a) ¦- P^' -t-> (o'+a) ¦- P^'
 		tconfs := trans(resConf)
 		// (o'+a) ¦- P^
 		for _, conf := range tconfs {
 			// OPEN
-			if conf.Label.Symbol.Value != resLabel && conf.Label.Symbol2.Value != resLabel {
+			if conf.Label.Symbol.Value != resLabel &&
+				(isDataSymbol(conf.Label.Symbol2) || conf.Label.Symbol2.Type == SymbolTypBoundInput ||
+					conf.Label.Symbol2.Value != resLabel) {
 				// $a.P^'
 				conf.Process = &ElemRestriction{
 					Restrict: resElem.Restrict,
 					Next:     conf.Process,
 				}
 				// o' ¦- $a.P^'
+				conf.Registers = conf.Registers.copy()
 				conf.Registers.RemoveMax()
 
 				// Convert the restriction free name to a bound name.
-				subName(conf.Process, Name{
+				conf.Process = subName(conf.Process, Name{
 					Name: resName,
 					Type: Free,
 				}, Name{
 					Name: resName,
 					Type: Bound,
 				})
+				conf.ciphertext = subCipher(conf.ciphertext, func(name Name) Name {
+					if name.Name == resName && name.Type == Free {
+						name.Type = Bound
+					}
+					return name
+				})
 
 				confs = append(confs, conf)
 			}
@@ -373,7 +518,7 @@ func trans(conf Configuration) []Configuration {
 				conf.Label.Symbol.Value != resLabel &&
 				conf.Label.Symbol2.Value == resLabel {
 				// o
-				conf.Registers = deepcopy.Copy(baseResConf.Registers).(Registers)
+				conf.Registers = baseResConf.Registers.copy()
 				// fn(P')
 				freeNamesP := GetAllFreeNames(conf.Process)
 				// o[j -> a], j = min{j | reg(j) !E fn(P')}
@@ -384,7 +529,7 @@ func trans(conf Configuration) []Configuration {
 				conf.Label.Symbol2.Type = SymbolTypFreshOutput
 
 				// Substitute the bound name type to a fresh name type.
-				subName(conf.Process, Name{
+				conf.Process = subName(conf.Process, Name{
 					Name: resName,
 					Type: Bound,
 				}, Name{
@@ -412,17 +557,25 @@ func trans(conf Configuration) []Configuration {
 		if len(dp.Parameters) != len(procElem.Parameters) {
 			return []Configuration{}
 		}
+		for i, sort := range dp.Sorts {
+			if !sort.contains(procElem.Parameters[i]) {
+				if sortError == nil {
+					sortError = fmt.Errorf("%s: %s is not of the sort %s of the parameter %s",
+						PrettyPrintAst(procElem), procElem.Parameters[i].Name, sort, dp.Parameters[i])
+				}
+				return []Configuration{}
+			}
+		}
 
 		// P{a/b}
-		proc := deepcopy.Copy(dp.Process).(Element)
+		proc := dp.Process
 		for i, oldName := range dp.Parameters {
-			subName(proc, Name{
+			proc = subName(proc, Name{
 				Name: oldName,
 			}, procElem.Parameters[i])
 		}
 
-		procConf.Process = proc
-		doAlphaConversion(proc)
+		procConf.Process = doAlphaConversion(proc)
 
 		// Create visited processes set.
 		if recVisitedProcs == nil {
@@ -433,6 +586,7 @@ func trans(conf Configuration) []Configuration {
 			return []Configuration{}
 		}
 		recVisitedProcs[processName] = true
+		recordUnfold(procElem)
 		tconfs := trans(procConf)
 		recVisitedProcs = nil
 
@@ -441,17 +595,16 @@ func trans(conf Configuration) []Configuration {
 	// SUM
 	case ElemTypSum:
 		var confs []Configuration
+		sumElem := conf.Process.(*ElemSum)
 
 		// SUM_L
-		sumConf := deepcopy.Copy(conf).(Configuration)
-		sumElem := sumConf.Process.(*ElemSum)
+		sumConf := conf
 		sumConf.Process = sumElem.ProcessL
 		lconfs := trans(sumConf)
 		confs = append(confs, lconfs...)
 
 		// SUM_R
-		sumConf = deepcopy.Copy(conf).(Configuration)
-		sumElem = sumConf.Process.(*ElemSum)
+		sumConf = conf
 		sumConf.Process = sumElem.ProcessR
 		rconfs := trans(sumConf)
 		confs = append(confs, rconfs...)
@@ -464,16 +617,16 @@ func trans(conf Configuration) []Configuration {
 		var lconfs []Configuration
 		var rconfs []Configuration
 		basePar := conf
+		parElem := conf.Process.(*ElemParallel)
 
 		// PAR1_L
-		parConf := deepcopy.Copy(conf).(Configuration)
-		parElem := parConf.Process.(*ElemParallel)
+		parConf := conf
 		parConf.Process = parElem.ProcessL
 		tconfs := trans(parConf)
 
 		// PAR2_L
 		for _, conf := range tconfs {
-			parConf = deepcopy.Copy(basePar).(Configuration)
+			parConf = basePar
 
 			// When DBPINP/DBLOUT and the 2nd label is fresh input/fresh output.
 			if conf.Label.Symbol2.Type == SymbolTypFreshInput ||
@@ -484,6 +637,7 @@ func trans(conf Configuration) []Configuration {
 				// Get the name reg(i).
 				name := conf.Registers.GetName(conf.Label.Symbol2.Value)
 				// Update register to be j = min{j | reg(j) \notin fn(P′,Q)}.
+				parConf.Registers = basePar.Registers.copy()
 				newLabel := parConf.Registers.UpdateMin(name,
 					append(freeNamesP, freeNamesQ...))
 				// Update the label j.
@@ -493,21 +647,24 @@ func trans(conf Configuration) []Configuration {
 				parConf.Label = conf.Label
 				parConf.Registers = conf.Registers
 			}
+			parConf.ciphertext = conf.ciphertext
 			// Insert P' to P' | Q.
-			parConf.Process.(*ElemParallel).ProcessL = conf.Process
+			parConf.Process = &ElemParallel{
+				ProcessL: conf.Process,
+				ProcessR: parElem.ProcessR,
+			}
 
 			lconfs = append(lconfs, parConf)
 		}
 
 		// PAR1_R
-		parConf = deepcopy.Copy(conf).(Configuration)
-		parElem = parConf.Process.(*ElemParallel)
+		parConf = conf
 		parConf.Process = parElem.ProcessR
 		tconfs = trans(parConf)
 
 		// PAR2_R
 		for _, conf := range tconfs {
-			parConf = deepcopy.Copy(basePar).(Configuration)
+			parConf = basePar
 			// When DBPINP/DBLOUT and the 2nd label is fresh input/fresh output.
 			if conf.Label.Symbol2.Type == SymbolTypFreshInput ||
 				conf.Label.Symbol2.Type == SymbolTypFreshOutput {
@@ -517,6 +674,7 @@ func trans(conf Configuration) []Configuration {
 				// Get the name reg(i).
 				name := conf.Registers.GetName(conf.Label.Symbol2.Value)
 				// Update register to be j = min{j | reg(j) \notin fn(P,Q')}.
+				parConf.Registers = basePar.Registers.copy()
 				newLabel := parConf.Registers.UpdateMin(name,
 					append(freeNamesP, freeNamesQ...))
 				// Update the label j.
@@ -526,8 +684,12 @@ func trans(conf Configuration) []Configuration {
 				parConf.Label = conf.Label
 				parConf.Registers = conf.Registers
 			}
+			parConf.ciphertext = conf.ciphertext
 			// Insert Q' to P | Q'.
-			parConf.Process.(*ElemParallel).ProcessR = conf.Process
+			parConf.Process = &ElemParallel{
+				ProcessL: parElem.ProcessL,
+				ProcessR: conf.Process,
+			}
 
 			rconfs = append(rconfs, parConf)
 		}
@@ -538,17 +700,13 @@ func trans(conf Configuration) []Configuration {
 		for _, lconf := range lconfs {
 			for _, rconf := range rconfs {
 				if lconf.Label.Symbol.Type == SymbolTypOutput &&
-					lconf.Label.Symbol2.Type == SymbolTypKnown &&
 					rconf.Label.Symbol.Type == SymbolTypInput &&
-					rconf.Label.Symbol2.Type == SymbolTypKnown &&
 					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value &&
-					lconf.Label.Symbol2.Value == rconf.Label.Symbol2.Value {
-					lproc := deepcopy.Copy(lconf.Process).(Element).(*ElemParallel).ProcessL
-					rproc := deepcopy.Copy(rconf.Process).(Element).(*ElemParallel).ProcessR
-					comm := deepcopy.Copy(basePar).(Configuration)
+					isCommValue(lconf.Label.Symbol2, rconf.Label.Symbol2) {
+					comm := basePar
 					comm.Process = &ElemParallel{
-						ProcessL: lproc,
-						ProcessR: rproc,
+						ProcessL: lconf.Process.(*ElemParallel).ProcessL,
+						ProcessR: rconf.Process.(*ElemParallel).ProcessR,
 					}
 					comm.Label = Label{
 						Symbol: Symbol{
@@ -557,6 +715,36 @@ func trans(conf Configuration) []Configuration {
 					}
 					confs = append(confs, comm)
 				}
+				// COMM of a placeholder
+				if lconf.Label.Symbol.Type == SymbolTypOutput &&
+					lconf.Label.Symbol2.Type == SymbolTypKnown &&
+					rconf.Label.Symbol.Type == SymbolTypInput &&
+					rconf.Label.Symbol2.Type == SymbolTypBoundInput &&
+					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
+					comm := basePar
+					comm.Process = commPlaceholder(lconf, rconf, true)
+					comm.Label = Label{
+						Symbol: Symbol{
+							Type: SymbolTypTau,
+						},
+					}
+					confs = append(confs, comm)
+				}
+				// COMM of a ciphertext
+				if lconf.Label.Symbol.Type == SymbolTypOutput &&
+					lconf.Label.Symbol2.Type == SymbolTypCipher &&
+					rconf.Label.Symbol.Type == SymbolTypInput &&
+					isNameInput(rconf.Label.Symbol2) &&
+					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
+					comm := basePar
+					comm.Process = commCipher(lconf, rconf, true)
+					comm.Label = Label{
+						Symbol: Symbol{
+							Type: SymbolTypTau,
+						},
+					}
+					confs = append(confs, comm)
+				}
 			}
 		}
 
@@ -564,18 +752,44 @@ func trans(conf Configuration) []Configuration {
 		for _, lconf := range lconfs {
 			for _, rconf := range rconfs {
 				if lconf.Label.Symbol.Type == SymbolTypInput &&
-					lconf.Label.Symbol2.Type == SymbolTypKnown &&
 					rconf.Label.Symbol.Type == SymbolTypOutput &&
-					rconf.Label.Symbol2.Type == SymbolTypKnown &&
 					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value &&
-					lconf.Label.Symbol2.Value == rconf.Label.Symbol2.Value {
-					lproc := deepcopy.Copy(lconf.Process).(Element).(*ElemParallel).ProcessL
-					rproc := deepcopy.Copy(rconf.Process).(Element).(*ElemParallel).ProcessR
-					comm := deepcopy.Copy(basePar).(Configuration)
+					isCommValue(lconf.Label.Symbol2, rconf.Label.Symbol2) {
+					comm := basePar
 					comm.Process = &ElemParallel{
-						ProcessL: lproc,
-						ProcessR: rproc,
+						ProcessL: lconf.Process.(*ElemParallel).ProcessL,
+						ProcessR: rconf.Process.(*ElemParallel).ProcessR,
+					}
+					comm.Label = Label{
+						Symbol: Symbol{
+							Type: SymbolTypTau,
+						},
 					}
+					confs = append(confs, comm)
+				}
+				// COMM of a placeholder
+				if lconf.Label.Symbol.Type == SymbolTypInput &&
+					lconf.Label.Symbol2.Type == SymbolTypBoundInput &&
+					rconf.Label.Symbol.Type == SymbolTypOutput &&
+					rconf.Label.Symbol2.Type == SymbolTypKnown &&
+					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
+					comm := basePar
+					comm.Process = commPlaceholder(rconf, lconf, false)
+					comm.Label = Label{
+						Symbol: Symbol{
+							Type: SymbolTypTau,
+						},
+					}
+					confs = append(confs, comm)
+				}
+				// COMM of a ciphertext
+				if lconf.Label.Symbol.Type == SymbolTypInput &&
+					isNameInput(lconf.Label.Symbol2) &&
+					rconf.Label.Symbol.Type == SymbolTypOutput &&
+					rconf.Label.Symbol2.Type == SymbolTypCipher &&
+					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
+					comm := basePar
+					comm.Process = commCipher(rconf, lconf, false)
 					comm.Label = Label{
 						Symbol: Symbol{
 							Type: SymbolTypTau,
@@ -587,19 +801,19 @@ func trans(conf Configuration) []Configuration {
 		}
 
 		// CLOSE
-		clconf := deepcopy.Copy(conf).(Configuration)
+		clconf := conf
 		// (#+o)
+		clconf.Registers = conf.Registers.copy()
 		clconf.Registers.AddEmptyName()
-		parElem = clconf.Process.(*ElemParallel)
 		// (#+o) ¦- P
 		clconf.Process = parElem.ProcessL
 		// -t-> (b+o) ¦- P'
 		clconfs := trans(clconf)
 
-		crconf := deepcopy.Copy(conf).(Configuration)
+		crconf := conf
 		// (#+o)
+		crconf.Registers = conf.Registers.copy()
 		crconf.Registers.AddEmptyName()
-		parElem = crconf.Process.(*ElemParallel)
 		// (#+o) ¦- Q
 		crconf.Process = parElem.ProcessR
 		// -t-> (b+o) ¦- Q'
@@ -612,25 +826,19 @@ func trans(conf Configuration) []Configuration {
 					lconf.Label.Symbol2.Type == SymbolTypFreshOutput &&
 					lconf.Label.Symbol2.Value == 1 &&
 					rconf.Label.Symbol.Type == SymbolTypInput &&
-					rconf.Label.Symbol2.Type == SymbolTypFreshInput &&
-					rconf.Label.Symbol2.Value == 1 &&
+					isCloseInput(rconf.Label.Symbol2) &&
 					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
 					{
-						close := deepcopy.Copy(basePar).(Configuration)
-						lproc := deepcopy.Copy(lconf.Process).(Element)
-						rproc := deepcopy.Copy(rconf.Process).(Element)
+						close := basePar
 
 						// Q'{a/b}
 						resName := lconf.Registers.GetName(1)
-						oldName := Name{
-							Name: rconf.Registers.GetName(1),
-							Type: Free,
-						}
+						oldName := getReceivedName(rconf)
 						newName := Name{
 							Name: resName,
 							Type: Bound,
 						}
-						substituteName(rproc, oldName, newName)
+						rproc := substituteName(rconf.Process, oldName, newName)
 
 						// Convert restriction free name in P' to bound name.
 						oldName = Name{
@@ -641,7 +849,7 @@ func trans(conf Configuration) []Configuration {
 							Name: resName,
 							Type: Bound,
 						}
-						substituteName(lproc, oldName, newName)
+						lproc := substituteName(lconf.Process, oldName, newName)
 
 						close.Process = &ElemRestriction{
 							Restrict: Name{
@@ -663,28 +871,22 @@ func trans(conf Configuration) []Configuration {
 				}
 				// CLOSE_R
 				if lconf.Label.Symbol.Type == SymbolTypInput &&
-					lconf.Label.Symbol2.Type == SymbolTypFreshInput &&
-					lconf.Label.Symbol2.Value == 1 &&
+					isCloseInput(lconf.Label.Symbol2) &&
 					rconf.Label.Symbol.Type == SymbolTypOutput &&
 					rconf.Label.Symbol2.Type == SymbolTypFreshOutput &&
 					rconf.Label.Symbol2.Value == 1 &&
 					lconf.Label.Symbol.Value == rconf.Label.Symbol.Value {
 					{
-						close := deepcopy.Copy(basePar).(Configuration)
-						lproc := deepcopy.Copy(lconf.Process).(Element)
-						rproc := deepcopy.Copy(rconf.Process).(Element)
+						close := basePar
 
 						// P'{a/b}
 						resName := rconf.Registers.GetName(1)
-						oldName := Name{
-							Name: lconf.Registers.GetName(1),
-							Type: Free,
-						}
+						oldName := getReceivedName(lconf)
 						newName := Name{
 							Name: resName,
 							Type: Bound,
 						}
-						substituteName(lproc, oldName, newName)
+						lproc := substituteName(lconf.Process, oldName, newName)
 
 						// Convert restriction free name in Q' to bound name.
 						oldName = Name{
@@ -695,7 +897,7 @@ func trans(conf Configuration) []Configuration {
 							Name: resName,
 							Type: Bound,
 						}
-						substituteName(rproc, oldName, newName)
+						rproc := substituteName(rconf.Process, oldName, newName)
 
 						close.Process = &ElemRestriction{
 							Restrict: Name{
@@ -721,11 +923,18 @@ func trans(conf Configuration) []Configuration {
 		return confs
 
 	case ElemTypRoot:
-		rootConf := deepcopy.Copy(conf).(Configuration)
-		rootConf.Process = rootConf.Process.(*ElemRoot).Next
+		rootConf := conf
+		rootConf.Process = conf.Process.(*ElemRoot).Next
+		rootConf.known = getKnownCiphertexts(rootConf.Process)
 		tconfs := trans(rootConf)
 		// Reattach the root element.
 		for i, conf := range tconfs {
+			// The input of a ciphertext from the environment extrudes
+			// the restrictions of its names to the receiver.
+			if conf.Label.Symbol.Type == SymbolTypInput &&
+				conf.Label.Symbol2.Type == SymbolTypCipher {
+				conf.Process = restrictNames(extrudeCipherRes(conf.Process, conf.ciphertext))
+			}
 			tconfs[i].Process = &ElemRoot{
 				Next: conf.Process,
 			}
@@ -734,3 +943,20 @@ func trans(conf Configuration) []Configuration {
 	}
 	return nil
 }
+
+// isCloseInput reports whether the symbol is the input of the fresh name of
+// the empty register added for CLOSE, or of a placeholder.
+func isCloseInput(symbol Symbol) bool {
+	return (symbol.Type == SymbolTypFreshInput && symbol.Value == 1) ||
+		symbol.Type == SymbolTypBoundInput
+}
+
+// isCommValue reports whether an output and an input of the same channel
+// communicate, i.e. the name of the same register label or the same data
+// value is sent and received.
+func isCommValue(symbolOut Symbol, symbolInp Symbol) bool {
+	if symbolOut.Type != SymbolTypKnown && !isDataSymbol(symbolOut) {
+		return false
+	}
+	return symbolOut == symbolInp
+}
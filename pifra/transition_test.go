@@ -201,6 +201,94 @@ a(b).0 | $x.a<a>.0
 1 2* -> {(1,#1),(2,&b_0)} ¦- (0 | $&x_1.#1'<#1>.0)
 1'1  -> {(1,#1)} ¦- (#1(&b_0).0 | $&x_1.0)
 t    -> {(1,#1)} ¦- (0 | $&x_1.0)
+`),
+		},
+		"guard_and": {
+			input: []byte(`
+[a=a && a!=b]a'<b>.0 + [a=a && a=b]b'<a>.0
+`),
+			output: []byte(`
+1'2  -> {(1,#1),(2,#2)} ¦- 0
+`),
+		},
+		"guard_or": {
+			input: []byte(`
+[a=b || b=b]a'<b>.0 + [a=b || b!=b]b'<a>.0
+`),
+			output: []byte(`
+1'2  -> {(1,#1),(2,#2)} ¦- 0
+`),
+		},
+		"data_input": {
+			input: []byte(`
+a(x: 0..1).a'<x>.0
+`),
+			output: []byte(`
+1 =0  -> {(1,#1)} ¦- #1'<0>.0
+1 =1  -> {(1,#1)} ¦- #1'<1>.0
+`),
+		},
+		"data_comm": {
+			input: []byte(`
+a'<true>.0 | a(x: bool).0
+`),
+			output: []byte(`
+1'=true  -> {(1,#1)} ¦- (0 | #1(&x_0: bool).0)
+1 =false  -> {(1,#1)} ¦- (#1'<true>.0 | 0)
+1 =true  -> {(1,#1)} ¦- (#1'<true>.0 | 0)
+t    -> {(1,#1)} ¦- (0 | 0)
+`),
+		},
+		"let": {
+			input: []byte(`
+let n = 1+2-1 in [n>=2]a'<n>.0
+`),
+			output: []byte(`
+1'=2  -> {(1,#1)} ¦- 0
+`),
+		},
+		"sort_range": {
+			input: []byte(`
+P(n: 0..1) = a'<n>.P(n+1)
+P(2)
+`),
+			output: []byte(`
+`),
+		},
+		"cipher_output": {
+			input: []byte(`
+$k.a'<enc(a,k)>.0
+`),
+			output: []byte(`
+1'{1}_  -> {(1,#1)} ¦- $&k_0.0
+`),
+		},
+		"cipher_extrusion": {
+			input: []byte(`
+$s.a'<enc(s,k)>.0 | a(x).let y = dec(x,k) in y'<x>.0
+`),
+			output: []byte(`
+1'{_}2  -> {(1,#1),(2,#2)} ¦- ($&s_0.0 | #1(&x_2).let &y_3 = dec(&x_2,#2) in &y_3'<&x_2>.0)
+1 1  -> {(1,#1),(2,#2)} ¦- ($&s_0.let &%1_1 = enc(&s_0,#2) in #1'<&%1_1>.0 | let &y_3 = dec(#1,#2) in &y_3'<#1>.0)
+1 2  -> {(1,#1),(2,#2)} ¦- ($&s_0.let &%1_1 = enc(&s_0,#2) in #1'<&%1_1>.0 | let &y_3 = dec(#2,#2) in &y_3'<#2>.0)
+1 3* -> {(1,#1),(2,#2),(3,&x_2)} ¦- ($&s_0.let &%1_1 = enc(&s_0,#2) in #1'<&%1_1>.0 | let &y_3 = dec(&x_2,#2) in &y_3'<&x_2>.0)
+t    -> {(1,#1),(2,#2)} ¦- $&s_0.(0 | let &y_3 = dec({&s_0}#2,#2) in &y_3'<{&s_0}#2>.0)
+`),
+		},
+		"if_match": {
+			input: []byte(`
+if a=a then a'<b>.0 else b'<a>.0
+`),
+			output: []byte(`
+1'2  -> {(1,#1),(2,#2)} ¦- 0
+`),
+		},
+		"if_mismatch": {
+			input: []byte(`
+if a!=a then a'<b>.0 else b'<a>.0
+`),
+			output: []byte(`
+2'1  -> {(1,#1),(2,#2)} ¦- 0
 `),
 		},
 	}
@@ -220,3 +308,50 @@ t    -> {(1,#1)} ¦- (0 | $&x_1.0)
 		})
 	}
 }
+
+func TestTransImmutable(t *testing.T) {
+	tests := map[string][]byte{
+		"sum_par_res": []byte(`
+$a.(b'<a>.0 + b(x).x'<a>.0) | b(y).y'<y>.0
+`),
+		"close": []byte(`
+$a.b'<a>.a(x).0 | b(y).y'<y>.0
+`),
+		"process": []byte(`
+P(a) = a(x).$y.(x'<y>.0 | P(y))
+P(a)
+`),
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			proc, _ := InitProgram(input)
+			root := newRootConf(proc)
+			before := prettyPrintRegister(root.Registers) + PrettyPrintAst(root.Process)
+			for _, conf := range trans(root) {
+				applyStructrualCongruence(conf)
+			}
+			after := prettyPrintRegister(root.Registers) + PrettyPrintAst(root.Process)
+			if before != after {
+				t.Errorf("configuration modified: %s, was: %s", after, before)
+			}
+		})
+	}
+}
+
+func TestMarkedNames(t *testing.T) {
+	proc, err := InitProgram([]byte("marked pub, bad\n_c'<a>.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := newRootConf(proc)
+	registers := prettyPrintRegister(root.Registers)
+	if registers != "{(1,pub),(2,bad),(3,_c),(4,#1)}" {
+		t.Errorf("registers: %s", registers)
+	}
+	// The marked names are not garbage collected, unlike the free name a.
+	conf := applyStructrualCongruence(trans(root)[0])
+	registers = prettyPrintRegister(conf.Registers)
+	if registers != "{(1,pub),(2,bad),(3,_c)}" {
+		t.Errorf("registers: %s", registers)
+	}
+}